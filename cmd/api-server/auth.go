@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.temporal.io/sdk/client"
+	"gorm.io/gorm"
+
+	"omniflow/internal/app"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+)
+
+// loadVerifier 读取验签密钥 (AUTH_KEYS_FILE，默认 config/auth/keys.yaml)
+func loadVerifier() (*auth.Verifier, error) {
+	path := os.Getenv("AUTH_KEYS_FILE")
+	if path == "" {
+		path = "config/auth/keys.yaml"
+	}
+	return auth.LoadFile(path)
+}
+
+// authMiddleware 所有业务接口都需要 Bearer Token
+func authMiddleware(v *auth.Verifier) gin.HandlerFunc {
+	return auth.Middleware(v, func(c *gin.Context, err error) {
+		abortWithError(c, apierr.New(apierr.Unauthorized))
+	})
+}
+
+// requireRole 要求拥有任一角色
+func requireRole(roles ...string) gin.HandlerFunc {
+	return auth.RequireRole(func(c *gin.Context) {
+		abortWithError(c, apierr.New(apierr.Forbidden))
+	}, roles...)
+}
+
+// isStaff 审核员与管理员可以查看、处理所有客户的订单
+func isStaff(c *gin.Context) bool {
+	return staffClaims(auth.FromContext(c))
+}
+
+func staffClaims(claims *auth.Claims) bool {
+	return claims != nil && claims.HasRole(auth.RoleReviewer, auth.RoleAdmin)
+}
+
+// requireOrderOwner 客户只能访问自己的订单
+func requireOrderOwner(db *gorm.DB, temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := checkOrderOwner(c.Request.Context(), db, temporalClient, auth.FromContext(c), c.Param("id")); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkOrderOwner 订单归属校验 (HTTP 与 gRPC 共用)，审核员与管理员不受限
+// 先查 MySQL 读模型；读模型异步写入，刚下单或投影失败时没有记录，再以 Workflow 启动参数为准
+// 别人的订单与不存在的订单一样返回 404，不暴露订单号是否存在
+func checkOrderOwner(ctx context.Context, db *gorm.DB, temporalClient client.Client, claims *auth.Claims, orderID string) *apierr.Error {
+	if staffClaims(claims) {
+		return nil
+	}
+	// 空的客户 ID 会匹配 customer_id 为空的订单
+	if claims == nil || claims.CustomerID() == "" {
+		return apierr.New(apierr.Forbidden)
+	}
+	var record app.OrderRecord
+	err := db.WithContext(ctx).Select("customer_id").First(&record, "order_id = ?", orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		record.CustomerID, err = app.OrderCustomer(ctx, temporalClient, orderID)
+		if errors.Is(err, app.ErrOrderNotStarted) {
+			return apierr.New(apierr.NotFound)
+		}
+	}
+	switch {
+	case err != nil:
+		return apierr.New(apierr.Internal)
+	case record.CustomerID != claims.CustomerID():
+		return apierr.New(apierr.NotFound)
+	}
+	return nil
+}
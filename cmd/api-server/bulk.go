@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+)
+
+var bulkOrderItems = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "omniflow_bulk_order_items_total",
+	Help: "批量下单中逐笔订单的结果",
+}, []string{"result"})
+
+// bulkOptions 批量下单的限制 (BULK_ORDER_MAX_ITEMS / BULK_ORDER_MAX_BYTES / BULK_ORDER_CONCURRENCY)
+type bulkOptions struct {
+	MaxItems    int
+	MaxBytes    int64
+	Concurrency int // 同时通过漏斗的订单数
+}
+
+func bulkOptionsFromEnv() bulkOptions {
+	return bulkOptions{
+		MaxItems:    envInt("BULK_ORDER_MAX_ITEMS", 500),
+		MaxBytes:    int64(envInt("BULK_ORDER_MAX_BYTES", 4<<20)),
+		Concurrency: max(1, envInt("BULK_ORDER_CONCURRENCY", 16)),
+	}
+}
+
+// bulkOrderItem 批量下单中的一笔订单
+// customer_id 只对 importer 角色生效 (代客户下单)，客户角色一律使用 Token 中的客户 ID
+type bulkOrderItem struct {
+	createOrderRequest
+	CustomerID     string `json:"customer_id"`
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// bulkResult 一笔订单的结果，按提交顺序返回
+type bulkResult struct {
+	Index          int    `json:"index"`
+	Status         string `json:"status"` // accepted / rejected
+	HTTPStatus     int    `json:"http_status"`
+	OrderID        string `json:"order_id,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	Replayed       bool   `json:"replayed,omitempty"`
+	Code           string `json:"code,omitempty"`
+	Message        string `json:"message,omitempty"`
+	Field          string `json:"field,omitempty"`
+	Detail         string `json:"detail,omitempty"`
+	RetryAfter     int    `json:"retry_after,omitempty"`
+}
+
+// errBatchTooLarge 订单数超过上限
+var errBatchTooLarge = errors.New("批量下单订单数超过上限")
+
+// parseBulkOrders 解析 JSON 数组或 NDJSON (Content-Type: application/x-ndjson，每行一笔)
+// 单笔格式错误不影响其他订单：items 与 invalid 按下标对应，invalid[i] 为 true 表示该笔无法解析
+func parseBulkOrders(body io.Reader, ndjson bool, maxItems int) ([]bulkOrderItem, []bool, error) {
+	var raws []json.RawMessage
+	if ndjson {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			raws = append(raws, append(json.RawMessage(nil), line...))
+			if len(raws) > maxItems {
+				return nil, nil, errBatchTooLarge
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+	} else if err := json.NewDecoder(body).Decode(&raws); err != nil {
+		return nil, nil, err
+	}
+	if len(raws) > maxItems {
+		return nil, nil, errBatchTooLarge
+	}
+
+	items := make([]bulkOrderItem, len(raws))
+	invalid := make([]bool, len(raws))
+	for i, raw := range raws {
+		if err := json.Unmarshal(raw, &items[i]); err != nil {
+			invalid[i] = true
+		}
+	}
+	return items, invalid, nil
+}
+
+// bulkCreateOrdersHandler 批量下单：逐笔校验并通过漏斗 (与单笔下单完全一致)，并发数受限
+// 只要请求体能解析就返回 200，逐笔给出 accepted / rejected 与错误码；部分成功时调用方只需重试被拒绝的订单
+func bulkCreateOrdersHandler(funnel *orderFunnel, opt bulkOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := auth.FromContext(c)
+		importer := claims.HasRole(auth.RoleImporter)
+		lang := apierr.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, opt.MaxBytes)
+		ndjson := strings.HasPrefix(c.ContentType(), "application/x-ndjson")
+		items, invalid, err := parseBulkOrders(body, ndjson, opt.MaxItems)
+		switch {
+		case errors.Is(err, errBatchTooLarge):
+			abortWithError(c, apierr.Invalid("orders").WithDetail(err.Error()))
+			return
+		case err != nil:
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		case len(items) == 0:
+			abortWithError(c, apierr.Invalid("orders"))
+			return
+		}
+
+		results := make([]bulkResult, len(items))
+		reject := func(i int, e *apierr.Error) {
+			results[i] = bulkResult{
+				Index:          i,
+				Status:         "rejected",
+				HTTPStatus:     e.HTTPStatus(),
+				IdempotencyKey: items[i].IdempotencyKey,
+				Code:           string(e.Code),
+				Message:        e.Message(lang),
+				Field:          e.Field,
+				Detail:         e.Detail,
+			}
+		}
+
+		// 先做不需要访问 Redis 的校验：格式、客户、批内重复的幂等键
+		seenKeys := make(map[string]int, len(items))
+		pending := make([]int, 0, len(items))
+		for i := range items {
+			item := &items[i]
+			if invalid[i] {
+				reject(i, apierr.New(apierr.InvalidRequest))
+				continue
+			}
+			item.createOrderRequest.CustomerID = claims.CustomerID()
+			if importer {
+				if item.CustomerID == "" {
+					reject(i, apierr.Invalid("customer_id"))
+					continue
+				}
+				item.createOrderRequest.CustomerID = item.CustomerID
+			}
+			if key := item.IdempotencyKey; key != "" {
+				dupKey := item.createOrderRequest.CustomerID + "\x00" + key
+				if first, dup := seenKeys[dupKey]; dup {
+					reject(i, apierr.Invalid("idempotency_key").WithDetail("与第 "+strconv.Itoa(first)+" 笔订单重复"))
+					continue
+				}
+				seenKeys[dupKey] = i
+			}
+			pending = append(pending, i)
+		}
+
+		// 逐笔通过漏斗，最多 Concurrency 笔同时进行
+		sem := make(chan struct{}, opt.Concurrency)
+		var wg sync.WaitGroup
+		for _, i := range pending {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int) {
+				defer func() { <-sem; wg.Done() }()
+				outcome := funnel.place(c.Request.Context(), items[i].createOrderRequest, items[i].IdempotencyKey)
+				if outcome.Err != nil {
+					reject(i, outcome.Err)
+					results[i].RetryAfter = int(outcome.RetryAfter.Seconds())
+					return
+				}
+				var resp struct {
+					OrderID string `json:"order_id"`
+				}
+				_ = json.Unmarshal(outcome.Body, &resp)
+				results[i] = bulkResult{
+					Index:          i,
+					Status:         "accepted",
+					HTTPStatus:     outcome.Status,
+					OrderID:        resp.OrderID,
+					IdempotencyKey: items[i].IdempotencyKey,
+					Replayed:       outcome.Replayed,
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		accepted := 0
+		for _, r := range results {
+			if r.Status == "accepted" {
+				accepted++
+			}
+			bulkOrderItems.WithLabelValues(r.Status).Inc()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"total":    len(results),
+			"accepted": accepted,
+			"rejected": len(results) - accepted,
+			"results":  results,
+		})
+	}
+}
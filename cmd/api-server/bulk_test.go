@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+)
+
+type bulkResponse struct {
+	Total    int          `json:"total"`
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Results  []bulkResult `json:"results"`
+}
+
+func bulkRouter(env *testEnv, opt bulkOptions) *gin.Engine {
+	r := gin.New()
+	r.Use(authMiddleware(env.verifier))
+	r.POST("/api/v1/orders/batch", requireRole(auth.RoleCustomer, auth.RoleImporter), bulkCreateOrdersHandler(env.funnel, opt))
+	return r
+}
+
+func postBulk(t *testing.T, r http.Handler, token, contentType, body string) bulkResponse {
+	t.Helper()
+	w := serve(r, "POST", "/api/v1/orders/batch", token, contentType, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp bulkResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestBulkCreateOrders_JSONPartialSuccess(t *testing.T) {
+	env := newTestEnv(t)
+	env.preheat(t, "iPhone15", 5)
+	env.preheat(t, "SOLD_OUT", 0)
+	r := bulkRouter(env, bulkOptions{MaxItems: 10, MaxBytes: 1 << 20, Concurrency: 2})
+	customer := env.token(t, "C1", auth.RoleCustomer)
+
+	// 客户角色：customer_id 被忽略，一律按 Token 中的客户下单
+	body := `[
+		{"amount": 100, "items": ["iPhone15"], "idempotency_key": "k1", "customer_id": "OTHER"},
+		{"amount": 100, "items": "iPhone15"},
+		{"amount": 100, "items": ["SOLD_OUT"]},
+		{"amount": 100, "items": ["iPhone15"], "idempotency_key": "k1"},
+		{"amount": 100, "items": []}
+	]`
+	resp := postBulk(t, r, customer, "application/json", body)
+	assert.Equal(t, 5, resp.Total)
+	assert.Equal(t, 1, resp.Accepted)
+	assert.Equal(t, 4, resp.Rejected)
+	require.Len(t, resp.Results, 5)
+	for i, res := range resp.Results {
+		assert.Equal(t, i, res.Index, "按提交顺序返回")
+	}
+
+	ok := resp.Results[0]
+	assert.Equal(t, "accepted", ok.Status)
+	assert.Equal(t, http.StatusAccepted, ok.HTTPStatus)
+	assert.Equal(t, idempotentWorkflowID("C1", "k1"), ok.OrderID)
+
+	assert.Equal(t, string(apierr.InvalidRequest), resp.Results[1].Code, "格式错误只影响这一笔")
+	assert.Equal(t, http.StatusBadRequest, resp.Results[1].HTTPStatus)
+	assert.Equal(t, string(apierr.OutOfStock), resp.Results[2].Code)
+	assert.Equal(t, apierr.New(apierr.OutOfStock).HTTPStatus(), resp.Results[2].HTTPStatus)
+
+	// 批内重复的幂等键：不进入漏斗，指出与哪一笔重复
+	dup := resp.Results[3]
+	assert.Equal(t, "rejected", dup.Status)
+	assert.Equal(t, string(apierr.InvalidRequest), dup.Code)
+	assert.Equal(t, "idempotency_key", dup.Field)
+	assert.Contains(t, dup.Detail, "第 0 笔")
+	assert.Equal(t, "items", resp.Results[4].Field)
+	assert.Equal(t, 4, env.stock(t, "iPhone15"), "只扣减一次")
+
+	// 整批重试：已受理的订单回放首次结果
+	resp = postBulk(t, r, customer, "application/json", `[{"amount": 100, "items": ["iPhone15"], "idempotency_key": "k1"}]`)
+	require.Len(t, resp.Results, 1)
+	assert.True(t, resp.Results[0].Replayed)
+	assert.Equal(t, ok.OrderID, resp.Results[0].OrderID)
+	assert.Equal(t, 4, env.stock(t, "iPhone15"))
+}
+
+func TestBulkCreateOrders_NDJSONImporter(t *testing.T) {
+	env := newTestEnv(t)
+	env.preheat(t, "iPhone15", 5)
+	r := bulkRouter(env, bulkOptions{MaxItems: 3, MaxBytes: 1 << 20, Concurrency: 4})
+	importer := env.token(t, "B2B-GW", auth.RoleImporter)
+
+	// importer 代客户下单：必须指定 customer_id，幂等键按客户区分 (不同客户的同一个 Key 不算重复)
+	body := strings.Join([]string{
+		`{"amount": 100, "items": ["iPhone15"], "customer_id": "C7", "idempotency_key": "k1"}`,
+		``,
+		`{"amount": 100, "items": ["iPhone15"], "customer_id": "C8", "idempotency_key": "k1"}`,
+		`{"amount": 100, "items": ["iPhone15"], "idempotency_key": "k2"}`,
+	}, "\n")
+	resp := postBulk(t, r, importer, "application/x-ndjson", body)
+	assert.Equal(t, 3, resp.Total, "空行跳过")
+	assert.Equal(t, 2, resp.Accepted)
+	assert.Equal(t, idempotentWorkflowID("C7", "k1"), resp.Results[0].OrderID)
+	assert.Equal(t, idempotentWorkflowID("C8", "k1"), resp.Results[1].OrderID)
+	assert.Equal(t, "rejected", resp.Results[2].Status)
+	assert.Equal(t, "customer_id", resp.Results[2].Field)
+	assert.Equal(t, 3, env.stock(t, "iPhone15"))
+
+	// 整批不可解析或超过上限时整体拒绝
+	w := serve(r, "POST", "/api/v1/orders/batch", importer, "application/x-ndjson", strings.Repeat(`{"items": ["iPhone15"]}`+"\n", 4))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"orders"`)
+	w = serve(r, "POST", "/api/v1/orders/batch", importer, "application/json", `{"items": ["iPhone15"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(r, "POST", "/api/v1/orders/batch", importer, "application/json", `[]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 审核员不能批量下单
+	w = serve(r, "POST", "/api/v1/orders/batch", env.token(t, "R1", auth.RoleReviewer), "application/json", `[]`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
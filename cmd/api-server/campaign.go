@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"omniflow/internal/app"
+	"omniflow/internal/pkg/apierr"
+)
+
+// campaignResponse 后台查看的活动详情
+func campaignResponse(c *app.Campaign) gin.H {
+	allocations := make([]gin.H, 0, len(c.Allocations))
+	for _, a := range c.Allocations {
+		allocations = append(allocations, gin.H{
+			"sku":        a.SKU,
+			"quantity":   a.Quantity,
+			"sale_price": a.SalePrice,
+			"remaining":  a.Remaining,
+			"sold":       a.Sold,
+			"pending":    a.Pending,
+		})
+	}
+	return gin.H{
+		"id":             c.ID,
+		"name":           c.Name,
+		"start_at":       c.StartAt,
+		"end_at":         c.EndAt,
+		"per_user_limit": c.PerUserLimit,
+		"state":          c.State,
+		"allocations":    allocations,
+	}
+}
+
+// abortWithCampaignError 活动服务错误 -> API 错误
+func abortWithCampaignError(c *gin.Context, err error) {
+	var inputErr *app.CampaignInputError
+	switch {
+	case errors.As(err, &inputErr):
+		abortWithError(c, apierr.Invalid(inputErr.Field))
+	case errors.Is(err, app.ErrCampaignNotFound):
+		abortWithError(c, apierr.New(apierr.CampaignNotFound))
+	case errors.Is(err, app.ErrCampaignConflict), errors.Is(err, app.ErrCampaignState):
+		abortWithError(c, apierr.New(apierr.CampaignConflict).WithDetail(err.Error()))
+	default:
+		log.Printf("活动操作失败: %v", err)
+		abortWithError(c, apierr.New(apierr.Internal))
+	}
+}
+
+// createCampaignHandler 创建秒杀活动 (开始/结束由 Temporal Schedule 触发)
+func createCampaignHandler(campaigns *app.CampaignService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name         string    `json:"name"`
+			StartAt      time.Time `json:"start_at"`
+			EndAt        time.Time `json:"end_at"`
+			PerUserLimit int       `json:"per_user_limit"`
+			Allocations  []struct {
+				SKU       string `json:"sku"`
+				Quantity  int    `json:"quantity"`
+				SalePrice int    `json:"sale_price"`
+			} `json:"allocations"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+
+		campaign := app.Campaign{Name: req.Name, StartAt: req.StartAt, EndAt: req.EndAt, PerUserLimit: req.PerUserLimit}
+		for _, a := range req.Allocations {
+			campaign.Allocations = append(campaign.Allocations, app.CampaignAllocation{SKU: a.SKU, Quantity: a.Quantity, SalePrice: a.SalePrice})
+		}
+		created, err := campaigns.Create(c.Request.Context(), campaign, time.Now())
+		if err != nil {
+			abortWithCampaignError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, campaignResponse(created))
+	}
+}
+
+// getCampaignHandler 查看活动状态与对账结果
+func getCampaignHandler(campaigns *app.CampaignService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaign, err := campaigns.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			abortWithCampaignError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, campaignResponse(campaign))
+	}
+}
+
+// pauseCampaignHandler 暂停活动，漏斗立即拒绝新请求
+func pauseCampaignHandler(campaigns *app.CampaignService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaign, err := campaigns.Pause(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			abortWithCampaignError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, campaignResponse(campaign))
+	}
+}
+
+// resumeCampaignHandler 恢复已暂停的活动
+func resumeCampaignHandler(campaigns *app.CampaignService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		campaign, err := campaigns.Resume(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			abortWithCampaignError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, campaignResponse(campaign))
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/store"
+)
+
+// degradeMode Redis 熔断期间某个 SKU 的下单策略
+type degradeMode string
+
+const (
+	degradeReject degradeMode = "reject" // 直接返回 SERVICE_DEGRADED (默认)
+	degradeMySQL  degradeMode = "mysql"  // 跳过 Redis 漏斗直接启动 Workflow，由 MySQL 悲观锁扣减库存，严格限制并发
+	degradeQueue  degradeMode = "queue"  // 排队等待 Redis 恢复，超时返回 SERVICE_DEGRADED
+)
+
+// 降级处理结果，result: accepted / rejected / timeout
+var degradedOrders = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "omniflow_order_degraded_total",
+	Help: "Redis 熔断期间按降级策略处理的下单请求数",
+}, []string{"mode", "result"})
+
+// degradePolicy Redis 熔断时的降级策略
+type degradePolicy struct {
+	breaker *store.Breaker
+	def     degradeMode
+	skus    map[string]degradeMode
+
+	mysqlSlots chan struct{} // MySQL 直连下单的并发上限
+	queueSlots chan struct{} // 排队请求数上限
+	queueWait  time.Duration // 单个请求最长排队时间
+}
+
+// loadDegradePolicy 读取降级配置
+// REDIS_FALLBACK 默认策略 (reject/mysql/queue)，REDIS_FALLBACK_SKUS 按 SKU 覆盖 ("iPhone15=queue,Cable=mysql")
+// REDIS_FALLBACK_MYSQL_CONCURRENCY / REDIS_FALLBACK_QUEUE_SIZE / REDIS_FALLBACK_QUEUE_WAIT 控制并发、队列长度与排队时间
+func loadDegradePolicy(breaker *store.Breaker) *degradePolicy {
+	p := &degradePolicy{
+		breaker:    breaker,
+		def:        degradeReject,
+		skus:       make(map[string]degradeMode),
+		mysqlSlots: make(chan struct{}, envInt("REDIS_FALLBACK_MYSQL_CONCURRENCY", 8)),
+		queueSlots: make(chan struct{}, envInt("REDIS_FALLBACK_QUEUE_SIZE", 1000)),
+		queueWait:  envDuration("REDIS_FALLBACK_QUEUE_WAIT", 2*time.Second),
+	}
+	if v := os.Getenv("REDIS_FALLBACK"); v != "" {
+		if mode, ok := parseDegradeMode(v); ok {
+			p.def = mode
+		} else {
+			log.Printf("⚠️ REDIS_FALLBACK 配置无效 (%s)，使用默认值 %s", v, p.def)
+		}
+	}
+	if v := os.Getenv("REDIS_FALLBACK_SKUS"); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			sku, m, _ := strings.Cut(strings.TrimSpace(part), "=")
+			mode, ok := parseDegradeMode(m)
+			if sku == "" || !ok {
+				log.Printf("⚠️ REDIS_FALLBACK_SKUS 配置无效 (%s)，已忽略", part)
+				continue
+			}
+			p.skus[sku] = mode
+		}
+	}
+	return p
+}
+
+func parseDegradeMode(v string) (degradeMode, bool) {
+	switch mode := degradeMode(strings.ToLower(strings.TrimSpace(v))); mode {
+	case degradeReject, degradeMySQL, degradeQueue:
+		return mode, true
+	}
+	return "", false
+}
+
+// envInt 读取正整数环境变量，未配置或无效时使用默认值
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Printf("⚠️ %s 配置无效 (%s)，使用默认值 %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+// tripped Redis 是否处于熔断 (冷却结束后的探测请求照常走漏斗)
+func (p *degradePolicy) tripped() bool {
+	return p.breaker.State() == store.BreakerOpen
+}
+
+func (p *degradePolicy) mode(sku string) degradeMode {
+	if mode, ok := p.skus[sku]; ok {
+		return mode
+	}
+	return p.def
+}
+
+// queue 排队等待 Redis 恢复；队列已满或等待超时返回 false
+func (p *degradePolicy) queue(ctx context.Context) bool {
+	select {
+	case p.queueSlots <- struct{}{}:
+		defer func() { <-p.queueSlots }()
+	default:
+		degradedOrders.WithLabelValues(string(degradeQueue), "rejected").Inc()
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.queueWait)
+	defer cancel()
+	if err := p.breaker.Wait(ctx); err != nil {
+		degradedOrders.WithLabelValues(string(degradeQueue), "timeout").Inc()
+		return false
+	}
+	degradedOrders.WithLabelValues(string(degradeQueue), "accepted").Inc()
+	return true
+}
+
+// storeError Redis 调用失败：熔断返回 SERVICE_DEGRADED，其他错误返回 INTERNAL
+func storeError(err error) *apierr.Error {
+	if errors.Is(err, store.ErrCircuitOpen) {
+		return apierr.New(apierr.ServiceDegraded)
+	}
+	log.Printf("Redis 错误: %v", err)
+	return apierr.New(apierr.Internal)
+}
+
+// createOrderWithoutRedis MySQL 降级下单：不经过 Redis 漏斗，直接启动订单 Workflow，由 ReserveInventory 的 MySQL 悲观锁保证不超卖
+// 活动售价与限购计数都在 Redis 中，降级时无法校验：SKU 属于未结束的活动时拒绝，只放行普通商品
+// 并发超过上限立即拒绝；幂等依赖固定的 Workflow ID (REJECT_DUPLICATE)
+func (p *degradePolicy) createOrderWithoutRedis(ctx context.Context, temporalClient client.Client, campaigns *app.CampaignService, req createOrderRequest, idemKey string, reviewPolicy common.ReviewPolicy) orderOutcome {
+	select {
+	case p.mysqlSlots <- struct{}{}:
+		defer func() { <-p.mysqlSlots }()
+	default:
+		degradedOrders.WithLabelValues(string(degradeMySQL), "rejected").Inc()
+		return failed(apierr.New(apierr.ServiceDegraded))
+	}
+
+	inCampaign, err := campaigns.HasOpenCampaign(ctx, req.Items[0])
+	if err != nil {
+		log.Printf("活动查询失败: %v", err)
+		return failed(apierr.New(apierr.Internal))
+	}
+	if inCampaign {
+		degradedOrders.WithLabelValues(string(degradeMySQL), "rejected").Inc()
+		return failed(apierr.New(apierr.ServiceDegraded))
+	}
+
+	workflowID := "ORDER-" + uuid.New().String()
+	if idemKey != "" {
+		if !validIdempotencyKey(idemKey) {
+			return failed(apierr.Invalid(idempotencyHeader))
+		}
+		workflowID = idempotentWorkflowID(req.CustomerID, idemKey)
+	}
+	order := common.Order{
+		OrderID:         workflowID,
+		Amount:          req.Amount,
+		Items:           req.Items,
+		CustomerID:      req.CustomerID,
+		ShippingAddress: req.ShippingAddress,
+		BillingAddress:  req.BillingAddress,
+		ReviewPolicy:    &reviewPolicy,
+	}
+
+	we, err := temporalClient.ExecuteWorkflow(ctx, app.OrderWorkflowOptions(workflowID), app.OrderFulfillmentWorkflow, order)
+	var alreadyStarted *serviceerror.WorkflowExecutionAlreadyStarted
+	if errors.As(err, &alreadyStarted) {
+		outcome := succeeded(createdResponse(workflowID, alreadyStarted.RunId))
+		outcome.Replayed = true
+		return outcome
+	}
+	if err != nil {
+		log.Printf("Workflow 启动失败: %v", err)
+		return failed(apierr.New(apierr.Internal))
+	}
+	degradedOrders.WithLabelValues(string(degradeMySQL), "accepted").Inc()
+	return succeeded(createdResponse(workflowID, we.GetRunID()))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/mocks"
+
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+)
+
+func TestDegrade_Reject(t *testing.T) {
+	env := newTestEnv(t)
+	env.preheat(t, "iPhone15", 5)
+	env.tripBreaker(t)
+
+	out := env.funnel.place(context.Background(), createOrderRequest{Amount: 100, Items: []string{"iPhone15"}, CustomerID: "C1"}, "")
+	require.NotNil(t, out.Err)
+	assert.Equal(t, apierr.ServiceDegraded, out.Err.Code)
+	assert.Equal(t, 0, env.admission.Stats().Depth, "熔断期间不进入漏斗")
+}
+
+func TestDegrade_Queue(t *testing.T) {
+	ctx := context.Background()
+	req := createOrderRequest{Amount: 100, Items: []string{"iPhone15"}, CustomerID: "C1"}
+
+	t.Run("恢复后照常下单", func(t *testing.T) {
+		env := newTestEnvWithBreaker(t, 100*time.Millisecond)
+		env.preheat(t, "iPhone15", 5)
+		env.funnel.degrade.def = degradeQueue
+		env.tripBreaker(t)
+
+		out := env.funnel.place(ctx, req, "")
+		require.Nil(t, out.Err)
+		assert.Equal(t, http.StatusAccepted, out.Status)
+		assert.Equal(t, 4, env.stock(t, "iPhone15"))
+	})
+
+	t.Run("等待超时", func(t *testing.T) {
+		env := newTestEnv(t)
+		env.funnel.degrade.def = degradeQueue
+		env.funnel.degrade.queueWait = 20 * time.Millisecond
+		env.tripBreaker(t)
+
+		out := env.funnel.place(ctx, req, "")
+		require.NotNil(t, out.Err)
+		assert.Equal(t, apierr.ServiceDegraded, out.Err.Code)
+	})
+
+	t.Run("队列已满", func(t *testing.T) {
+		env := newTestEnv(t)
+		env.funnel.degrade.def = degradeQueue
+		env.tripBreaker(t)
+		env.funnel.degrade.queueSlots <- struct{}{}
+
+		start := time.Now()
+		out := env.funnel.place(ctx, req, "")
+		require.NotNil(t, out.Err)
+		assert.Equal(t, apierr.ServiceDegraded, out.Err.Code)
+		assert.Less(t, time.Since(start), env.funnel.degrade.queueWait, "队列满时立即拒绝，不排队")
+	})
+}
+
+func TestDegrade_MySQL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("普通商品直接启动 Workflow", func(t *testing.T) {
+		env := newTestEnv(t)
+		env.funnel.degrade.def = degradeMySQL
+		env.tripBreaker(t)
+
+		run := &mocks.WorkflowRun{}
+		run.On("GetRunID").Return("RUN-1")
+		env.client.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(func(o common.Order) bool {
+			return o.CustomerID == "C1" && o.Amount == 100 && o.ReviewPolicy != nil
+		})).Return(run, nil).Once()
+
+		out := env.funnel.place(ctx, createOrderRequest{Amount: 100, Items: []string{"Cable"}, CustomerID: "C1"}, "")
+		require.Nil(t, out.Err)
+		assert.Equal(t, http.StatusOK, out.Status)
+		assert.Contains(t, string(out.Body), "RUN-1")
+		assert.Equal(t, 0, env.admission.Stats().Depth, "不经过准入队列")
+		env.client.AssertExpectations(t)
+	})
+
+	t.Run("活动商品拒绝", func(t *testing.T) {
+		// 活动售价与限购在 Redis 中，降级时无法校验
+		env := newTestEnv(t)
+		env.funnel.degrade.def = degradeMySQL
+		require.NoError(t, env.db.Create(&app.Campaign{
+			ID:          "CAMP-1",
+			State:       app.CampaignLive,
+			Allocations: []app.CampaignAllocation{{SKU: "iPhone15", Quantity: 10, SalePrice: 50}},
+		}).Error)
+		require.NoError(t, env.db.Create(&app.Campaign{
+			ID:          "CAMP-0",
+			State:       app.CampaignEnded,
+			Allocations: []app.CampaignAllocation{{SKU: "Cable", Quantity: 10, SalePrice: 5}},
+		}).Error)
+		env.tripBreaker(t)
+
+		out := env.funnel.place(ctx, createOrderRequest{Amount: 100, Items: []string{"iPhone15"}, CustomerID: "C1"}, "")
+		require.NotNil(t, out.Err)
+		assert.Equal(t, apierr.ServiceDegraded, out.Err.Code)
+		env.client.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		// 已结束的活动不影响
+		run := &mocks.WorkflowRun{}
+		run.On("GetRunID").Return("RUN-2")
+		env.client.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(run, nil).Once()
+		out = env.funnel.place(ctx, createOrderRequest{Amount: 100, Items: []string{"Cable"}, CustomerID: "C1"}, "")
+		require.Nil(t, out.Err)
+		env.client.AssertExpectations(t)
+	})
+
+	t.Run("并发已满", func(t *testing.T) {
+		env := newTestEnv(t)
+		env.funnel.degrade.def = degradeMySQL
+		env.tripBreaker(t)
+		env.funnel.degrade.mysqlSlots <- struct{}{}
+
+		out := env.funnel.place(ctx, createOrderRequest{Amount: 100, Items: []string{"Cable"}, CustomerID: "C1"}, "")
+		require.NotNil(t, out.Err)
+		assert.Equal(t, apierr.ServiceDegraded, out.Err.Code)
+		env.client.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestDegrade_PerSKUOverride(t *testing.T) {
+	env := newTestEnv(t)
+	env.funnel.degrade.skus["Cable"] = degradeMySQL
+	env.tripBreaker(t)
+
+	run := &mocks.WorkflowRun{}
+	run.On("GetRunID").Return("RUN-1")
+	env.client.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(run, nil).Once()
+
+	// 按 SKU 覆盖：Cable 走 MySQL，其余按默认策略拒绝
+	out := env.funnel.place(context.Background(), createOrderRequest{Amount: 100, Items: []string{"Cable"}, CustomerID: "C1"}, "")
+	require.Nil(t, out.Err)
+	out = env.funnel.place(context.Background(), createOrderRequest{Amount: 100, Items: []string{"iPhone15"}, CustomerID: "C1"}, "")
+	require.NotNil(t, out.Err)
+	assert.Equal(t, apierr.ServiceDegraded, out.Err.Code)
+	env.client.AssertExpectations(t)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"omniflow/internal/pkg/apierr"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// requestIDMiddleware 透传调用方的 X-Request-ID，没有则生成一个，并写回响应头
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// abortWithError 按统一格式返回错误，文案语言由 Accept-Language 决定
+//
+//	{"code": "OUT_OF_STOCK", "message": "...", "request_id": "...", "field": "...", "detail": "..."}
+func abortWithError(c *gin.Context, err *apierr.Error) {
+	body := gin.H{
+		"code":       err.Code,
+		"message":    err.Message(apierr.ParseAcceptLanguage(c.GetHeader("Accept-Language"))),
+		"request_id": c.GetString(requestIDKey),
+	}
+	if err.Field != "" {
+		body["field"] = err.Field
+	}
+	if err.Detail != "" {
+		body["detail"] = err.Detail
+	}
+	c.AbortWithStatusJSON(err.HTTPStatus(), body)
+}
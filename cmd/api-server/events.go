@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"go.temporal.io/sdk/client"
+	"gorm.io/gorm"
+
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+	"omniflow/internal/pkg/pubsub"
+)
+
+// eventsOptions 订单状态推送 (ORDER_EVENTS_HEARTBEAT / ORDER_EVENTS_MAX_DURATION)
+type eventsOptions struct {
+	Heartbeat   time.Duration // 空闲时发送注释行，防止代理断开空闲连接
+	MaxDuration time.Duration // 单个连接的最长时间，到期后客户端带 Last-Event-ID 重连
+}
+
+func eventsOptionsFromEnv() eventsOptions {
+	return eventsOptions{
+		Heartbeat:   envDuration("ORDER_EVENTS_HEARTBEAT", 15*time.Second),
+		MaxDuration: envDuration("ORDER_EVENTS_MAX_DURATION", 10*time.Minute),
+	}
+}
+
+// errNotOrderOwner 订阅了别人的订单 (订阅时读模型尚未写入，无法提前拒绝)
+var errNotOrderOwner = errors.New("订单不属于当前客户")
+
+// orderStream 一个 SSE 连接：按序号推送，已推送过的序号不再重复
+type orderStream struct {
+	c        *gin.Context
+	db       *gorm.DB
+	orderID  string
+	lastSeq  int
+	customer string // 非空时需要校验消息中的客户 (读模型尚未写入时无法提前校验)
+}
+
+// send 推送一次状态流转，返回订单是否已到终态
+func (s *orderStream) send(msg app.OrderEventMessage) bool {
+	msg.CustomerID = ""
+	s.c.Render(-1, sse.Event{Id: strconv.Itoa(msg.Seq), Event: "status", Data: msg})
+	s.c.Writer.Flush()
+	s.lastSeq = msg.Seq
+	return common.OrderState(msg.Status).IsFinal()
+}
+
+// backfill 从 order_events 补齐 lastSeq 之后的流转 (重连或漏收消息时)
+func (s *orderStream) backfill() (final bool, err error) {
+	var events []app.OrderEventRecord
+	if err := s.db.WithContext(s.c.Request.Context()).
+		Where("order_id = ? AND seq > ?", s.orderID, s.lastSeq).Order("seq").Find(&events).Error; err != nil {
+		return false, err
+	}
+	if len(events) > 0 && s.customer != "" {
+		// 订阅时读模型尚未写入：补发前再校验一次归属
+		var record app.OrderRecord
+		if err := s.db.WithContext(s.c.Request.Context()).Select("customer_id").First(&record, "order_id = ?", s.orderID).Error; err != nil {
+			return false, err
+		}
+		if record.CustomerID != s.customer {
+			return false, errNotOrderOwner
+		}
+		s.customer = ""
+	}
+	for _, e := range events {
+		if s.send(app.OrderEventMessage{OrderID: e.OrderID, Seq: e.Seq, Status: e.Status, Label: e.StatusLabel, Reason: e.Reason, OccurredAt: e.OccurredAt}) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// orderEventsHandler 订单状态流转的 SSE 推送 (event: status，id 为事件序号)
+// 先订阅再从读模型补齐，避免两者之间的流转丢失；推送按序号去重，发现跳号时再从读模型补齐
+// 订单到终态后关闭连接；客户端断线重连时带 Last-Event-ID，只补发之后的流转
+func orderEventsHandler(db *gorm.DB, temporalClient client.Client, bus pubsub.Bus, opt eventsOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID := c.Param("id")
+		sub := bus.Subscribe(app.OrderEventsTopic(orderID))
+		defer sub.Close()
+
+		stream := &orderStream{c: c, db: db, orderID: orderID}
+		if id, err := strconv.Atoi(c.GetHeader("Last-Event-ID")); err == nil && id > 0 {
+			stream.lastSeq = id
+		}
+
+		// 归属校验：与 requireOrderOwner 一致，别人的订单返回 404
+		// 读模型没有记录时以 Workflow 启动参数为准；订单还在准入队列中 (Workflow 未启动) 时允许订阅，
+		// 由推送消息中的客户 ID 校验
+		if !isStaff(c) {
+			customer := auth.FromContext(c).CustomerID()
+			if customer == "" {
+				abortWithError(c, apierr.New(apierr.Forbidden))
+				return
+			}
+			var record app.OrderRecord
+			err := db.WithContext(c.Request.Context()).Select("customer_id").First(&record, "order_id = ?", orderID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				record.CustomerID, err = app.OrderCustomer(c.Request.Context(), temporalClient, orderID)
+			}
+			switch {
+			case errors.Is(err, app.ErrOrderNotStarted):
+				stream.customer = customer
+			case err != nil:
+				abortWithError(c, apierr.New(apierr.Internal))
+				return
+			case record.CustomerID != customer:
+				abortWithError(c, apierr.New(apierr.NotFound))
+				return
+			}
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // 关闭 Nginx 缓冲
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		if final, err := stream.backfill(); err != nil {
+			log.Printf("⚠️ 订单事件补齐失败 %s: %v", orderID, err)
+			return
+		} else if final {
+			return
+		}
+
+		heartbeat := time.NewTicker(opt.Heartbeat)
+		defer heartbeat.Stop()
+		deadline := time.NewTimer(opt.MaxDuration)
+		defer deadline.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-deadline.C:
+				return
+			case <-heartbeat.C:
+				_, _ = c.Writer.WriteString(": keep-alive\n\n")
+				c.Writer.Flush()
+			case data, ok := <-sub.C:
+				if !ok {
+					// 消费太慢被断开：客户端带 Last-Event-ID 重连补齐
+					return
+				}
+				var msg app.OrderEventMessage
+				if err := json.Unmarshal(data, &msg); err != nil {
+					continue
+				}
+				if stream.customer != "" {
+					if msg.CustomerID != stream.customer {
+						return
+					}
+					stream.customer = ""
+				}
+				if msg.Seq <= stream.lastSeq {
+					continue
+				}
+				if msg.Seq > stream.lastSeq+1 {
+					// 跳号 (漏收或乱序)：先从读模型补齐，投影在推送前已提交
+					final, err := stream.backfill()
+					if err != nil {
+						log.Printf("⚠️ 订单事件补齐失败 %s: %v", orderID, err)
+						return
+					}
+					if final {
+						return
+					}
+					if msg.Seq <= stream.lastSeq {
+						continue
+					}
+				}
+				if stream.send(msg) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/mocks"
+
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/pubsub"
+)
+
+// sseEvent 客户端收到的一条 SSE 事件
+type sseEvent struct {
+	ID   int
+	Data app.OrderEventMessage
+	Raw  string
+}
+
+// openStream 订阅订单推送，事件按到达顺序写入返回的 channel，连接关闭时关闭 channel
+func openStream(t *testing.T, srv *httptest.Server, orderID, token string, lastEventID int) (*http.Response, <-chan sseEvent) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/v1/orders/"+orderID+"/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.Itoa(lastEventID))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id:"):
+				ev.ID, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "id:")))
+			case strings.HasPrefix(line, "data:"):
+				ev.Raw = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+				_ = json.Unmarshal([]byte(ev.Raw), &ev.Data)
+			case line == "" && ev.ID > 0:
+				events <- ev
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return resp, events
+}
+
+// collect 读到连接关闭为止的全部事件序号
+func collect(t *testing.T, events <-chan sseEvent) []sseEvent {
+	t.Helper()
+	var got []sseEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return got
+			}
+			got = append(got, ev)
+		case <-timeout:
+			t.Fatal("等待推送超时")
+			return got
+		}
+	}
+}
+
+func ids(events []sseEvent) []int {
+	out := make([]int, 0, len(events))
+	for _, e := range events {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func publish(t *testing.T, bus pubsub.Bus, msg app.OrderEventMessage) {
+	t.Helper()
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+	require.NoError(t, bus.Publish(context.Background(), app.OrderEventsTopic(msg.OrderID), data))
+}
+
+// waitSubscribed 等 handler 订阅 (之后发布的消息不会丢)
+func waitSubscribed(t *testing.T, bus *pubsub.Memory, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return bus.Subscribers() == n }, 2*time.Second, 5*time.Millisecond)
+}
+
+func eventsServer(t *testing.T, env *testEnv, bus pubsub.Bus) *httptest.Server {
+	r := gin.New()
+	r.Use(authMiddleware(env.verifier))
+	r.GET("/api/v1/orders/:id/events", orderEventsHandler(env.db, env.client, bus, eventsOptions{Heartbeat: time.Hour, MaxDuration: 5 * time.Second}))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOrderEvents_BackfillThenLive(t *testing.T) {
+	env := newTestEnv(t)
+	bus := pubsub.NewMemory()
+	srv := eventsServer(t, env, bus)
+
+	now := time.Now()
+	require.NoError(t, env.db.Create(&app.OrderRecord{OrderID: "O1", CustomerID: "C1", Status: string(common.StatePendingPayment)}).Error)
+	require.NoError(t, env.db.Create([]app.OrderEventRecord{
+		{OrderID: "O1", Seq: 1, Status: string(common.StateRiskCheck), OccurredAt: now},
+		{OrderID: "O1", Seq: 2, Status: string(common.StatePendingPayment), OccurredAt: now},
+	}).Error)
+
+	// 1. 别人的订单返回 404，不订阅
+	resp, _ := openStream(t, srv, "O1", env.token(t, "C2", "customer"), 0)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, 0, bus.Subscribers())
+
+	// 2. 先补齐读模型中的流转，再推送实时消息
+	resp, events := openStream(t, srv, "O1", env.token(t, "C1", "customer"), 0)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	waitSubscribed(t, bus, 1)
+
+	// 与补齐重叠的序号与重复消息不再推送；跳号时从读模型补齐 (投影在推送前已提交)
+	publish(t, bus, app.OrderEventMessage{OrderID: "O1", CustomerID: "C1", Seq: 2, Status: string(common.StatePendingPayment)})
+	publish(t, bus, app.OrderEventMessage{OrderID: "O1", CustomerID: "C1", Seq: 3, Status: string(common.StateShipping)})
+	publish(t, bus, app.OrderEventMessage{OrderID: "O1", CustomerID: "C1", Seq: 3, Status: string(common.StateShipping)})
+	require.NoError(t, env.db.Create(&app.OrderEventRecord{OrderID: "O1", Seq: 4, Status: string(common.StateShipping), Reason: "包裹已发出", OccurredAt: now}).Error)
+	publish(t, bus, app.OrderEventMessage{OrderID: "O1", CustomerID: "C1", Seq: 5, Status: string(common.StateCompleted)})
+
+	// 终态后服务端关闭连接
+	got := collect(t, events)
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, ids(got))
+	assert.Equal(t, "包裹已发出", got[3].Data.Reason)
+	for _, ev := range got {
+		assert.NotContains(t, ev.Raw, "customer_id", "推送给客户端前清空客户 ID")
+	}
+	waitSubscribed(t, bus, 0)
+
+	// 3. 重连带 Last-Event-ID：只补发之后的流转
+	resp, events = openStream(t, srv, "O1", env.token(t, "C1", "customer"), 3)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	waitSubscribed(t, bus, 1)
+	publish(t, bus, app.OrderEventMessage{OrderID: "O1", CustomerID: "C1", Seq: 5, Status: string(common.StateCompleted)})
+	assert.Equal(t, []int{4, 5}, ids(collect(t, events)))
+}
+
+func TestOrderEvents_OwnerCheckBeforeWorkflowStarts(t *testing.T) {
+	env := newTestEnv(t)
+	bus := pubsub.NewMemory()
+	srv := eventsServer(t, env, bus)
+
+	// 订单还在准入队列中：读模型与 Workflow 都没有，允许订阅，按推送消息中的客户校验
+	notStarted := &mocks.HistoryEventIterator{}
+	notStarted.On("HasNext").Return(false)
+	env.client.On("GetWorkflowHistory", mock.Anything, mock.Anything, "", false, mock.Anything).Return(notStarted)
+
+	resp, events := openStream(t, srv, "QUEUED", env.token(t, "C1", "customer"), 0)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	waitSubscribed(t, bus, 1)
+	publish(t, bus, app.OrderEventMessage{OrderID: "QUEUED", CustomerID: "C9", Seq: 1, Status: string(common.StateReserving)})
+	assert.Empty(t, collect(t, events), "别人的订单：不推送并断开")
+
+	resp, events = openStream(t, srv, "QUEUED", env.token(t, "C9", "customer"), 0)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	waitSubscribed(t, bus, 1)
+	publish(t, bus, app.OrderEventMessage{OrderID: "QUEUED", CustomerID: "C9", Seq: 1, Status: string(common.StateReserving)})
+	publish(t, bus, app.OrderEventMessage{OrderID: "QUEUED", CustomerID: "C9", Seq: 2, Status: string(common.StateFailed)})
+	assert.Equal(t, []int{1, 2}, ids(collect(t, events)))
+}
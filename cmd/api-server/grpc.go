@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"go.temporal.io/sdk/client"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+
+	orderv1 "omniflow/api/order/v1"
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+)
+
+// orderServer gRPC 订单服务 (api/order/v1/order.proto)
+// 与 HTTP 接口共用下单漏斗、读模型查询、Update 与错误码，行为保持一致
+type orderServer struct {
+	orderv1.UnimplementedOrderServiceServer
+	funnel *orderFunnel
+	db     *gorm.DB
+	client client.Client
+}
+
+// newGRPCServer 创建 gRPC 服务并注册订单服务
+// 拦截器顺序：请求 ID -> 日志 -> 指标 -> 鉴权 -> 限流，鉴权失败与限流也会记录日志与指标；
+// 与 HTTP 一样先鉴权再限流，按客户限流才能使用 Token 中的客户 ID
+func newGRPCServer(v *auth.Verifier, rateLimit grpc.UnaryServerInterceptor, srv *orderServer) *grpc.Server {
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		requestIDInterceptor,
+		loggingInterceptor,
+		metricsInterceptor,
+		authInterceptor(v),
+		rateLimit,
+	))
+	orderv1.RegisterOrderServiceServer(s, srv)
+	reflection.Register(s)
+	return s
+}
+
+// serveGRPC 在 GRPC_ADDR (默认 :9000) 上启动 gRPC 服务
+func serveGRPC(s *grpc.Server) {
+	addr := os.Getenv("GRPC_ADDR")
+	if addr == "" {
+		addr = ":9000"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalln("gRPC 监听失败:", err)
+	}
+
+	log.Printf("🚀 gRPC Server 监听 %s", addr)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalln("gRPC 服务退出:", err)
+	}
+}
+
+// 错误码 -> gRPC 状态码，未列出的按 INTERNAL 处理
+var grpcCodes = map[apierr.Code]codes.Code{
+	apierr.OutOfStock:         codes.ResourceExhausted,
+	apierr.NotInFlashSale:     codes.FailedPrecondition,
+	apierr.LimitReached:       codes.ResourceExhausted,
+	apierr.RateLimited:        codes.ResourceExhausted,
+	apierr.InvalidRequest:     codes.InvalidArgument,
+	apierr.NotFound:           codes.NotFound,
+	apierr.OrderNotModifiable: codes.FailedPrecondition,
+	apierr.IdempotencyReused:  codes.AlreadyExists,
+	apierr.RequestInProgress:  codes.Aborted,
+	apierr.CampaignNotLive:    codes.FailedPrecondition,
+	apierr.ServiceDegraded:    codes.Unavailable,
+	apierr.QueueFull:          codes.Unavailable,
+	apierr.Unauthorized:       codes.Unauthenticated,
+	apierr.Forbidden:          codes.PermissionDenied,
+	apierr.Internal:           codes.Internal,
+}
+
+// grpcError 按统一格式返回错误：文案语言由 metadata accept-language 决定，
+// ErrorInfo.reason 为 HTTP API 的错误码，metadata 中带 request_id / field / detail
+func grpcError(ctx context.Context, err *apierr.Error, retryAfter time.Duration) error {
+	code, ok := grpcCodes[err.Code]
+	if !ok {
+		code = codes.Internal
+	}
+	info := &errdetails.ErrorInfo{
+		Reason:   string(err.Code),
+		Domain:   "omniflow",
+		Metadata: map[string]string{"request_id": requestIDFromContext(ctx)},
+	}
+	if err.Field != "" {
+		info.Metadata["field"] = err.Field
+	}
+	if err.Detail != "" {
+		info.Metadata["detail"] = err.Detail
+	}
+
+	st := status.New(code, err.Message(apierr.ParseAcceptLanguage(incomingHeader(ctx, "accept-language"))))
+	withDetails, e := st.WithDetails(info)
+	if e == nil && retryAfter > 0 {
+		withDetails, e = withDetails.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	}
+	if e != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// incomingHeader 请求 metadata 中的单个值
+func incomingHeader(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func addressFromProto(a *orderv1.Address) *common.Address {
+	if a == nil {
+		return nil
+	}
+	return &common.Address{Country: a.GetCountry(), Province: a.GetProvince(), City: a.GetCity(), Detail: a.GetDetail()}
+}
+
+func addressToProto(a *common.Address) *orderv1.Address {
+	if a == nil {
+		return nil
+	}
+	return &orderv1.Address{Country: a.Country, Province: a.Province, City: a.City, Detail: a.Detail}
+}
+
+// timestampOrNil 零值时间不返回 (搜索属性缺失)
+func timestampOrNil(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// CreateOrder 秒杀下单，与 POST /api/v1/orders 走同一个漏斗；幂等 Key 与 HTTP 共用
+func (s *orderServer) CreateOrder(ctx context.Context, req *orderv1.CreateOrderRequest) (*orderv1.CreateOrderResponse, error) {
+	outcome := s.funnel.place(ctx, createOrderRequest{
+		Amount:          int(req.GetAmount()),
+		Items:           req.GetItems(),
+		CustomerID:      auth.ClaimsFromContext(ctx).CustomerID(),
+		ShippingAddress: addressFromProto(req.GetShippingAddress()),
+		BillingAddress:  addressFromProto(req.GetBillingAddress()),
+	}, req.GetIdempotencyKey())
+	if outcome.Err != nil {
+		if outcome.RetryAfter > 0 {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(outcome.RetryAfter.Seconds()))))
+		}
+		return nil, grpcError(ctx, outcome.Err, outcome.RetryAfter)
+	}
+
+	// 响应体与 HTTP 相同 (幂等回放时为首次请求保存的响应)
+	var body struct {
+		OrderID string `json:"order_id"`
+		RunID   string `json:"run_id"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(outcome.Body, &body); err != nil {
+		log.Printf("下单响应解析失败: %v", err)
+		return nil, grpcError(ctx, apierr.New(apierr.Internal), 0)
+	}
+	return &orderv1.CreateOrderResponse{
+		OrderId:  body.OrderID,
+		RunId:    body.RunID,
+		Status:   body.Status,
+		Message:  body.Message,
+		Replayed: outcome.Replayed,
+	}, nil
+}
+
+// GetOrder 订单详情，与 GET /api/v1/orders/:id 相同
+func (s *orderServer) GetOrder(ctx context.Context, req *orderv1.GetOrderRequest) (*orderv1.Order, error) {
+	if err := checkOrderOwner(ctx, s.db, s.client, auth.ClaimsFromContext(ctx), req.GetOrderId()); err != nil {
+		return nil, grpcError(ctx, err, 0)
+	}
+	d, err := loadOrder(ctx, s.db, req.GetOrderId())
+	if err != nil {
+		return nil, grpcError(ctx, err, 0)
+	}
+	lines := make([]*orderv1.OrderLine, 0, len(d.Lines))
+	for _, l := range d.Lines {
+		lines = append(lines, &orderv1.OrderLine{Sku: l.SKU, Quantity: int32(l.Quantity)})
+	}
+	return &orderv1.Order{
+		OrderId:         d.Record.OrderID,
+		CustomerId:      d.Record.CustomerID,
+		Campaign:        d.Record.Campaign,
+		Amount:          int64(d.Record.Amount),
+		Status:          d.Record.Status,
+		StatusLabel:     d.Record.StatusLabel,
+		ShippingAddress: addressToProto(d.ShippingAddress),
+		Lines:           lines,
+		CreatedAt:       timestamppb.New(d.Record.CreatedAt),
+		UpdatedAt:       timestamppb.New(d.Record.UpdatedAt),
+	}, nil
+}
+
+// ListOrders 订单列表，与 GET /api/v1/orders 相同
+func (s *orderServer) ListOrders(ctx context.Context, req *orderv1.ListOrdersRequest) (*orderv1.ListOrdersResponse, error) {
+	filter := app.OrderListFilter{Status: req.GetStatus(), CustomerID: req.GetCustomerId()}
+	if req.From != nil {
+		if err := req.From.CheckValid(); err != nil {
+			return nil, grpcError(ctx, apierr.Invalid("from"), 0)
+		}
+		filter.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		if err := req.To.CheckValid(); err != nil {
+			return nil, grpcError(ctx, apierr.Invalid("to"), 0)
+		}
+		filter.To = req.To.AsTime()
+	}
+	if req.StaleFor != nil {
+		if err := req.StaleFor.CheckValid(); err != nil {
+			return nil, grpcError(ctx, apierr.Invalid("stale_for"), 0)
+		}
+		filter.StaleFor = req.StaleFor.AsDuration()
+	}
+
+	orders, next, err := listOrders(ctx, s.client, auth.ClaimsFromContext(ctx), filter, int(req.GetPageSize()), req.GetPageToken())
+	if err != nil {
+		return nil, grpcError(ctx, err, 0)
+	}
+	resp := &orderv1.ListOrdersResponse{Orders: make([]*orderv1.OrderSummary, 0, len(orders)), NextPageToken: next}
+	for _, o := range orders {
+		resp.Orders = append(resp.Orders, &orderv1.OrderSummary{
+			OrderId:         o.OrderID,
+			RunId:           o.RunID,
+			WorkflowStatus:  o.WorkflowStatus,
+			Status:          o.Status,
+			CustomerId:      o.CustomerID,
+			Amount:          o.Amount,
+			Campaign:        o.Campaign,
+			Skus:            o.SKUs,
+			StatusChangedAt: timestampOrNil(o.StatusChangedAt),
+			StartTime:       timestampOrNil(o.StartTime),
+		})
+	}
+	return resp, nil
+}
+
+// PayOrder 支付，与 POST /api/v1/orders/:id/pay 相同
+func (s *orderServer) PayOrder(ctx context.Context, req *orderv1.PayOrderRequest) (*orderv1.PayOrderResponse, error) {
+	if err := checkOrderOwner(ctx, s.db, s.client, auth.ClaimsFromContext(ctx), req.GetOrderId()); err != nil {
+		return nil, grpcError(ctx, err, 0)
+	}
+	if err := payOrder(ctx, s.client, req.GetOrderId(), req.GetPaymentId()); err != nil {
+		return nil, grpcError(ctx, err, 0)
+	}
+	return &orderv1.PayOrderResponse{OrderId: req.GetOrderId()}, nil
+}
+
+// auditActions 枚举 -> Signal 中的审核结果
+var auditActions = map[orderv1.AuditAction]string{
+	orderv1.AuditAction_AUDIT_ACTION_APPROVE: "APPROVE",
+	orderv1.AuditAction_AUDIT_ACTION_REJECT:  "REJECT",
+}
+
+// AuditOrder 提交人工审核结果，与 POST /api/v1/orders/:id/audit 相同
+func (s *orderServer) AuditOrder(ctx context.Context, req *orderv1.AuditOrderRequest) (*orderv1.AuditOrderResponse, error) {
+	if err := submitAudit(ctx, s.client, req.GetOrderId(), auditActions[req.GetAction()]); err != nil {
+		return nil, grpcError(ctx, err, 0)
+	}
+	return &orderv1.AuditOrderResponse{OrderId: req.GetOrderId(), Action: req.GetAction()}, nil
+}
+
+// CancelOrder 取消，与 POST /api/v1/orders/:id/cancel 相同
+func (s *orderServer) CancelOrder(ctx context.Context, req *orderv1.CancelOrderRequest) (*orderv1.CancelOrderResponse, error) {
+	if err := checkOrderOwner(ctx, s.db, s.client, auth.ClaimsFromContext(ctx), req.GetOrderId()); err != nil {
+		return nil, grpcError(ctx, err, 0)
+	}
+	if err := cancelOrder(ctx, s.client, req.GetOrderId(), req.GetReason()); err != nil {
+		return nil, grpcError(ctx, err, 0)
+	}
+	return &orderv1.CancelOrderResponse{OrderId: req.GetOrderId()}, nil
+}
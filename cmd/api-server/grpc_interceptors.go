@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	orderv1 "omniflow/api/order/v1"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+	"omniflow/internal/pkg/ratelimit"
+)
+
+var (
+	grpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "omniflow_grpc_requests_total",
+		Help: "gRPC 请求数，按方法与状态码统计",
+	}, []string{"method", "code"})
+	grpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "omniflow_grpc_request_duration_seconds",
+		Help:    "gRPC 请求耗时",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// grpcMethodRoles 各方法要求的角色 (与 HTTP 路由一致)，未列出的方法只要求登录
+var grpcMethodRoles = map[string][]string{
+	orderv1.OrderService_CreateOrder_FullMethodName: {auth.RoleCustomer},
+	orderv1.OrderService_AuditOrder_FullMethodName:  {auth.RoleReviewer, auth.RoleAdmin},
+}
+
+// grpcRoute gRPC 方法对应的 HTTP 方法与路由模式
+type grpcRoute struct {
+	method string
+	route  string
+}
+
+// grpcRoutes 限流规则按 HTTP 路由配置 (config/ratelimit.yaml)，gRPC 方法按对应的路由套用，两种协议共享同一个桶
+var grpcRoutes = map[string]grpcRoute{
+	orderv1.OrderService_CreateOrder_FullMethodName: {"POST", "/api/v1/orders"},
+	orderv1.OrderService_GetOrder_FullMethodName:    {"GET", "/api/v1/orders/:id"},
+	orderv1.OrderService_ListOrders_FullMethodName:  {"GET", "/api/v1/orders"},
+	orderv1.OrderService_PayOrder_FullMethodName:    {"POST", "/api/v1/orders/:id/pay"},
+	orderv1.OrderService_AuditOrder_FullMethodName:  {"POST", "/api/v1/orders/:id/audit"},
+	orderv1.OrderService_CancelOrder_FullMethodName: {"POST", "/api/v1/orders/:id/cancel"},
+}
+
+// grpcRateLimitKeys 限流维度在 gRPC 请求中的取值 (与 HTTP 的 rateLimitKeys 对应)
+var grpcRateLimitKeys = map[string]func(ctx context.Context, req interface{}) string{
+	// 对端地址 (gRPC 只供内部服务调用，不经过需要信任 X-Forwarded-For 的代理)
+	"ip": func(ctx context.Context, _ interface{}) string {
+		p, ok := peer.FromContext(ctx)
+		if !ok || p.Addr == nil {
+			return ""
+		}
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	},
+	"customer": func(ctx context.Context, _ interface{}) string {
+		if claims := auth.ClaimsFromContext(ctx); claims != nil {
+			return claims.CustomerID()
+		}
+		return ""
+	},
+	// 下单请求的第一个商品 (与漏斗的秒杀判定一致)
+	"sku": func(_ context.Context, req interface{}) string {
+		if r, ok := req.(interface{ GetItems() []string }); ok && len(r.GetItems()) > 0 {
+			return r.GetItems()[0]
+		}
+		return ""
+	},
+}
+
+type requestIDCtxKey struct{}
+
+// requestIDInterceptor 透传调用方 metadata 中的 x-request-id，没有则生成一个，并写回响应 header
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := incomingHeader(ctx, "x-request-id")
+	if id == "" || len(id) > 128 {
+		id = uuid.New().String()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	return handler(context.WithValue(ctx, requestIDCtxKey{}, id), req)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// loggingInterceptor 每个请求一行日志：方法、状态码、耗时、请求 ID
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	log.Printf("[gRPC] %s %s %s request_id=%s", info.FullMethod, status.Code(err), time.Since(start), requestIDFromContext(ctx))
+	return resp, err
+}
+
+// metricsInterceptor 请求数与耗时 (/metrics)
+func metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// authInterceptor 校验 metadata authorization: Bearer <token>，通过后把 Claims 放入 context，再按方法检查角色
+func authInterceptor(v *auth.Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		token, ok := auth.BearerToken(incomingHeader(ctx, "authorization"))
+		if !ok {
+			return nil, grpcError(ctx, apierr.New(apierr.Unauthorized), 0)
+		}
+		claims, err := v.Verify(token)
+		if err != nil {
+			return nil, grpcError(ctx, apierr.New(apierr.Unauthorized), 0)
+		}
+		if roles, ok := grpcMethodRoles[info.FullMethod]; ok && !claims.HasRole(roles...) {
+			return nil, grpcError(ctx, apierr.New(apierr.Forbidden), 0)
+		}
+		return handler(auth.NewContext(ctx, claims), req)
+	}
+}
+
+// rateLimitInterceptor 与 HTTP 相同的限流规则和限流器，被拒绝时返回 RESOURCE_EXHAUSTED (RATE_LIMITED)，
+// metadata retry-after 与 RetryInfo 为建议的重试时间
+func rateLimitInterceptor(limiter ratelimit.Limiter, rules []ratelimit.Rule) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		route, ok := grpcRoutes[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		res := ratelimit.Check(ctx, limiter, rules, route.method, route.route, func(r ratelimit.Rule) string {
+			if key, ok := grpcRateLimitKeys[r.By]; ok {
+				return key(ctx, req)
+			}
+			return ""
+		})
+		if !res.Allowed {
+			retryAfter := time.Duration(ratelimit.RetryAfterSeconds(res.RetryAfter)) * time.Second
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(retryAfter.Seconds()))))
+			return nil, grpcError(ctx, apierr.New(apierr.RateLimited), retryAfter)
+		}
+		return handler(ctx, req)
+	}
+}
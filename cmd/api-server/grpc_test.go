@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	orderv1 "omniflow/api/order/v1"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/ratelimit"
+)
+
+// 测试用限流规则：单个客户下单突发 3 次 (与 HTTP 相同的路由写法)
+const grpcTestRules = `
+rules:
+  - route: POST /api/v1/orders
+    by: customer
+    rate: 0.01
+    burst: 3
+`
+
+// dialGRPC 在 bufconn 上启动与线上相同拦截器链的 gRPC 服务
+func dialGRPC(t *testing.T, env *testEnv) orderv1.OrderServiceClient {
+	t.Helper()
+	rules, err := ratelimit.Parse([]byte(grpcTestRules), rateLimitKeys)
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	s := newGRPCServer(env.verifier, rateLimitInterceptor(ratelimit.NewMemoryLimiter(), rules),
+		&orderServer{funnel: env.funnel, db: env.db, client: env.client})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return orderv1.NewOrderServiceClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// errorReason 错误详情中的 API 错误码
+func errorReason(t *testing.T, err error) (codes.Code, string) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	require.True(t, ok, "不是 gRPC 状态错误: %v", err)
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return st.Code(), info.Reason
+		}
+	}
+	return st.Code(), ""
+}
+
+func TestGRPC_CreateOrderAndIdempotentReplay(t *testing.T) {
+	env := newTestEnv(t)
+	env.preheat(t, "iPhone15", 5)
+	client := dialGRPC(t, env)
+	ctx := withToken(env.token(t, "C1", "customer"))
+
+	// 1. 下单：进入准入队列，返回订单号
+	req := &orderv1.CreateOrderRequest{Amount: 100, Items: []string{"iPhone15"}, IdempotencyKey: "checkout-1"}
+	first, err := client.CreateOrder(ctx, req)
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.OrderId)
+	assert.Equal(t, "PENDING", first.Status)
+	assert.False(t, first.Replayed)
+	assert.Equal(t, 4, env.stock(t, "iPhone15"))
+
+	// 2. 同一个 Key 重试：回放首次结果，不再扣减库存
+	again, err := client.CreateOrder(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, first.OrderId, again.OrderId)
+	assert.True(t, again.Replayed)
+	assert.Equal(t, 4, env.stock(t, "iPhone15"))
+	assert.Equal(t, 1, env.admission.Stats().Depth)
+
+	// 3. 同一个 Key 换了请求体
+	_, err = client.CreateOrder(ctx, &orderv1.CreateOrderRequest{Amount: 200, Items: []string{"iPhone15"}, IdempotencyKey: "checkout-1"})
+	code, reason := errorReason(t, err)
+	assert.Equal(t, codes.AlreadyExists, code)
+	assert.Equal(t, string(apierr.IdempotencyReused), reason)
+}
+
+func TestGRPC_ErrorCodes(t *testing.T) {
+	env := newTestEnv(t)
+	env.preheat(t, "SOLD_OUT", 0)
+	client := dialGRPC(t, env)
+	customer := withToken(env.token(t, "C1", "customer"))
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		req    *orderv1.CreateOrderRequest
+		code   codes.Code
+		reason apierr.Code
+	}{
+		{"缺少 Token", context.Background(), &orderv1.CreateOrderRequest{Items: []string{"iPhone15"}}, codes.Unauthenticated, apierr.Unauthorized},
+		{"角色不符", withToken(env.token(t, "R1", "reviewer")), &orderv1.CreateOrderRequest{Items: []string{"iPhone15"}}, codes.PermissionDenied, apierr.Forbidden},
+		{"参数错误", customer, &orderv1.CreateOrderRequest{}, codes.InvalidArgument, apierr.InvalidRequest},
+		{"未预热", customer, &orderv1.CreateOrderRequest{Items: []string{"UNKNOWN"}}, codes.FailedPrecondition, apierr.NotInFlashSale},
+		{"售罄", customer, &orderv1.CreateOrderRequest{Items: []string{"SOLD_OUT"}}, codes.ResourceExhausted, apierr.OutOfStock},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.CreateOrder(tc.ctx, tc.req)
+			code, reason := errorReason(t, err)
+			assert.Equal(t, tc.code, code)
+			assert.Equal(t, string(tc.reason), reason)
+		})
+	}
+
+	// 每个错误码都映射到明确的 gRPC 状态码
+	for c, want := range grpcCodes {
+		got, reason := errorReason(t, grpcError(context.Background(), apierr.New(c), 0))
+		assert.Equal(t, want, got, c)
+		assert.Equal(t, string(c), reason)
+	}
+}
+
+func TestGRPC_RateLimit(t *testing.T) {
+	env := newTestEnv(t)
+	env.preheat(t, "iPhone15", 10)
+	client := dialGRPC(t, env)
+	ctx := withToken(env.token(t, "C1", "customer"))
+
+	// 与 HTTP 相同的规则：同一客户突发 3 次后被拒绝，带建议的重试时间
+	for i := 0; i < 3; i++ {
+		_, err := client.CreateOrder(ctx, &orderv1.CreateOrderRequest{Amount: 100, Items: []string{"iPhone15"}})
+		require.NoError(t, err)
+	}
+	var header metadata.MD
+	_, err := client.CreateOrder(ctx, &orderv1.CreateOrderRequest{Amount: 100, Items: []string{"iPhone15"}}, grpc.Header(&header))
+	code, reason := errorReason(t, err)
+	assert.Equal(t, codes.ResourceExhausted, code)
+	assert.Equal(t, string(apierr.RateLimited), reason)
+	assert.NotEmpty(t, header.Get("retry-after"))
+	var retry *errdetails.RetryInfo
+	for _, d := range status.Convert(err).Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	require.NotNil(t, retry)
+	assert.Positive(t, retry.GetRetryDelay().AsDuration())
+	assert.Equal(t, 7, env.stock(t, "iPhone15"), "被限流的请求不进入漏斗")
+
+	// 其他客户不受影响
+	_, err = client.CreateOrder(withToken(env.token(t, "C2", "customer")), &orderv1.CreateOrderRequest{Amount: 100, Items: []string{"iPhone15"}})
+	require.NoError(t, err)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"omniflow/internal/pkg/apierr"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	replayedHeader    = "Idempotent-Replayed"
+
+	idempotencyPendingTTL = 30 * time.Second // 首个请求的处理中标记 (进程崩溃时自动释放)
+	idempotencyTTL        = 24 * time.Hour   // 首个响应保留时长
+)
+
+// orderNamespace 幂等键 -> Workflow ID 的 UUIDv5 命名空间
+var orderNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("omniflow/orders"))
+
+// idempotentWorkflowID 由客户 ID + 幂等键确定性地生成 Workflow ID
+// 不同客户使用相同的 Key 不会互相冲突
+func idempotentWorkflowID(customerID, key string) string {
+	return "ORDER-" + uuid.NewSHA1(orderNamespace, []byte(customerID+"\x00"+key)).String()
+}
+
+// requestFingerprint 请求体摘要，用于识别同一个 Key 被用在不同请求上
+func requestFingerprint(req interface{}) string {
+	raw, _ := json.Marshal(req)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// validIdempotencyKey 限制长度，避免超长 Key 撑爆 Redis
+func validIdempotencyKey(key string) bool {
+	return len(key) > 0 && len(key) <= 128
+}
+
+// replayIdempotent 回放首个请求的响应；请求体不一致或仍在处理时返回错误
+func replayIdempotent(status int, body []byte, recorded, fingerprint string) orderOutcome {
+	switch {
+	case recorded != fingerprint:
+		return failed(apierr.New(apierr.IdempotencyReused))
+	case status == 0:
+		return failed(apierr.New(apierr.RequestInProgress))
+	default:
+		return orderOutcome{Status: status, Body: body, Replayed: true}
+	}
+}
+
+// createdResponse 下单成功的响应体 (首次与回放保持一致)
+func createdResponse(orderID, runID string) (int, []byte) {
+	body, _ := json.Marshal(gin.H{
+		"message":  "抢购成功，正在处理中",
+		"order_id": orderID,
+		"run_id":   runID,
+	})
+	return http.StatusOK, body
+}
+
+// acceptedResponse 订单已进入准入队列，Workflow 稍后启动
+func acceptedResponse(orderID string) (int, []byte) {
+	body, _ := json.Marshal(gin.H{
+		"message":  "抢购成功，订单排队处理中",
+		"order_id": orderID,
+		"status":   "PENDING",
+	})
+	return http.StatusAccepted, body
+}
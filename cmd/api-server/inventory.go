@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+)
+
+// 查看单个 SKU 时返回的最近调整记录条数
+const recentAdjustments = 20
+
+func productResponse(p *app.Product) gin.H {
+	return gin.H{"sku": p.ID, "name": p.Name, "price": p.Price, "stock": p.Stock}
+}
+
+func adjustmentResponse(a *app.StockAdjustmentLog) gin.H {
+	return gin.H{
+		"request_id":   a.RequestID,
+		"sku":          a.SKU,
+		"delta":        a.Delta,
+		"reason":       a.Reason,
+		"operator":     a.Operator,
+		"stock_before": a.StockBefore,
+		"stock_after":  a.StockAfter,
+		"redis_synced": a.RedisSynced,
+		"created_at":   a.CreatedAt,
+	}
+}
+
+// stockResponse MySQL 库存、Redis 秒杀库存与预占并排展示，便于对账
+func stockResponse(v *app.StockView) gin.H {
+	body := gin.H{
+		"sku":         v.ID,
+		"name":        v.Name,
+		"price":       v.Price,
+		"mysql_stock": v.Stock,
+		"redis_stock": v.RedisStock, // 未预热时为 null
+		"reserved":    v.Reserved,
+	}
+	if v.RedisError != "" {
+		body["redis_error"] = v.RedisError
+	}
+	if v.Adjustments != nil {
+		adjustments := make([]gin.H, 0, len(v.Adjustments))
+		for i := range v.Adjustments {
+			adjustments = append(adjustments, adjustmentResponse(&v.Adjustments[i]))
+		}
+		body["adjustments"] = adjustments
+	}
+	return body
+}
+
+// abortWithInventoryError 库存服务错误 -> API 错误
+func abortWithInventoryError(c *gin.Context, err error) {
+	var inputErr *app.InventoryInputError
+	switch {
+	case errors.As(err, &inputErr):
+		abortWithError(c, apierr.Invalid(inputErr.Field))
+	case errors.Is(err, app.ErrProductNotFound):
+		abortWithError(c, apierr.New(apierr.ProductNotFound))
+	case errors.Is(err, app.ErrProductExists):
+		abortWithError(c, apierr.New(apierr.ProductExists))
+	case errors.Is(err, app.ErrStockNegative):
+		abortWithError(c, apierr.New(apierr.StockConflict))
+	case errors.Is(err, app.ErrAdjustmentConflict):
+		abortWithError(c, apierr.New(apierr.IdempotencyReused))
+	case errors.Is(err, app.ErrRestockSyncUnknown):
+		log.Printf("补货同步 Redis 失败: %v", err)
+		abortWithError(c, apierr.New(apierr.Internal).WithDetail(app.ErrRestockSyncUnknown.Error()))
+	default:
+		log.Printf("库存操作失败: %v", err)
+		abortWithError(c, apierr.New(apierr.Internal))
+	}
+}
+
+// requireIdempotencyKey 库存调整必须带 Idempotency-Key，重试不会重复调整
+func requireIdempotencyKey(c *gin.Context) (string, bool) {
+	key := c.GetHeader(idempotencyHeader)
+	if key == "" || len(key) > 100 {
+		abortWithError(c, apierr.Invalid(idempotencyHeader))
+		return "", false
+	}
+	return key, true
+}
+
+// createProductHandler 创建商品 (初始库存记一条调整)
+func createProductHandler(inventory *app.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			SKU   string `json:"sku"`
+			Name  string `json:"name"`
+			Price int    `json:"price"`
+			Stock int    `json:"stock"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+		p := app.Product{ID: req.SKU, Name: req.Name, Price: req.Price, Stock: req.Stock}
+		created, err := inventory.CreateProduct(c.Request.Context(), p, auth.FromContext(c).CustomerID())
+		if err != nil {
+			abortWithInventoryError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, productResponse(created))
+	}
+}
+
+// updateProductHandler 修改商品名称与价格 (库存通过调整接口修改)
+func updateProductHandler(inventory *app.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name  *string `json:"name"`
+			Price *int    `json:"price"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+		p, err := inventory.UpdateProduct(c.Request.Context(), c.Param("sku"), app.ProductUpdate{Name: req.Name, Price: req.Price})
+		if err != nil {
+			abortWithInventoryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, productResponse(p))
+	}
+}
+
+// listInventoryHandler 所有商品的库存
+func listInventoryHandler(inventory *app.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		views, err := inventory.List(c.Request.Context())
+		if err != nil {
+			abortWithInventoryError(c, err)
+			return
+		}
+		items := make([]gin.H, 0, len(views))
+		for i := range views {
+			items = append(items, stockResponse(&views[i]))
+		}
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
+
+// getInventoryHandler 单个 SKU 的库存与最近的调整记录
+func getInventoryHandler(inventory *app.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		view, err := inventory.Stock(c.Request.Context(), c.Param("sku"), recentAdjustments)
+		if err != nil {
+			abortWithInventoryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, stockResponse(view))
+	}
+}
+
+// restockHandler 补货 (同步到已预热的 Redis 秒杀库存)
+func restockHandler(inventory *app.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := requireIdempotencyKey(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Quantity int `json:"quantity"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+		record, err := inventory.Restock(c.Request.Context(), key, c.Param("sku"), req.Quantity, auth.FromContext(c).CustomerID())
+		if err != nil {
+			abortWithInventoryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, adjustmentResponse(record))
+	}
+}
+
+// adjustStockHandler 按原因调整 MySQL 库存 (盘点、报损等)
+func adjustStockHandler(inventory *app.InventoryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := requireIdempotencyKey(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Delta  int    `json:"delta"`
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+		record, err := inventory.Adjust(c.Request.Context(), common.StockAdjustment{
+			RequestID: key,
+			SKU:       c.Param("sku"),
+			Delta:     req.Delta,
+			Reason:    req.Reason,
+			Operator:  auth.FromContext(c).CustomerID(),
+		})
+		if err != nil {
+			abortWithInventoryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, adjustmentResponse(record))
+	}
+}
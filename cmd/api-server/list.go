@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+
+	"omniflow/internal/app"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+)
+
+// orderSummary 订单列表中的一项 (来自 Workflow 搜索属性)
+type orderSummary struct {
+	OrderID         string    `json:"order_id"`
+	RunID           string    `json:"run_id"`
+	WorkflowStatus  string    `json:"workflow_status"`
+	Status          string    `json:"status"`
+	CustomerID      string    `json:"customer_id"`
+	Amount          int64     `json:"amount"`
+	Campaign        string    `json:"campaign"`
+	SKUs            []string  `json:"skus"`
+	RiskVerdict     string    `json:"risk_verdict,omitempty"` // 仅审核员/管理员可见
+	RiskRules       []string  `json:"risk_rules,omitempty"`
+	StatusChangedAt time.Time `json:"status_changed_at"`
+	StartTime       time.Time `json:"start_time"`
+}
+
+// listOrdersHandler 通过 Temporal Visibility 分页查询订单
+// GET /api/v1/orders?status=&customer=&risk_verdict=&risk_rule=&from=&to=&stale_for=&page_size=&page_token=
+// from/to 为 RFC3339 时间，stale_for 为 Go duration (如 "1h"，用于排查卡单)
+// risk_verdict / risk_rule 按风控结论与命中规则筛选 (仅审核员/管理员)
+func listOrdersHandler(temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := app.OrderListFilter{
+			Status:      c.Query("status"),
+			CustomerID:  c.Query("customer"),
+			RiskVerdict: c.Query("risk_verdict"),
+			RiskRule:    c.Query("risk_rule"),
+		}
+
+		var err error
+		if v := c.Query("from"); v != "" {
+			if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+				abortWithError(c, apierr.Invalid("from"))
+				return
+			}
+		}
+		if v := c.Query("to"); v != "" {
+			if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+				abortWithError(c, apierr.Invalid("to"))
+				return
+			}
+		}
+		if v := c.Query("stale_for"); v != "" {
+			if filter.StaleFor, err = time.ParseDuration(v); err != nil {
+				abortWithError(c, apierr.Invalid("stale_for"))
+				return
+			}
+		}
+
+		var pageSize int
+		if v := c.Query("page_size"); v != "" {
+			if pageSize, err = strconv.Atoi(v); err != nil || pageSize <= 0 {
+				abortWithError(c, apierr.Invalid("page_size"))
+				return
+			}
+		}
+		var pageToken []byte
+		if v := c.Query("page_token"); v != "" {
+			if pageToken, err = base64.URLEncoding.DecodeString(v); err != nil {
+				abortWithError(c, apierr.Invalid("page_token"))
+				return
+			}
+		}
+
+		orders, next, apiErr := listOrders(c.Request.Context(), temporalClient, auth.FromContext(c), filter, pageSize, pageToken)
+		if apiErr != nil {
+			abortWithError(c, apiErr)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"orders":          orders,
+			"next_page_token": base64.URLEncoding.EncodeToString(next),
+		})
+	}
+}
+
+// listOrders 订单列表 (HTTP 与 gRPC 共用)；客户只能查自己的订单
+// pageSize 为 0 时默认 20，最大 100
+func listOrders(ctx context.Context, temporalClient client.Client, claims *auth.Claims, filter app.OrderListFilter, pageSize int, pageToken []byte) ([]orderSummary, []byte, *apierr.Error) {
+	if !staffClaims(claims) {
+		// 没有客户 ID 时不能按客户过滤，直接拒绝，避免返回所有客户的订单
+		if claims == nil || claims.CustomerID() == "" {
+			return nil, nil, apierr.New(apierr.Forbidden)
+		}
+		// 风控结论与命中规则不对客户公开
+		if filter.RiskVerdict != "" || filter.RiskRule != "" {
+			return nil, nil, apierr.New(apierr.Forbidden)
+		}
+		filter.CustomerID = claims.CustomerID()
+	}
+	if pageSize == 0 {
+		pageSize = 20
+	} else if pageSize < 0 || pageSize > 100 {
+		return nil, nil, apierr.Invalid("page_size")
+	}
+	filter.Now = time.Now()
+
+	query, err := filter.ListQuery()
+	if err != nil {
+		return nil, nil, apierr.New(apierr.InvalidRequest).WithDetail(err.Error())
+	}
+
+	resp, err := temporalClient.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+		PageSize:      int32(pageSize),
+		NextPageToken: pageToken,
+		Query:         query,
+	})
+	if err != nil {
+		log.Printf("订单列表查询失败: %v", err)
+		return nil, nil, apierr.New(apierr.Internal)
+	}
+
+	orders := make([]orderSummary, 0, len(resp.Executions))
+	for _, exec := range resp.Executions {
+		attrs := exec.GetSearchAttributes().GetIndexedFields()
+		summary := orderSummary{
+			OrderID:         exec.GetExecution().GetWorkflowId(),
+			RunID:           exec.GetExecution().GetRunId(),
+			WorkflowStatus:  exec.GetStatus().String(),
+			Status:          decodeAttr[string](attrs, app.SearchAttrOrderStatus.GetName()),
+			CustomerID:      decodeAttr[string](attrs, app.SearchAttrCustomerID.GetName()),
+			Amount:          decodeAttr[int64](attrs, app.SearchAttrAmount.GetName()),
+			Campaign:        decodeAttr[string](attrs, app.SearchAttrCampaign.GetName()),
+			SKUs:            decodeAttr[[]string](attrs, app.SearchAttrSKUs.GetName()),
+			StatusChangedAt: decodeAttr[time.Time](attrs, app.SearchAttrStatusChangedAt.GetName()),
+			StartTime:       exec.GetStartTime().AsTime(),
+		}
+		if staffClaims(claims) {
+			summary.RiskVerdict = decodeAttr[string](attrs, app.SearchAttrRiskVerdict.GetName())
+			summary.RiskRules = decodeAttr[[]string](attrs, app.SearchAttrRiskRules.GetName())
+		}
+		orders = append(orders, summary)
+	}
+	return orders, resp.NextPageToken, nil
+}
+
+// decodeAttr 解码单个搜索属性，缺失或类型不符时返回零值
+func decodeAttr[T any](attrs map[string]*commonpb.Payload, name string) T {
+	var v T
+	if p, ok := attrs[name]; ok {
+		_ = converter.GetDefaultDataConverter().FromPayload(p, &v)
+	}
+	return v
+}
@@ -4,28 +4,63 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.temporal.io/sdk/client"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 
 	"omniflow/internal/app"
 	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+	"omniflow/internal/pkg/pubsub"
 	"omniflow/internal/pkg/store" // 🔥 引入新包
 )
 
 func main() {
 	// 1. 初始化 Redis 连接
-	// 注意：go run 本地运行时，连接 localhost:6379
-	redisStore := store.NewRedisStore("127.0.0.1:6379")
-
-	// 2. [模拟] 库存预热 (Warm-up)
-	// 启动时强制把 iPhone15 库存设为 10，方便你测试
+	// 默认单机 127.0.0.1:6379，REDIS_MODE=sentinel/cluster 切换到哨兵或集群
 	ctx := context.Background()
-	if err := redisStore.PreheatStock(ctx, "iPhone15", 10); err != nil {
-		log.Printf("⚠️ 库存预热失败: %v", err)
-	} else {
-		log.Println("🔥 Redis 库存预热完成: iPhone15 = 10")
+	rs, err := store.New(ctx, store.OptionsFromEnv())
+	if err != nil {
+		log.Fatalln("无法连接 Redis", err)
+	}
+	defer rs.Close()
+
+	// Redis 熔断：连续失败或变慢时快速失败，下单按 SKU 的降级策略处理 (见 degrade.go)
+	redisStore := store.NewBreakerStore(rs, store.BreakerOptions{
+		FailureThreshold: envInt("REDIS_BREAKER_FAILURES", 5),
+		OpenTimeout:      envDuration("REDIS_BREAKER_OPEN_TIMEOUT", 5*time.Second),
+		CallTimeout:      envDuration("REDIS_BREAKER_CALL_TIMEOUT", 200*time.Millisecond),
+		SlowCallTimeout:  envDuration("REDIS_BREAKER_SLOW_CALL_TIMEOUT", 5*time.Second),
+	})
+	degrade := loadDegradePolicy(redisStore.Breaker)
+
+	// 2. [本地开发] 库存预热 (DEV_PREHEAT_STOCK=iPhone15=10)
+	// 会覆盖 Redis 中的库存与分桶计数，只用于本地测试；线上由活动发布预热
+	for sku, stock := range envSKUCounts("DEV_PREHEAT_STOCK") {
+		if err := redisStore.PreheatStock(ctx, sku, stock); err != nil {
+			log.Printf("⚠️ 库存预热失败: %v", err)
+		} else {
+			log.Printf("🔥 Redis 库存预热完成: %s = %d", sku, stock)
+		}
+	}
+
+	// 热点 SKU 分桶 (STOCK_BUCKETS=iPhone15=8,MacPro=4)，运行期间定期重新平衡各桶库存
+	bucketed := envSKUCounts("STOCK_BUCKETS")
+	for sku, n := range bucketed {
+		if _, err := redisStore.ReshardStock(ctx, sku, n); err != nil {
+			log.Printf("⚠️ 库存分桶失败 %s: %v", sku, err)
+		}
+	}
+	if interval := envDuration("STOCK_REBALANCE_INTERVAL", 5*time.Second); len(bucketed) > 0 && interval > 0 {
+		go rebalanceStock(ctx, redisStore, bucketed, interval)
 	}
 
 	// 3. 初始化 Temporal Client
@@ -37,87 +72,320 @@ func main() {
 	}
 	defer c.Close()
 
-	// 4. 启动 Gin Server
+	// 4. 连接 MySQL (订单读模型)
+	dsn := "root:root@tcp(127.0.0.1:3306)/omniflow?charset=utf8mb4&parseTime=True&loc=Local"
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatalln("MySQL 连接失败:", err)
+	}
+
+	// 5. 风控审核 SLA (可通过环境变量覆盖)
+	reviewPolicy := loadReviewPolicy()
+
+	// 6. 后台清扫：Outbox (补启动崩溃前未启动的订单，超时未启动的归还库存) 与过期预占
+	sweeper := &app.OutboxSweeper{
+		Store:       redisStore,
+		Client:      c,
+		StartAfter:  envDuration("OUTBOX_START_AFTER", 30*time.Second),
+		ReturnAfter: envDuration("OUTBOX_RETURN_AFTER", 10*time.Minute),
+	}
+
+	// 秒杀预占过期处理：订单仍在进行则续期，否则按订单结果确认或归还
+	reservationTTL := envDuration("RESERVATION_TTL", time.Hour)
+	reservationSweeper := &app.ReservationSweeper{Store: redisStore, Client: c, TTL: reservationTTL}
+	go reservationSweeper.Run(ctx, 30*time.Second)
+
+	// 准入队列：漏斗放行的订单排队，按令牌桶速率启动 Workflow
+	admission := app.NewAdmission(redisStore, c, app.AdmissionOptions{
+		QueueSize: envInt("ADMISSION_QUEUE_SIZE", 10000),
+		Workers:   envInt("ADMISSION_WORKERS", 16),
+		Rate:      float64(envInt("ADMISSION_RATE", 500)),
+		Burst:     envInt("ADMISSION_BURST", 50),
+	})
+	// 排队中的订单不能被 Sweeper 抢先补启动：队列排满的启动时间必须小于 OUTBOX_START_AFTER
+	if admission.DrainTime() >= sweeper.StartAfter {
+		log.Fatalf("准入队列排满需要 %s 才能启动完，不小于 OUTBOX_START_AFTER (%s)：请调小 ADMISSION_QUEUE_SIZE、调大 ADMISSION_RATE 或 OUTBOX_START_AFTER", admission.DrainTime(), sweeper.StartAfter)
+	}
+	go sweeper.Run(ctx, 10*time.Second)
+	go admission.Run(ctx)
+
+	// 本地售罄标记：SKU 卖完后在进程内直接拒绝，补货时通过 Redis Pub/Sub 清除
+	soldOut := store.NewSoldOutCache(redisStore, envDuration("SOLD_OUT_TTL", 2*time.Second))
+	go soldOut.Run(ctx)
+
+	// 订单状态推送：Worker 投影后发布到 Redis Pub/Sub，本实例订阅后分发给 SSE 连接
+	events := pubsub.NewRedis(rs.Client)
+	go events.Run(ctx)
+
+	// 鉴权：验签密钥见 config/auth/keys.yaml
+	verifier, err := loadVerifier()
+	if err != nil {
+		log.Fatalln("加载鉴权密钥失败:", err)
+	}
+
+	// 7. 启动 Gin Server
 	r := gin.Default()
+	// 只信任 TRUSTED_PROXIES 中的代理传来的 X-Forwarded-For，否则按 IP 限流可以被伪造绕过
+	if err := r.SetTrustedProxies(envList("TRUSTED_PROXIES")); err != nil {
+		log.Fatalln("TRUSTED_PROXIES 配置无效:", err)
+	}
+	r.Use(requestIDMiddleware())
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	// 以下业务接口都需要 Bearer Token；先鉴权再限流，按客户限流才能使用 Token 中的客户 ID
+	r.Use(authMiddleware(verifier))
+	limiter, rateLimits := loadRateLimit(rs.Client)
+	r.Use(rateLimitMiddleware(limiter, rateLimits))
 
 	// 注入依赖
-	r.POST("/api/v1/orders", createOrderHandler(c, redisStore))
+	staff := requireRole(auth.RoleReviewer, auth.RoleAdmin)
+	owner := requireOrderOwner(db, c)
+	campaigns := &app.CampaignService{DB: db, Store: redisStore, Client: c}
+	funnel := &orderFunnel{
+		client:         c,
+		store:          redisStore,
+		soldOut:        soldOut,
+		degrade:        degrade,
+		admission:      admission,
+		campaigns:      campaigns,
+		reviewPolicy:   reviewPolicy,
+		reservationTTL: reservationTTL,
+	}
+	// gRPC 订单服务 (内部服务调用)，与下面的 HTTP 接口共用同一套处理逻辑
+	go serveGRPC(newGRPCServer(verifier, rateLimitInterceptor(limiter, rateLimits), &orderServer{funnel: funnel, db: db, client: c}))
+
+	r.POST("/api/v1/orders", requireRole(auth.RoleCustomer), createOrderHandler(funnel))
+	r.POST("/api/v1/orders/batch", requireRole(auth.RoleCustomer, auth.RoleImporter), bulkCreateOrdersHandler(funnel, bulkOptionsFromEnv()))
+	r.GET("/api/v1/orders", listOrdersHandler(c))
+	r.GET("/api/v1/orders/:id", owner, getOrderHandler(db))
+	r.GET("/api/v1/orders/:id/history", owner, getOrderHistoryHandler(db))
+	r.GET("/api/v1/orders/:id/events", orderEventsHandler(db, c, events, eventsOptionsFromEnv())) // 归属在 handler 内校验
+	r.GET("/api/v1/orders/:id/timeline", owner, getOrderTimelineHandler(c))
+	r.GET("/api/v1/orders/:id/audit", staff, getAuditHandler(c))
+	r.POST("/api/v1/orders/:id/audit", staff, auditOrderHandler(c))
+	r.PUT("/api/v1/orders/:id/shipping-address", owner, changeShippingAddressHandler(c))
+	r.DELETE("/api/v1/orders/:id/lines/:sku", owner, removeLineHandler(c))
+	r.POST("/api/v1/orders/:id/pay", owner, payOrderHandler(c))
+	r.POST("/api/v1/orders/:id/cancel", owner, cancelOrderHandler(c))
+
+	admin := r.Group("/api/v1/admin", requireRole(auth.RoleAdmin))
+	admin.GET("/admission", admissionStatsHandler(admission))
+	admin.POST("/campaigns", createCampaignHandler(campaigns))
+	admin.GET("/campaigns/:id", getCampaignHandler(campaigns))
+	admin.POST("/campaigns/:id/pause", pauseCampaignHandler(campaigns))
+	admin.POST("/campaigns/:id/resume", resumeCampaignHandler(campaigns))
+	inventory := &app.InventoryService{DB: db, Store: redisStore}
+	admin.POST("/products", createProductHandler(inventory))
+	admin.PUT("/products/:sku", updateProductHandler(inventory))
+	admin.GET("/inventory", listInventoryHandler(inventory))
+	admin.GET("/inventory/:sku", getInventoryHandler(inventory))
+	admin.POST("/inventory/:sku/restock", restockHandler(inventory))
+	admin.POST("/inventory/:sku/adjustments", adjustStockHandler(inventory))
+	webhooks := &app.WebhookService{DB: db, Client: c, AllowedHosts: envList("WEBHOOK_ALLOWED_HOSTS")}
+	admin.POST("/webhooks", createWebhookHandler(webhooks))
+	admin.GET("/webhooks", listWebhooksHandler(webhooks))
+	admin.DELETE("/webhooks/:id", deleteWebhookHandler(webhooks))
+	admin.GET("/webhooks/deliveries", listDeliveriesHandler(webhooks))
+	admin.POST("/webhooks/deliveries/:id/replay", replayDeliveryHandler(webhooks))
 
 	log.Println("🚀 API Server 监听 :8000")
 	r.Run(":8000")
 }
 
-func createOrderHandler(temporalClient client.Client, redisStore *store.RedisStore) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var req struct {
-			Amount int      `json:"amount"`
-			Items  []string `json:"items"`
+// envDuration 读取 Go duration 格式的环境变量，未配置或无效时使用默认值
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("⚠️ %s 配置无效 (%s)，使用默认值 %s", name, v, def)
+		return def
+	}
+	return d
+}
+
+// envList 读取逗号分隔的环境变量，未配置时返回 nil
+func envList(name string) []string {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	var list []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
 		}
+	}
+	return list
+}
 
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
-			return
+// envSKUCounts 读取 "SKU=数量,SKU=数量" 格式的环境变量 (热点分桶数、开发预热库存)
+func envSKUCounts(name string) map[string]int {
+	counts := make(map[string]int)
+	v := os.Getenv(name)
+	if v == "" {
+		return counts
+	}
+	for _, part := range strings.Split(v, ",") {
+		sku, count, _ := strings.Cut(strings.TrimSpace(part), "=")
+		n, err := strconv.Atoi(count)
+		if sku == "" || err != nil || n < 1 {
+			log.Printf("⚠️ %s 配置无效 (%s)，已忽略", name, part)
+			continue
 		}
+		counts[sku] = n
+	}
+	return counts
+}
 
-		if len(req.Items) == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "商品列表为空"})
+// rebalanceStock 定期把分桶 SKU 的库存重新摊平，避免流量集中到最后几个有货的桶
+func rebalanceStock(ctx context.Context, redisStore store.StockStore, skus map[string]int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			for sku := range skus {
+				if _, err := redisStore.RebalanceStock(ctx, sku); err != nil {
+					log.Printf("⚠️ 库存重新平衡失败 %s: %v", sku, err)
+				}
+			}
 		}
+	}
+}
+
+// loadReviewPolicy 读取审核 SLA 配置
+// REVIEW_REMIND_AFTER / REVIEW_ESCALATE_AFTER / REVIEW_REJECT_AFTER 为 Go duration 格式 (如 "30m")
+// REVIEW_PRIMARY_GROUP / REVIEW_ESCALATION_GROUP 为审核组名
+func loadReviewPolicy() common.ReviewPolicy {
+	policy := common.DefaultReviewPolicy()
+	durations := map[string]*time.Duration{
+		"REVIEW_REMIND_AFTER":   &policy.RemindAfter,
+		"REVIEW_ESCALATE_AFTER": &policy.EscalateAfter,
+		"REVIEW_REJECT_AFTER":   &policy.RejectAfter,
+	}
+	for env, target := range durations {
+		if v := os.Getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				log.Printf("⚠️ %s 配置无效 (%s)，使用默认值 %s", env, v, *target)
+				continue
+			}
+			*target = d
+		}
+	}
+	if v := os.Getenv("REVIEW_PRIMARY_GROUP"); v != "" {
+		policy.PrimaryGroup = v
+	}
+	if v := os.Getenv("REVIEW_ESCALATION_GROUP"); v != "" {
+		policy.EscalationGroup = v
+	}
+	if err := policy.Validate(); err != nil {
+		log.Printf("⚠️ 审核 SLA 配置无效 (%v)，使用默认值", err)
+		return common.DefaultReviewPolicy()
+	}
+	return policy
+}
+
+// admissionStatsHandler 准入队列积压情况 (排队数、容量、正在启动数、建议重试间隔)
+func admissionStatsHandler(admission *app.Admission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats := admission.Stats()
+		c.JSON(http.StatusOK, gin.H{
+			"depth":       stats.Depth,
+			"capacity":    stats.Capacity,
+			"in_flight":   stats.InFlight,
+			"saturated":   admission.Saturated(),
+			"retry_after": int(admission.RetryAfter().Seconds()),
+		})
+	}
+}
 
-		// === 🔥 核心：Redis 流量漏斗 ===
-		// 简化逻辑：我们只对第一个商品做秒杀判定
-		targetProduct := req.Items[0]
+// getAuditHandler 审核人查看订单当前状态与风控命中原因
+func getAuditHandler(temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID := c.Param("id")
 
-		// 1. 尝试在 Redis 原子扣减
-		result, err := redisStore.DeductStock(c.Request.Context(), targetProduct, 1)
+		val, err := temporalClient.QueryWorkflow(c.Request.Context(), orderID, "", "get_risk_assessment")
 		if err != nil {
-			log.Printf("Redis 错误: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统繁忙"})
+			abortWithError(c, apierr.New(apierr.NotFound))
 			return
 		}
-
-		// 2. 判断结果
-		if result == 0 {
-			// 库存不足 -> 拦截！不请求 Temporal，不查 MySQL
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "手慢了，库存不足！"})
-			return
-		} else if result == -1 {
-			// 没预热 -> 拒绝或者是普通商品
-			c.JSON(http.StatusBadRequest, gin.H{"error": "该商品未开放秒杀"})
+		var assessment common.RiskAssessment
+		if err := val.Get(&assessment); err != nil {
+			abortWithError(c, apierr.New(apierr.Internal))
 			return
 		}
 
-		// result == 1 -> 抢到了！放行进入后端逻辑
-
-		// === 🌊 放行：进入 Temporal 处理 ===
-		workflowID := "ORDER-" + uuid.New().String()
-		options := client.StartWorkflowOptions{
-			ID:        workflowID,
-			TaskQueue: common.TaskQueue,
+		var timeline common.OrderTimeline
+		if val, err := temporalClient.QueryWorkflow(c.Request.Context(), orderID, "", "get_order_timeline"); err == nil {
+			_ = val.Get(&timeline)
 		}
 
-		order := common.Order{
-			OrderID: workflowID,
-			Amount:  req.Amount,
-			Items:   req.Items,
-		}
+		c.JSON(http.StatusOK, gin.H{
+			"order_id":    orderID,
+			"state":       timeline.State,
+			"state_label": timeline.Label,
+			"verdict":     assessment.Verdict,
+			"reasons":     assessment.Reasons,
+		})
+	}
+}
 
-		// 异步启动 Workflow
-		we, err := temporalClient.ExecuteWorkflow(c.Request.Context(), options, app.OrderFulfillmentWorkflow, order)
+// getOrderTimelineHandler 订单状态时间线 (状态码、进入时间、原因)，供前端渲染进度
+func getOrderTimelineHandler(temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID := c.Param("id")
+		val, err := temporalClient.QueryWorkflow(c.Request.Context(), orderID, "", "get_order_timeline")
 		if err != nil {
-			log.Printf("Workflow 启动失败: %v", err)
+			abortWithError(c, apierr.New(apierr.NotFound))
+			return
+		}
+		var timeline common.OrderTimeline
+		if err := val.Get(&timeline); err != nil {
+			abortWithError(c, apierr.New(apierr.Internal))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"order_id":    orderID,
+			"state":       timeline.State,
+			"state_label": timeline.Label,
+			"final":       timeline.State.IsFinal(),
+			"transitions": timeline.Transitions,
+		})
+	}
+}
 
-			// ⚠️ 补偿机制：Temporal 挂了，把 Redis 库存还回去
-			_ = redisStore.RollbackStock(context.Background(), targetProduct, 1)
+// auditOrderHandler 提交人工审核结果 (Signal)
+func auditOrderHandler(temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Action string `json:"action"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.Invalid("action"))
+			return
+		}
 
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "订单创建失败"})
+		orderID := c.Param("id")
+		if err := submitAudit(c.Request.Context(), temporalClient, orderID, req.Action); err != nil {
+			abortWithError(c, err)
 			return
 		}
+		c.JSON(http.StatusOK, gin.H{"message": "审核结果已提交", "order_id": orderID, "action": req.Action})
+	}
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message":  "抢购成功，正在处理中",
-			"order_id": order.OrderID,
-			"run_id":   we.GetRunID(),
-		})
+// submitAudit 审核结果 APPROVE / REJECT (HTTP 与 gRPC 共用)
+func submitAudit(ctx context.Context, temporalClient client.Client, orderID, action string) *apierr.Error {
+	if action != "APPROVE" && action != "REJECT" {
+		return apierr.Invalid("action")
+	}
+	if err := temporalClient.SignalWorkflow(ctx, orderID, "", "SIGNAL_ADMIN_ACTION", action); err != nil {
+		return apierr.New(apierr.NotFound)
 	}
+	return nil
 }
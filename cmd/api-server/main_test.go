@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/mocks"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/auth"
+	"omniflow/internal/pkg/store"
+)
+
+var testSecret = []byte("test-secret-0123456789abcdef")
+
+// testEnv api-server 测试依赖：miniredis (经过熔断器)、SQLite 读模型与 Temporal mock
+// 准入队列不启动 Worker，放行的订单留在队列中
+type testEnv struct {
+	redis     *miniredis.Miniredis
+	store     *store.BreakerStore
+	db        *gorm.DB
+	client    *mocks.Client
+	admission *app.Admission
+	funnel    *orderFunnel
+	verifier  *auth.Verifier
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return newTestEnvWithBreaker(t, time.Minute)
+}
+
+// newTestEnvWithBreaker openTimeout 为熔断后放行探测请求的冷却时间
+func newTestEnvWithBreaker(t *testing.T, openTimeout time.Duration) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s := miniredis.RunT(t)
+	rs, err := store.NewRedisStore(s.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { rs.Close() })
+	// 一次失败即熔断
+	bs := store.NewBreakerStore(rs, store.BreakerOptions{Name: "test", FailureThreshold: 1, OpenTimeout: openTimeout})
+
+	// 每个测试一个内存库 (同名共享缓存会在测试之间串数据)
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.AutoMigrate(app.ReadModels()...))
+	require.NoError(t, db.AutoMigrate(app.CampaignModels()...))
+
+	v, err := auth.NewVerifier("omniflow-test", "omniflow-api", auth.HS256Key("test", testSecret))
+	require.NoError(t, err)
+
+	c := &mocks.Client{}
+	admission := app.NewAdmission(bs, c, app.AdmissionOptions{QueueSize: 10, Rate: 1})
+	return &testEnv{
+		redis:     s,
+		store:     bs,
+		db:        db,
+		client:    c,
+		admission: admission,
+		verifier:  v,
+		funnel: &orderFunnel{
+			client:  c,
+			store:   bs,
+			soldOut: store.NewSoldOutCache(bs, time.Second),
+			degrade: &degradePolicy{
+				breaker:    bs.Breaker,
+				def:        degradeReject,
+				skus:       make(map[string]degradeMode),
+				mysqlSlots: make(chan struct{}, 1),
+				queueSlots: make(chan struct{}, 1),
+				queueWait:  time.Second,
+			},
+			admission:      admission,
+			campaigns:      &app.CampaignService{DB: db, Store: bs, Client: c},
+			reviewPolicy:   common.DefaultReviewPolicy(),
+			reservationTTL: time.Hour,
+		},
+	}
+}
+
+// token 签发测试 Token，sub 为客户 ID
+func (e *testEnv) token(t *testing.T, sub string, roles ...string) string {
+	t.Helper()
+	now := time.Now()
+	token, err := auth.Sign(auth.Claims{
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   sub,
+			Issuer:    "omniflow-test",
+			Audience:  jwt.ClaimStrings{"omniflow-api"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}, "test", jwt.SigningMethodHS256, testSecret)
+	require.NoError(t, err)
+	return token
+}
+
+// preheat 预热秒杀库存
+func (e *testEnv) preheat(t *testing.T, sku string, stock int) {
+	t.Helper()
+	require.NoError(t, e.store.PreheatStock(context.Background(), sku, stock))
+}
+
+// stock Redis 中的剩余库存
+func (e *testEnv) stock(t *testing.T, sku string) int {
+	t.Helper()
+	total, _, err := e.store.StockLevel(context.Background(), sku)
+	require.NoError(t, err)
+	return total
+}
+
+// serve 发送一个 HTTP 请求，token 为空时不带 Authorization
+func serve(r http.Handler, method, path, token, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// tripBreaker Redis 宕机并触发熔断；Redis 随即恢复，熔断器在冷却期内仍拒绝请求
+func (e *testEnv) tripBreaker(t *testing.T) {
+	t.Helper()
+	e.redis.SetError("LOADING Redis is loading the dataset in memory")
+	_, _, _ = e.store.StockLevel(context.Background(), "PROBE")
+	require.Equal(t, store.BreakerOpen, e.store.Breaker.State())
+	e.redis.SetError("")
+}
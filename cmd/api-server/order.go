@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.temporal.io/sdk/client"
+
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+	"omniflow/internal/pkg/store"
+)
+
+// createOrderRequest 下单请求体
+type createOrderRequest struct {
+	Amount          int             `json:"amount"`
+	Items           []string        `json:"items"`
+	CustomerID      string          `json:"-"` // 取自 Token 的 sub，不信任请求体
+	ShippingAddress *common.Address `json:"shipping_address"`
+	BillingAddress  *common.Address `json:"billing_address"`
+}
+
+// orderOutcome 一笔下单的结果：成功时为响应 (Status/Body)，失败时为 Err
+// 单笔下单直接写回响应，批量下单汇总成逐笔结果
+type orderOutcome struct {
+	Status     int
+	Body       []byte
+	Err        *apierr.Error
+	Replayed   bool // 幂等重试回放的响应
+	RetryAfter time.Duration
+}
+
+func failed(err *apierr.Error) orderOutcome { return orderOutcome{Err: err} }
+
+func succeeded(status int, body []byte) orderOutcome { return orderOutcome{Status: status, Body: body} }
+
+// queueFull 准入队列已满，Retry-After 按当前积压与启动速率估算
+func queueFull(admission *app.Admission) orderOutcome {
+	return orderOutcome{Err: apierr.New(apierr.QueueFull), RetryAfter: admission.RetryAfter()}
+}
+
+// claimIdempotent 占用幂等 Key；重试时返回首个请求的响应 (replay)
+// 占用成功时返回 finish：成功保存响应供回放，失败 (库存不足等) 释放 Key，允许客户端重试
+func (f *orderFunnel) claimIdempotent(ctx context.Context, workflowID string, req createOrderRequest) (replay *orderOutcome, finish func(orderOutcome), err error) {
+	fingerprint := requestFingerprint(req)
+	rec, acquired, err := f.store.BeginIdempotent(ctx, workflowID, fingerprint, idempotencyPendingTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !acquired {
+		// 重试：不再扣减库存，直接回放首个响应
+		outcome := replayIdempotent(rec.Status, rec.Body, rec.Fingerprint, fingerprint)
+		return &outcome, nil, nil
+	}
+	return nil, func(outcome orderOutcome) {
+		if outcome.Err != nil {
+			_ = f.store.ReleaseIdempotent(context.Background(), workflowID)
+			return
+		}
+		if err := f.store.CompleteIdempotent(context.Background(), workflowID, fingerprint, outcome.Status, outcome.Body, idempotencyTTL); err != nil {
+			log.Printf("幂等响应保存失败: %v", err)
+		}
+	}, nil
+}
+
+// write 把下单结果写回单笔下单的响应
+func (o orderOutcome) write(c *gin.Context) {
+	if o.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(o.RetryAfter.Seconds())))
+	}
+	if o.Err != nil {
+		abortWithError(c, o.Err)
+		return
+	}
+	if o.Replayed {
+		c.Header(replayedHeader, "true")
+	}
+	c.Data(o.Status, "application/json; charset=utf-8", o.Body)
+}
+
+// orderFunnel 下单漏斗：售罄标记 -> 熔断降级 -> 准入背压 -> 幂等 -> Redis 扣减 -> 准入队列
+// reservationTTL 为 Redis 预占的有效期 (过期后由 ReservationSweeper 处理)
+type orderFunnel struct {
+	client         client.Client
+	store          store.StockStore
+	soldOut        *store.SoldOutCache
+	degrade        *degradePolicy
+	admission      *app.Admission
+	campaigns      *app.CampaignService
+	reviewPolicy   common.ReviewPolicy
+	reservationTTL time.Duration
+}
+
+// createOrderHandler 秒杀下单
+func createOrderHandler(funnel *orderFunnel) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createOrderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+		req.CustomerID = auth.FromContext(c).CustomerID()
+		funnel.place(c.Request.Context(), req, c.GetHeader(idempotencyHeader)).write(c)
+	}
+}
+
+// place 让一笔订单通过漏斗；idemKey 为空表示不幂等
+func (f *orderFunnel) place(ctx context.Context, req createOrderRequest, idemKey string) (outcome orderOutcome) {
+	if len(req.Items) == 0 {
+		return failed(apierr.Invalid("items"))
+	}
+
+	// 已售罄的 SKU 直接拒绝，不访问 Redis
+	// 带 Idempotency-Key 的请求照常处理：重试需要回放首个请求的结果
+	if idemKey == "" && f.soldOut.IsSoldOut(req.Items[0]) {
+		return failed(apierr.New(apierr.OutOfStock))
+	}
+
+	// === 幂等：同一个 Idempotency-Key 映射到同一个 Workflow ID ===
+	// 先于熔断降级与准入检查：已受理的重试直接回放首个响应，不会因为排队或降级得到不同的结果
+	workflowID := "ORDER-" + uuid.New().String()
+	var finish func(orderOutcome)
+	defer func() {
+		if finish != nil {
+			finish(outcome)
+		}
+	}()
+	claim := func() (*orderOutcome, error) {
+		replay, fin, err := f.claimIdempotent(ctx, workflowID, req)
+		finish = fin
+		return replay, err
+	}
+	redisDown := false
+	if idemKey != "" {
+		if !validIdempotencyKey(idemKey) {
+			return failed(apierr.Invalid(idempotencyHeader))
+		}
+		workflowID = idempotentWorkflowID(req.CustomerID, idemKey)
+		replay, err := claim()
+		switch {
+		case replay != nil:
+			return *replay
+		case errors.Is(err, store.ErrCircuitOpen):
+			// 熔断中查不到幂等记录，交给降级策略 (MySQL 降级靠固定的 Workflow ID 去重)
+			redisDown = true
+		case err != nil:
+			return failed(storeError(err))
+		}
+	}
+
+	// Redis 熔断中：按 SKU 的降级策略拒绝、排队等待恢复或走 MySQL 直连下单
+	if redisDown || f.degrade.tripped() {
+		switch f.degrade.mode(req.Items[0]) {
+		case degradeMySQL:
+			return f.degrade.createOrderWithoutRedis(ctx, f.client, f.campaigns, req, idemKey, f.reviewPolicy)
+		case degradeQueue:
+			if !f.degrade.queue(ctx) {
+				return failed(apierr.New(apierr.ServiceDegraded))
+			}
+			// Redis 已恢复：补查熔断期间没拿到的幂等记录
+			if idemKey != "" && finish == nil {
+				replay, err := claim()
+				if replay != nil {
+					return *replay
+				}
+				if err != nil {
+					return failed(storeError(err))
+				}
+			}
+		default:
+			degradedOrders.WithLabelValues(string(degradeReject), "rejected").Inc()
+			return failed(apierr.New(apierr.ServiceDegraded))
+		}
+	}
+
+	// 准入队列已满：扣减库存前直接拒绝 (幂等 Key 随失败释放，客户端可用同一个 Key 重试)
+	if f.admission.Saturated() {
+		return queueFull(f.admission)
+	}
+
+	// === 🔥 核心：Redis 流量漏斗 ===
+	// 简化逻辑：我们只对第一个商品做秒杀判定
+	targetProduct := req.Items[0]
+
+	// 活动商品按活动售价下单，限购按客户计数
+	campaign, salePrice, err := f.store.CampaignForSKU(ctx, targetProduct)
+	if err != nil {
+		return failed(storeError(err))
+	}
+	amount := req.Amount
+	campaignID := ""
+	if campaign != nil {
+		if campaign.PerUserLimit > 0 && req.CustomerID == "" {
+			return failed(apierr.Invalid("customer_id"))
+		}
+		campaignID = campaign.ID
+		amount = salePrice
+	}
+
+	order := common.Order{
+		OrderID:    workflowID,
+		Amount:     amount,
+		Items:      req.Items,
+		CustomerID: req.CustomerID,
+		Campaign:   campaignID,
+
+		ShippingAddress: req.ShippingAddress,
+		BillingAddress:  req.BillingAddress,
+
+		ReviewPolicy: &f.reviewPolicy,
+	}
+
+	// 1. 尝试在 Redis 原子扣减，同时写入 Outbox 记录和预占记录
+	// 进程在启动 Workflow 前崩溃时，由 OutboxSweeper 补启动或归还库存
+	// 订单取消/拒绝时 Workflow 释放预占，把库存放回秒杀池
+	payload, _ := json.Marshal(order)
+	now := time.Now()
+	entry := store.OutboxEntry{OrderID: workflowID, SKU: targetProduct, Amount: 1, Campaign: campaignID, CustomerID: req.CustomerID, Payload: payload, CreatedAt: now}
+	result, err := f.store.DeductStockWithOutbox(ctx, entry, now.Add(f.reservationTTL))
+	if err != nil {
+		return failed(storeError(err))
+	}
+
+	// 2. 判断结果
+	if result == 0 {
+		// 库存不足 -> 拦截！不请求 Temporal，不查 MySQL
+		f.soldOut.MarkSoldOut(targetProduct)
+		return failed(apierr.New(apierr.OutOfStock))
+	} else if result == -1 && campaign != nil {
+		// 活动未开始、已暂停或已结束
+		return failed(apierr.New(apierr.CampaignNotLive))
+	} else if result == -1 {
+		// 没预热 -> 拒绝或者是普通商品
+		return failed(apierr.New(apierr.NotInFlashSale))
+	} else if result == -2 {
+		// 超过活动限购
+		return failed(apierr.New(apierr.LimitReached))
+	}
+
+	// result == 1 -> 抢到了！放行进入后端逻辑
+	// result == 2 -> 同一订单的重试，之前的请求已扣减过，直接继续启动
+
+	// === 🌊 放行：进入准入队列，按 Temporal 能承受的速率启动 Workflow ===
+	// 立即返回订单号 (202)，Workflow 稍后启动；启动失败由 OutboxSweeper 补启动
+	if err := f.admission.Submit(order); err != nil {
+		// 队列已满：本次新扣减的库存还回去 (与 Sweeper 互斥，只归还一次)
+		if result == 1 {
+			if _, rbErr := f.store.ReleaseReservation(context.Background(), targetProduct, workflowID); rbErr != nil {
+				log.Printf("库存归还失败，留给 Outbox Sweeper 处理: %v", rbErr)
+			}
+		}
+		return queueFull(f.admission)
+	}
+	return succeeded(acceptedResponse(workflowID))
+}
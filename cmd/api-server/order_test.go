@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+)
+
+func TestOrderFunnel_ReplayWhenQueueSaturated(t *testing.T) {
+	env := newTestEnv(t)
+	env.preheat(t, "iPhone15", 5)
+	ctx := context.Background()
+	req := createOrderRequest{Amount: 100, Items: []string{"iPhone15"}, CustomerID: "C1"}
+
+	first := env.funnel.place(ctx, req, "k1")
+	require.Nil(t, first.Err)
+	assert.Equal(t, http.StatusAccepted, first.Status)
+
+	// 准入队列排满：新订单被拒绝，已受理的重试仍回放首个响应
+	for !env.admission.Saturated() {
+		require.NoError(t, env.admission.Submit(common.Order{OrderID: "FILLER"}))
+	}
+	again := env.funnel.place(ctx, req, "k1")
+	require.Nil(t, again.Err)
+	assert.True(t, again.Replayed)
+	assert.Equal(t, first.Status, again.Status)
+	assert.JSONEq(t, string(first.Body), string(again.Body))
+
+	full := env.funnel.place(ctx, req, "k2")
+	require.NotNil(t, full.Err)
+	assert.Equal(t, apierr.QueueFull, full.Err.Code)
+	assert.Positive(t, full.RetryAfter)
+	assert.Equal(t, 4, env.stock(t, "iPhone15"), "排满时不扣减库存")
+}
+
+func TestOrderFunnel_ReplayWhileBreakerOpen(t *testing.T) {
+	ctx := context.Background()
+	req := createOrderRequest{Amount: 100, Items: []string{"iPhone15"}, CustomerID: "C1"}
+
+	t.Run("queue", func(t *testing.T) {
+		// 排队等 Redis 恢复后补查幂等记录：回放首个响应，不重复扣减
+		env := newTestEnvWithBreaker(t, 200*time.Millisecond)
+		env.preheat(t, "iPhone15", 5)
+		env.funnel.degrade.def = degradeQueue
+		first := env.funnel.place(ctx, req, "k1")
+		require.Nil(t, first.Err)
+
+		env.tripBreaker(t)
+		again := env.funnel.place(ctx, req, "k1")
+		require.Nil(t, again.Err)
+		assert.True(t, again.Replayed)
+		assert.JSONEq(t, string(first.Body), string(again.Body))
+		assert.Equal(t, 4, env.stock(t, "iPhone15"))
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		// 熔断中查不到幂等记录：MySQL 降级按固定的 Workflow ID 去重，重试返回已启动的订单
+		env := newTestEnv(t)
+		env.funnel.degrade.def = degradeMySQL
+		env.tripBreaker(t)
+
+		workflowID := idempotentWorkflowID("C1", "k1")
+		run := &mocks.WorkflowRun{}
+		run.On("GetRunID").Return("RUN-1")
+		sameID := mock.MatchedBy(func(o client.StartWorkflowOptions) bool { return o.ID == workflowID })
+		env.client.On("ExecuteWorkflow", mock.Anything, sameID, mock.Anything, mock.Anything).Return(run, nil).Once()
+		env.client.On("ExecuteWorkflow", mock.Anything, sameID, mock.Anything, mock.Anything).
+			Return(nil, serviceerror.NewWorkflowExecutionAlreadyStarted("already started", "", "RUN-1")).Once()
+
+		first := env.funnel.place(ctx, req, "k1")
+		require.Nil(t, first.Err)
+		assert.False(t, first.Replayed)
+		again := env.funnel.place(ctx, req, "k1")
+		require.Nil(t, again.Err)
+		assert.True(t, again.Replayed)
+		assert.JSONEq(t, string(first.Body), string(again.Body))
+		env.client.AssertExpectations(t)
+	})
+}
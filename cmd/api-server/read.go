@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"omniflow/internal/app"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+	"omniflow/internal/pkg/auth"
+)
+
+// orderDetail 订单详情 (HTTP 与 gRPC 共用)
+type orderDetail struct {
+	Record          app.OrderRecord
+	Lines           []app.OrderLine
+	ShippingAddress *common.Address
+}
+
+// loadOrder 从 MySQL 读模型查询订单详情 (不依赖 Temporal，保留期后仍可查)
+func loadOrder(ctx context.Context, db *gorm.DB, orderID string) (*orderDetail, *apierr.Error) {
+	var d orderDetail
+	err := db.WithContext(ctx).First(&d.Record, "order_id = ?", orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apierr.New(apierr.NotFound)
+	} else if err != nil {
+		return nil, apierr.New(apierr.Internal)
+	}
+	if err := db.WithContext(ctx).Where("order_id = ?", d.Record.OrderID).Find(&d.Lines).Error; err != nil {
+		return nil, apierr.New(apierr.Internal)
+	}
+	if d.Record.ShippingAddress != "" {
+		_ = json.Unmarshal([]byte(d.Record.ShippingAddress), &d.ShippingAddress)
+	}
+	return &d, nil
+}
+
+// getOrderHandler 订单详情
+func getOrderHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d, apiErr := loadOrder(c.Request.Context(), db, c.Param("id"))
+		if apiErr != nil {
+			abortWithError(c, apiErr)
+			return
+		}
+		items := make([]gin.H, 0, len(d.Lines))
+		for _, l := range d.Lines {
+			items = append(items, gin.H{"sku": l.SKU, "quantity": l.Quantity})
+		}
+
+		record := d.Record
+		resp := gin.H{
+			"order_id":         record.OrderID,
+			"customer_id":      record.CustomerID,
+			"campaign":         record.Campaign,
+			"amount":           record.Amount,
+			"status":           record.Status,
+			"status_label":     record.StatusLabel,
+			"shipping_address": d.ShippingAddress,
+			"lines":            items,
+			"created_at":       record.CreatedAt,
+			"updated_at":       record.UpdatedAt,
+		}
+		// 风控结论与命中原因只对审核员/管理员展示
+		if staffClaims(auth.FromContext(c)) && record.RiskVerdict != "" {
+			var reasons []string
+			_ = json.Unmarshal([]byte(record.RiskReasons), &reasons)
+			resp["risk_verdict"] = record.RiskVerdict
+			resp["risk_reasons"] = reasons
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// getOrderHistoryHandler 订单状态流转历史 (order_events)
+func getOrderHistoryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var events []app.OrderEventRecord
+		if err := db.WithContext(c.Request.Context()).
+			Where("order_id = ?", c.Param("id")).Order("seq").Find(&events).Error; err != nil {
+			abortWithError(c, apierr.New(apierr.Internal))
+			return
+		}
+		if len(events) == 0 {
+			abortWithError(c, apierr.New(apierr.NotFound))
+			return
+		}
+
+		history := make([]gin.H, 0, len(events))
+		for _, e := range events {
+			history = append(history, gin.H{"seq": e.Seq, "status": e.Status, "status_label": e.StatusLabel, "reason": e.Reason, "occurred_at": e.OccurredAt})
+		}
+		c.JSON(http.StatusOK, gin.H{"order_id": c.Param("id"), "history": history})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/apierr"
+)
+
+// changeShippingAddressHandler 同步修改收货地址 (Update)，返回校验结果
+func changeShippingAddressHandler(temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var addr common.Address
+		if err := c.ShouldBindJSON(&addr); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+
+		var result common.Address
+		if err := updateOrder(c, temporalClient, "change_shipping_address", addr, &result); err != nil {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"accepted": true, "order_id": c.Param("id"), "shipping_address": result})
+	}
+}
+
+// removeLineHandler 同步删除一个商品行 (Update)，返回剩余商品
+func removeLineHandler(temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var items []string
+		if err := updateOrder(c, temporalClient, "remove_line", c.Param("sku"), &items); err != nil {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"accepted": true, "order_id": c.Param("id"), "items": items})
+	}
+}
+
+// payOrderHandler 支付待支付的订单 (Update)
+func payOrderHandler(temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			PaymentID string `json:"payment_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+		if err := payOrder(c.Request.Context(), temporalClient, c.Param("id"), req.PaymentID); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"accepted": true, "order_id": c.Param("id")})
+	}
+}
+
+// cancelOrderHandler 取消待支付的订单 (Update)，请求体可省略
+func cancelOrderHandler(temporalClient client.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+		if err := cancelOrder(c.Request.Context(), temporalClient, c.Param("id"), req.Reason); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"accepted": true, "order_id": c.Param("id")})
+	}
+}
+
+// payOrder 支付 (HTTP 与 gRPC 共用)
+func payOrder(ctx context.Context, temporalClient client.Client, orderID, paymentID string) *apierr.Error {
+	if paymentID == "" || len(paymentID) > 128 {
+		return apierr.Invalid("payment_id")
+	}
+	return runUpdate(ctx, temporalClient, orderID, "pay_order", paymentID, nil)
+}
+
+// cancelOrder 取消 (HTTP 与 gRPC 共用)，原因为空时由 Workflow 填默认值
+func cancelOrder(ctx context.Context, temporalClient client.Client, orderID, reason string) *apierr.Error {
+	if len(reason) > 256 {
+		return apierr.Invalid("reason")
+	}
+	return runUpdate(ctx, temporalClient, orderID, "cancel_order", reason, nil)
+}
+
+// updateOrder 发送 Update 并等待执行完成；失败时已写好响应
+func updateOrder(c *gin.Context, temporalClient client.Client, name string, arg interface{}, result interface{}) error {
+	if err := runUpdate(c.Request.Context(), temporalClient, c.Param("id"), name, arg, result); err != nil {
+		abortWithError(c, err)
+		return err
+	}
+	return nil
+}
+
+// runUpdate 发送 Update 并等待执行完成 (HTTP 与 gRPC 共用)
+// 校验器拒绝 -> 409 ORDER_NOT_MODIFIABLE，原因放在 detail；订单不存在 -> 404
+func runUpdate(ctx context.Context, temporalClient client.Client, orderID, name string, arg interface{}, result interface{}) *apierr.Error {
+	handle, err := temporalClient.UpdateWorkflow(ctx, client.UpdateWorkflowOptions{
+		WorkflowID:   orderID,
+		UpdateName:   name,
+		Args:         []interface{}{arg},
+		WaitForStage: client.WorkflowUpdateStageCompleted,
+	})
+	if err == nil {
+		err = handle.Get(ctx, result)
+	}
+	if err == nil {
+		return nil
+	}
+
+	var notFound *serviceerror.NotFound
+	var appErr *temporal.ApplicationError
+	switch {
+	case errors.As(err, &notFound):
+		return apierr.New(apierr.NotFound)
+	case errors.As(err, &appErr):
+		return apierr.New(apierr.OrderNotModifiable).WithDetail(appErr.Message())
+	default:
+		return apierr.New(apierr.Internal)
+	}
+}
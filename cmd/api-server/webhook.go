@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"omniflow/internal/app"
+	"omniflow/internal/pkg/apierr"
+)
+
+// webhookResponse 订阅详情 (密钥只在创建时返回)
+func webhookResponse(s *app.WebhookSubscription) gin.H {
+	return gin.H{
+		"id":          s.ID,
+		"url":         s.URL,
+		"event_types": s.Events(),
+		"active":      s.Active,
+		"created_at":  s.CreatedAt,
+	}
+}
+
+func deliveryResponse(d *app.WebhookDelivery) gin.H {
+	return gin.H{
+		"id":               d.ID,
+		"subscription_id":  d.SubscriptionID,
+		"event_id":         d.EventID,
+		"event_type":       d.EventType,
+		"order_id":         d.OrderID,
+		"status":           d.Status,
+		"attempts":         d.Attempts,
+		"last_status_code": d.LastStatusCode,
+		"last_error":       d.LastError,
+		"replay_of":        d.ReplayOf,
+		"delivered_at":     d.DeliveredAt,
+		"created_at":       d.CreatedAt,
+	}
+}
+
+// abortWithWebhookError Webhook 服务错误 -> API 错误
+func abortWithWebhookError(c *gin.Context, err error) {
+	var inputErr *app.WebhookInputError
+	switch {
+	case errors.As(err, &inputErr):
+		apiErr := apierr.Invalid(inputErr.Field)
+		if inputErr.Reason != "" {
+			apiErr = apiErr.WithDetail(inputErr.Reason)
+		}
+		abortWithError(c, apiErr)
+	case errors.Is(err, app.ErrWebhookNotFound):
+		abortWithError(c, apierr.New(apierr.WebhookNotFound))
+	case errors.Is(err, app.ErrDeliveryInProgress):
+		abortWithError(c, apierr.New(apierr.DeliveryInProgress))
+	default:
+		log.Printf("Webhook 操作失败: %v", err)
+		abortWithError(c, apierr.New(apierr.Internal))
+	}
+}
+
+// paramID 路径中的数字 ID
+func paramID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		abortWithError(c, apierr.New(apierr.WebhookNotFound))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// createWebhookHandler 创建订阅；未指定 secret 时生成，响应中返回 (之后不再返回)
+func createWebhookHandler(webhooks *app.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			URL        string   `json:"url"`
+			Secret     string   `json:"secret"`
+			EventTypes []string `json:"event_types"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, apierr.New(apierr.InvalidRequest))
+			return
+		}
+		sub, err := webhooks.Create(c.Request.Context(), req.URL, req.Secret, req.EventTypes)
+		if err != nil {
+			abortWithWebhookError(c, err)
+			return
+		}
+		body := webhookResponse(sub)
+		body["secret"] = sub.Secret
+		c.JSON(http.StatusCreated, body)
+	}
+}
+
+// listWebhooksHandler 所有订阅与可订阅的事件类型
+func listWebhooksHandler(webhooks *app.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subs, err := webhooks.List(c.Request.Context())
+		if err != nil {
+			abortWithWebhookError(c, err)
+			return
+		}
+		items := make([]gin.H, 0, len(subs))
+		for i := range subs {
+			items = append(items, webhookResponse(&subs[i]))
+		}
+		c.JSON(http.StatusOK, gin.H{"items": items, "event_types": app.WebhookEventTypes()})
+	}
+}
+
+// deleteWebhookHandler 停用订阅 (投递记录保留)
+func deleteWebhookHandler(webhooks *app.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := paramID(c)
+		if !ok {
+			return
+		}
+		sub, err := webhooks.Deactivate(c.Request.Context(), id)
+		if err != nil {
+			abortWithWebhookError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, webhookResponse(sub))
+	}
+}
+
+// listDeliveriesHandler 最近的投递记录，?status=DEAD 查看死信
+func listDeliveriesHandler(webhooks *app.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 50
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 500 {
+				abortWithError(c, apierr.Invalid("limit"))
+				return
+			}
+			limit = n
+		}
+		deliveries, err := webhooks.Deliveries(c.Request.Context(), app.WebhookDeliveryStatus(c.Query("status")), limit)
+		if err != nil {
+			abortWithWebhookError(c, err)
+			return
+		}
+		items := make([]gin.H, 0, len(deliveries))
+		for i := range deliveries {
+			items = append(items, deliveryResponse(&deliveries[i]))
+		}
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
+
+// replayDeliveryHandler 重放一条投递 (通常是死信)，事件 ID 与请求体不变
+func replayDeliveryHandler(webhooks *app.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := paramID(c)
+		if !ok {
+			return
+		}
+		replay, err := webhooks.Replay(c.Request.Context(), id)
+		if err != nil {
+			abortWithWebhookError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, deliveryResponse(replay))
+	}
+}
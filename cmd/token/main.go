@@ -0,0 +1,45 @@
+// token 本地开发与压测用的 Token 签发工具 (HS256，密钥取自 JWT_SECRET)
+//
+//	JWT_SECRET=dev-secret go run ./cmd/token -sub C1 -roles customer
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"omniflow/internal/pkg/auth"
+)
+
+func main() {
+	sub := flag.String("sub", "C1", "客户 ID")
+	roles := flag.String("roles", auth.RoleCustomer, "角色，逗号分隔 (customer / reviewer / admin)")
+	kid := flag.String("kid", "hs-2026", "密钥 kid，与 config/auth/keys.yaml 一致")
+	ttl := flag.Duration("ttl", 24*time.Hour, "有效期")
+	flag.Parse()
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		log.Fatalln("请设置 JWT_SECRET")
+	}
+	now := time.Now()
+	token, err := auth.Sign(auth.Claims{
+		Roles: strings.Split(*roles, ","),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   *sub,
+			Issuer:    "omniflow",
+			Audience:  jwt.ClaimStrings{"omniflow-api"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(*ttl)),
+		},
+	}, *kid, jwt.SigningMethodHS256, []byte(secret))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Println(token)
+}
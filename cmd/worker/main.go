@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"omniflow/internal/app"
 	"omniflow/internal/common"
 	"omniflow/internal/pkg/dedup"
+	"omniflow/internal/pkg/pubsub"
+	"omniflow/internal/pkg/risk"
+	"omniflow/internal/pkg/store"
+	"os"
 	"time"
 
 	// Prometheus 官方库
@@ -66,10 +71,32 @@ func main() {
 		log.Fatalln("MySQL 连接失败:", err)
 	}
 
-	db.AutoMigrate(&app.Product{})
+	db.AutoMigrate(&app.Product{}, &app.Customer{}, &app.RiskOrderLog{})
+	db.AutoMigrate(app.ReadModels()...)
+	db.AutoMigrate(app.CampaignModels()...)
+	db.AutoMigrate(app.InventoryModels()...)
+	db.AutoMigrate(app.WebhookModels()...)
 	dedup.AutoMigrate(db)
 	initData(db)
 
+	// 风控规则 (YAML，运行期间热加载)
+	rulesFile := os.Getenv("RISK_RULES_FILE")
+	if rulesFile == "" {
+		rulesFile = "config/risk/rules.yaml"
+	}
+	riskRules, err := risk.NewReloader(rulesFile)
+	if err != nil {
+		log.Fatalln("风控规则加载失败:", err)
+	}
+	go riskRules.Watch(context.Background(), 5*time.Second)
+
+	// 秒杀预占与活动库存在 Redis 中 (订单取消时归还、支付后确认，活动开始时预热)
+	redisStore, err := store.New(context.Background(), store.OptionsFromEnv())
+	if err != nil {
+		log.Fatalln("Redis 连接失败:", err)
+	}
+	defer redisStore.Close()
+
 	// 4. 连接 Temporal (注入适配后的 MetricsHandler)
 	// -----------------------------------------------------
 	c, err := client.Dial(client.Options{
@@ -86,8 +113,18 @@ func main() {
 	w := worker.New(c, common.TaskQueue, worker.Options{})
 	w.RegisterWorkflow(app.OrderFulfillmentWorkflow)
 	w.RegisterWorkflow(app.ShippingChildWorkflow)
+	w.RegisterWorkflow(app.CampaignStartWorkflow)
+	w.RegisterWorkflow(app.CampaignEndWorkflow)
+	w.RegisterWorkflow(app.WebhookDeliveryWorkflow)
 	w.RegisterActivity(&app.InventoryActivities{DB: db})
 	w.RegisterActivity(&app.ShippingActivities{})
+	w.RegisterActivity(&app.NotificationActivities{})
+	w.RegisterActivity(&app.RiskActivities{DB: db, Rules: riskRules})
+	// 状态流转写入读模型后通过 Redis Pub/Sub 推送给 api-server (SSE)
+	w.RegisterActivity(&app.ProjectionActivities{DB: db, Events: pubsub.NewRedis(redisStore.Client)})
+	w.RegisterActivity(&app.FlashSaleActivities{Store: redisStore})
+	w.RegisterActivity(&app.CampaignActivities{DB: db, Store: redisStore})
+	w.RegisterActivity(&app.WebhookActivities{DB: db})
 
 	log.Println("Worker 已启动...")
 	w.Run(worker.InterruptCh())
@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"omniflow/internal/common"
 	"omniflow/internal/pkg/dedup"
@@ -71,6 +72,56 @@ func (a *InventoryActivities) ReleaseInventory(ctx context.Context, order common
 	})
 }
 
+// 3. 释放单个商品行 (订单修改，幂等)
+func (a *InventoryActivities) ReleaseLine(ctx context.Context, req common.LineRelease) error {
+	idemKey := fmt.Sprintf("order_%s_release_line_%s", req.OrderID, req.RequestID)
+	fmt.Printf("🔄 [Inventory] 请求释放商品行: %s / %s\n", req.OrderID, req.SKU)
+
+	return dedup.Execute(a.DB, idemKey, func(tx *gorm.DB) error {
+		return tx.Model(&Product{}).Where("id = ?", req.SKU).
+			Update("stock", gorm.Expr("stock + ?", 1)).Error
+	})
+}
+
+// 4. 后台调整库存 (幂等 + 悲观锁，与预占走同一条路径)，调整记录与库存在同一个事务中写入
+func (a *InventoryActivities) AdjustStock(ctx context.Context, adj common.StockAdjustment) error {
+	idemKey := fmt.Sprintf("stock_adjust_%s", adj.RequestID)
+	fmt.Printf("📦 [Inventory] 请求调整库存: %s %+d (%s)\n", adj.SKU, adj.Delta, adj.Reason)
+
+	return dedup.Execute(a.DB.WithContext(ctx), idemKey, func(tx *gorm.DB) error {
+		return adjustStock(tx, adj)
+	})
+}
+
+func adjustStock(tx *gorm.DB, adj common.StockAdjustment) error {
+	var product Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&product, "id = ?", adj.SKU).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+	if product.Stock+adj.Delta < 0 {
+		return ErrStockNegative
+	}
+
+	before := product.Stock
+	product.Stock += adj.Delta
+	if err := tx.Save(&product).Error; err != nil {
+		return err
+	}
+	return tx.Create(&StockAdjustmentLog{
+		RequestID:   adj.RequestID,
+		SKU:         adj.SKU,
+		Delta:       adj.Delta,
+		Reason:      adj.Reason,
+		Operator:    adj.Operator,
+		StockBefore: before,
+		StockAfter:  product.Stock,
+	}).Error
+}
+
 // --- 简单的发货 Activity ---
 type ShippingActivities struct{}
 
@@ -79,3 +130,12 @@ func (a *ShippingActivities) GenerateShippingLabel(ctx context.Context, shipment
 	label := fmt.Sprintf("SF-%s-%d", shipment.Warehouse, time.Now().UnixMilli())
 	return label, nil
 }
+
+// --- 审核通知 Activity ---
+type NotificationActivities struct{}
+
+// NotifyReviewers 向审核组发送催办/升级通知 (当前仅打印，后续可接入 IM/邮件)
+func (a *NotificationActivities) NotifyReviewers(ctx context.Context, notice common.ReviewNotice) error {
+	fmt.Printf("🔔 [Review] %s -> %s: 订单 %s 已等待 %s\n", notice.Kind, notice.Group, notice.OrderID, notice.Waited)
+	return nil
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"omniflow/internal/pkg/store"
+)
+
+// CampaignActivities 活动开始时发布到 Redis，结束时关闭并对账
+// 两个操作都可以安全重试：预热只执行一次，对账以 Redis 剩余库存为准
+type CampaignActivities struct {
+	DB    *gorm.DB
+	Store store.StockStore
+}
+
+// ActivateCampaign 活动开始：SCHEDULED -> LIVE，并把活动信息、售价、库存发布到 Redis
+// 开始前已被暂停的活动照常预热库存，但保持 PAUSED，等待恢复
+func (a *CampaignActivities) ActivateCampaign(ctx context.Context, id string) error {
+	var c Campaign
+	if err := a.DB.WithContext(ctx).Preload("Allocations").First(&c, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if c.State == CampaignEnded {
+		return nil
+	}
+	if c.State == CampaignScheduled {
+		c.State = CampaignLive
+		if err := a.DB.WithContext(ctx).Model(&c).Update("state", c.State).Error; err != nil {
+			return err
+		}
+	}
+
+	allocations := make([]store.CampaignAllocation, 0, len(c.Allocations))
+	for _, al := range c.Allocations {
+		allocations = append(allocations, store.CampaignAllocation{SKU: al.SKU, Quantity: al.Quantity, SalePrice: al.SalePrice})
+	}
+	preheated, err := a.Store.PublishCampaign(ctx, store.CampaignMeta{
+		ID:           c.ID,
+		State:        string(c.State),
+		StartAt:      c.StartAt,
+		EndAt:        c.EndAt,
+		PerUserLimit: c.PerUserLimit,
+	}, allocations)
+	if err != nil {
+		return err
+	}
+	if preheated {
+		fmt.Printf("🔥 [Campaign] 活动已开始，库存预热完成: %s (%d 个 SKU)\n", c.ID, len(allocations))
+	}
+	return nil
+}
+
+// ErrReservationsPending 活动结束时的预占还没有全部确认或释放，稍后重试对账
+var ErrReservationsPending = errors.New("活动仍有未结束的预占")
+
+// EndCampaign 活动结束：状态置为 ENDED，按 Redis 剩余库存与未结束的预占记录每个 SKU 的剩余、售出与待定
+// 待定的预占之后可能确认 (售出) 也可能释放 (未售出)，由 SettleCampaign 最终对账
+func (a *CampaignActivities) EndCampaign(ctx context.Context, id string) error {
+	var c Campaign
+	err := a.DB.WithContext(ctx).Preload("Allocations").First(&c, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// 先关闭漏斗再读库存，保证读到的是最终值
+	published, err := a.Store.SetCampaignState(ctx, id, c.SKUs(), string(CampaignEnded))
+	if err != nil {
+		return err
+	}
+
+	return a.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&c).Update("state", CampaignEnded).Error; err != nil {
+			return err
+		}
+		if !published {
+			// 从未发布 (开始前就结束)，库存原样未动
+			return nil
+		}
+		for _, al := range c.Allocations {
+			remaining, err := a.Store.CampaignStock(ctx, al.SKU)
+			if err != nil {
+				return err
+			}
+			pending, err := a.Store.ReservedStock(ctx, al.SKU)
+			if err != nil {
+				return err
+			}
+			remaining = min(remaining, al.Quantity)
+			pending = min(pending, al.Quantity-remaining)
+			sold := al.Quantity - remaining - pending
+			if err := tx.Model(&al).Updates(map[string]interface{}{"remaining": remaining, "sold": sold, "pending": pending}).Error; err != nil {
+				return err
+			}
+			fmt.Printf("📊 [Campaign] 活动 %s 对账: %s 售出 %d，剩余 %d，待定 %d\n", id, al.SKU, sold, remaining, pending)
+		}
+		return nil
+	})
+}
+
+// SettleCampaign 活动结束后的最终对账：等所有待定预占确认或释放 (过期由 ReservationSweeper 处理) 后，
+// 按 Redis 剩余库存重算售出与剩余。仍有预占时返回 ErrReservationsPending，由 Workflow 按重试策略稍后再试
+//
+// 漏斗已关闭，剩余库存只会因释放预占而增加。未售出的件数不需要写回 products.stock：
+// MySQL 库存只在订单 ReserveInventory 时扣减，订单取消/过期时 ReleaseInventory 已经归还
+func (a *CampaignActivities) SettleCampaign(ctx context.Context, id string) error {
+	var c Campaign
+	err := a.DB.WithContext(ctx).Preload("Allocations").First(&c, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, al := range c.Allocations {
+		if al.Pending == 0 {
+			continue
+		}
+		reserved, err := a.Store.ReservedStock(ctx, al.SKU)
+		if err != nil {
+			return err
+		}
+		if reserved > 0 {
+			return fmt.Errorf("%w: %s 还有 %d 件", ErrReservationsPending, al.SKU, reserved)
+		}
+		remaining, err := a.Store.CampaignStock(ctx, al.SKU)
+		if err != nil {
+			return err
+		}
+		remaining = min(remaining, al.Quantity)
+		sold := al.Quantity - remaining
+		if err := a.DB.WithContext(ctx).Model(&al).Updates(map[string]interface{}{"remaining": remaining, "sold": sold, "pending": 0}).Error; err != nil {
+			return err
+		}
+		fmt.Printf("📊 [Campaign] 活动 %s 最终对账: %s 售出 %d，剩余 %d\n", id, al.SKU, sold, remaining)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"omniflow/internal/pkg/store"
+)
+
+// FlashSaleActivities 秒杀预占 (Redis) 的确认与释放
+// 两个操作都是幂等的：预占不存在 (非秒杀订单 / 已处理) 时直接返回
+// sku 是后加的参数：旧 Workflow 调度的 Activity 没有 SKU，直接跳过，预占过期后由 ReservationSweeper 按订单结果处理
+type FlashSaleActivities struct {
+	Store store.StockStore
+}
+
+// ReleaseReservation 订单取消/拒绝/失败时把秒杀库存放回 Redis
+func (a *FlashSaleActivities) ReleaseReservation(ctx context.Context, orderID, sku string) error {
+	if sku == "" {
+		return nil
+	}
+	released, err := a.Store.ReleaseReservation(ctx, sku, orderID)
+	if err != nil {
+		return err
+	}
+	if released {
+		fmt.Printf("🔄 [FlashSale] 秒杀库存已归还: %s\n", orderID)
+	}
+	return nil
+}
+
+// ConfirmReservation 支付成功，预占转为售出
+func (a *FlashSaleActivities) ConfirmReservation(ctx context.Context, orderID, sku string) error {
+	if sku == "" {
+		return nil
+	}
+	return a.Store.ConfirmReservation(ctx, sku, orderID)
+}
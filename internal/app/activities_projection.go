@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/dedup"
+	"omniflow/internal/pkg/pubsub"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrderRecord 订单读模型 (orders 表)，由 Workflow 状态流转投影而来
+type OrderRecord struct {
+	OrderID         string `gorm:"primaryKey;type:varchar(64)"`
+	CustomerID      string `gorm:"index;type:varchar(64)"`
+	Campaign        string `gorm:"index;type:varchar(64)"`
+	Amount          int
+	Status          string `gorm:"index;type:varchar(32)"`
+	StatusLabel     string
+	ShippingAddress string `gorm:"type:text"` // JSON
+	RiskVerdict     string `gorm:"index;type:varchar(16)"`
+	RiskReasons     string `gorm:"type:text"` // JSON 数组，风控命中原因
+	LastSeq         int    // 已投影的最新事件序号，防止乱序覆盖
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (OrderRecord) TableName() string { return "orders" }
+
+// OrderLine 订单商品行 (order_lines 表)
+type OrderLine struct {
+	ID       uint   `gorm:"primaryKey"`
+	OrderID  string `gorm:"index;type:varchar(64)"`
+	SKU      string `gorm:"type:varchar(64)"`
+	Quantity int
+}
+
+func (OrderLine) TableName() string { return "order_lines" }
+
+// OrderRiskRule 订单命中的风控规则 (order_risk_rules 表)，按规则统计、筛选订单
+type OrderRiskRule struct {
+	ID      uint   `gorm:"primaryKey"`
+	OrderID string `gorm:"index;type:varchar(64)"`
+	Rule    string `gorm:"index;type:varchar(64)"`
+}
+
+func (OrderRiskRule) TableName() string { return "order_risk_rules" }
+
+// OrderEventRecord 订单状态流转历史 (order_events 表)
+type OrderEventRecord struct {
+	ID          uint   `gorm:"primaryKey"`
+	OrderID     string `gorm:"uniqueIndex:idx_order_seq;type:varchar(64)"`
+	Seq         int    `gorm:"uniqueIndex:idx_order_seq"`
+	Status      string `gorm:"type:varchar(32)"`
+	StatusLabel string
+	Reason      string
+	OccurredAt  time.Time
+}
+
+func (OrderEventRecord) TableName() string { return "order_events" }
+
+// ReadModels 读模型全部表，供 AutoMigrate 使用
+func ReadModels() []interface{} {
+	return []interface{}{&OrderRecord{}, &OrderLine{}, &OrderEventRecord{}, &OrderRiskRule{}}
+}
+
+// OrderEventMessage 推送给订阅方 (SSE) 的状态流转，与 order_events 表一一对应
+type OrderEventMessage struct {
+	OrderID    string    `json:"order_id"`
+	CustomerID string    `json:"customer_id,omitempty"` // 订阅方校验归属用，推送给客户端前清空
+	Seq        int       `json:"seq"`
+	Status     string    `json:"status"`
+	Label      string    `json:"status_label"`
+	Reason     string    `json:"reason,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// OrderEventsTopic 订单状态流转的推送 topic
+func OrderEventsTopic(orderID string) string {
+	return "order:" + orderID
+}
+
+type ProjectionActivities struct {
+	DB     *gorm.DB
+	Events pubsub.Bus // 为空时不推送
+}
+
+// ProjectOrderEvent 把一次状态流转写入读模型 (幂等：同一订单同一序号只写一次)
+// 提交后推送给订阅方；推送尽力而为 (失败只记日志)，订阅方按序号去重并从读模型补齐
+func (a *ProjectionActivities) ProjectOrderEvent(ctx context.Context, event common.OrderEvent) error {
+	idemKey := fmt.Sprintf("order_%s_event_%d", event.OrderID, event.Seq)
+
+	if err := a.project(idemKey, event); err != nil {
+		return err
+	}
+	if a.Events != nil {
+		msg, _ := json.Marshal(OrderEventMessage{
+			OrderID:    event.OrderID,
+			CustomerID: event.Order.CustomerID,
+			Seq:        event.Seq,
+			Status:     event.Status,
+			Label:      event.Label,
+			Reason:     event.Reason,
+			OccurredAt: event.OccurredAt,
+		})
+		if err := a.Events.Publish(ctx, OrderEventsTopic(event.OrderID), msg); err != nil {
+			log.Printf("⚠️ 订单事件推送失败 %s #%d: %v", event.OrderID, event.Seq, err)
+		}
+	}
+	return nil
+}
+
+func (a *ProjectionActivities) project(idemKey string, event common.OrderEvent) error {
+	return dedup.Execute(a.DB, idemKey, func(tx *gorm.DB) error {
+		if err := tx.Create(&OrderEventRecord{
+			OrderID:     event.OrderID,
+			Seq:         event.Seq,
+			Status:      event.Status,
+			StatusLabel: event.Label,
+			Reason:      event.Reason,
+			OccurredAt:  event.OccurredAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		var addr []byte
+		if event.Order.ShippingAddress != nil {
+			addr, _ = json.Marshal(event.Order.ShippingAddress)
+		}
+		var verdict, reasons string
+		if event.Risk != nil {
+			raw, _ := json.Marshal(event.Risk.Reasons)
+			verdict, reasons = event.Risk.Verdict, string(raw)
+		}
+		record := OrderRecord{
+			OrderID:         event.OrderID,
+			CustomerID:      event.Order.CustomerID,
+			Campaign:        event.Order.Campaign,
+			Amount:          event.Order.Amount,
+			Status:          event.Status,
+			StatusLabel:     event.Label,
+			ShippingAddress: string(addr),
+			RiskVerdict:     verdict,
+			RiskReasons:     reasons,
+			LastSeq:         event.Seq,
+			CreatedAt:       event.OccurredAt,
+			UpdatedAt:       event.OccurredAt,
+		}
+		ins := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if ins.Error != nil {
+			return ins.Error
+		}
+		if ins.RowsAffected == 0 {
+			// 已存在：只接受更新的序号，旧事件只记入历史
+			updates := map[string]interface{}{
+				"status":           event.Status,
+				"status_label":     event.Label,
+				"amount":           event.Order.Amount,
+				"shipping_address": string(addr),
+				"last_seq":         event.Seq,
+				"updated_at":       event.OccurredAt,
+			}
+			if event.Risk != nil {
+				updates["risk_verdict"], updates["risk_reasons"] = verdict, reasons
+			}
+			res := tx.Model(&OrderRecord{}).
+				Where("order_id = ? AND last_seq < ?", event.OrderID, event.Seq).
+				Updates(updates)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+		}
+
+		// 商品行以最新快照为准
+		if err := tx.Where("order_id = ?", event.OrderID).Delete(&OrderLine{}).Error; err != nil {
+			return err
+		}
+		quantities := map[string]int{}
+		var skus []string
+		for _, sku := range event.Order.Items {
+			if quantities[sku] == 0 {
+				skus = append(skus, sku)
+			}
+			quantities[sku]++
+		}
+		for _, sku := range skus {
+			if err := tx.Create(&OrderLine{OrderID: event.OrderID, SKU: sku, Quantity: quantities[sku]}).Error; err != nil {
+				return err
+			}
+		}
+
+		// 命中的风控规则 (风控评估之前的事件不带结论，保持不变)
+		if event.Risk == nil {
+			return nil
+		}
+		if err := tx.Where("order_id = ?", event.OrderID).Delete(&OrderRiskRule{}).Error; err != nil {
+			return err
+		}
+		for _, rule := range event.Risk.Rules() {
+			if err := tx.Create(&OrderRiskRule{OrderID: event.OrderID, Rule: rule}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
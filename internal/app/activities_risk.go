@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/risk"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Customer 客户档案 (风控用注册时间)
+type Customer struct {
+	ID        string `gorm:"primaryKey;type:varchar(64)"`
+	Name      string
+	CreatedAt time.Time
+}
+
+// RiskOrderLog 风控评估过的订单，用于统计客户下单速度
+type RiskOrderLog struct {
+	OrderID    string `gorm:"primaryKey;type:varchar(64)"`
+	CustomerID string `gorm:"index;type:varchar(64)"`
+	CreatedAt  time.Time
+}
+
+type RiskActivities struct {
+	DB    *gorm.DB
+	Rules *risk.Reloader
+}
+
+// AssessRisk 规则引擎评估订单风险，返回 APPROVE / REVIEW / REJECT 及命中原因
+func (a *RiskActivities) AssessRisk(ctx context.Context, order common.Order) (common.RiskAssessment, error) {
+	engine := a.Rules.Engine()
+	now := time.Now()
+	in := risk.Input{
+		Amount:          order.Amount,
+		Items:           order.Items,
+		CustomerID:      order.CustomerID,
+		ShippingAddress: toRiskAddress(order.ShippingAddress),
+		BillingAddress:  toRiskAddress(order.BillingAddress),
+		Now:             now,
+	}
+
+	if order.CustomerID != "" {
+		// 记录本单 (重试时主键冲突直接忽略)
+		logEntry := RiskOrderLog{OrderID: order.OrderID, CustomerID: order.CustomerID, CreatedAt: now}
+		if err := a.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&logEntry).Error; err != nil {
+			return common.RiskAssessment{}, err
+		}
+
+		if window := engine.Lookback(); window > 0 {
+			if err := a.DB.Model(&RiskOrderLog{}).
+				Where("customer_id = ? AND order_id <> ? AND created_at >= ?", order.CustomerID, order.OrderID, now.Add(-window)).
+				Pluck("created_at", &in.RecentOrders).Error; err != nil {
+				return common.RiskAssessment{}, err
+			}
+		}
+
+		var customer Customer
+		err := a.DB.First(&customer, "id = ?", order.CustomerID).Error
+		if err == nil {
+			in.AccountCreatedAt = customer.CreatedAt
+		} else if err != gorm.ErrRecordNotFound {
+			return common.RiskAssessment{}, err
+		}
+	}
+
+	decision := engine.Evaluate(in)
+	fmt.Printf("🛡️ [Risk] 订单 %s 评估结果: %s %v\n", order.OrderID, decision.Verdict, decision.Reasons)
+	return common.RiskAssessment{Verdict: string(decision.Verdict), Reasons: decision.Reasons}, nil
+}
+
+func toRiskAddress(addr *common.Address) *risk.Address {
+	if addr == nil {
+		return nil
+	}
+	return &risk.Address{Country: addr.Country, City: addr.City}
+}
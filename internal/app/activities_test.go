@@ -2,11 +2,15 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"omniflow/internal/common"
+	"omniflow/internal/pkg/pubsub"
+	"omniflow/internal/pkg/risk"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -25,6 +29,11 @@ func setupTestDB() *gorm.DB {
 
 	// 建表：商品表 + 幂等性日志表
 	db.AutoMigrate(&Product{})
+	db.AutoMigrate(&Customer{}, &RiskOrderLog{})
+	db.AutoMigrate(ReadModels()...)
+	db.AutoMigrate(CampaignModels()...)
+	db.AutoMigrate(InventoryModels()...)
+	db.AutoMigrate(WebhookModels()...)
 	db.AutoMigrate(&testIdempotencyLog{})
 	// 注意：上面的 testIdempotencyLog 表名默认是 test_idempotency_logs
 	// 但我们的 dedup 包里用的是 idempotency_logs
@@ -97,3 +106,95 @@ func TestReserveInventory_Idempotency(t *testing.T) {
 	db.First(&p, "id = ?", "ITEM_X")
 	assert.Equal(t, 9, p.Stock, "幂等性失效：库存被重复扣减")
 }
+
+func TestAssessRisk_Velocity(t *testing.T) {
+	db := setupTestDB()
+	db.Create(&Customer{ID: "CUST_FAST", CreatedAt: time.Now().AddDate(-1, 0, 0)})
+
+	engine, err := risk.Parse([]byte(`
+rules:
+  - name: order_velocity
+    type: velocity
+    window: 1h
+    max_orders: 2
+    action: REVIEW
+`))
+	require.NoError(t, err)
+	rules := risk.NewStaticReloader(engine)
+	acts := &RiskActivities{DB: db, Rules: rules}
+
+	assess := func(orderID string) common.RiskAssessment {
+		res, err := acts.AssessRisk(context.Background(), common.Order{OrderID: orderID, CustomerID: "CUST_FAST", Amount: 100})
+		require.NoError(t, err)
+		return res
+	}
+
+	assert.Equal(t, common.RiskApprove, assess("VEL_1").Verdict)
+	assert.Equal(t, common.RiskApprove, assess("VEL_2").Verdict)
+	// 重试同一订单不会被重复计数
+	assert.Equal(t, common.RiskApprove, assess("VEL_2").Verdict)
+
+	third := assess("VEL_3")
+	assert.Equal(t, common.RiskReview, third.Verdict)
+	assert.Contains(t, third.Reasons[0], "order_velocity")
+}
+
+func TestProjectOrderEvent(t *testing.T) {
+	db := setupTestDB()
+	bus := pubsub.NewMemory()
+	sub := bus.Subscribe(OrderEventsTopic("PROJ_001"))
+	defer sub.Close()
+	acts := &ProjectionActivities{DB: db, Events: bus}
+	ctx := context.Background()
+	now := time.Now()
+
+	order := common.Order{OrderID: "PROJ_001", CustomerID: "C1", Amount: 300, Items: []string{"iPhone15", "AirPods", "AirPods"}}
+	event := func(seq int, status string) common.OrderEvent {
+		return common.OrderEvent{OrderID: order.OrderID, Seq: seq, Status: status, Label: status, OccurredAt: now.Add(time.Duration(seq) * time.Second), Order: order}
+	}
+
+	require.NoError(t, acts.ProjectOrderEvent(ctx, event(1, string(common.StateReserving))))
+	// 重试同一事件不会重复写入
+	require.NoError(t, acts.ProjectOrderEvent(ctx, event(1, string(common.StateReserving))))
+
+	order.Items = []string{"iPhone15"}
+	// 风控评估之后的事件带结论与命中原因
+	reviewed := event(3, string(common.StatePendingPayment))
+	reviewed.Risk = &common.RiskAssessment{Verdict: common.RiskReview, Reasons: []string{"[large_amount] 订单金额超过 10000", "[order_velocity] 1 小时内下单 6 次"}}
+	require.NoError(t, acts.ProjectOrderEvent(ctx, reviewed))
+	// 迟到的旧事件只进历史，不覆盖当前状态
+	require.NoError(t, acts.ProjectOrderEvent(ctx, event(2, string(common.StateRiskCheck))))
+
+	var record OrderRecord
+	require.NoError(t, db.First(&record, "order_id = ?", "PROJ_001").Error)
+	assert.Equal(t, string(common.StatePendingPayment), record.Status)
+	assert.Equal(t, 3, record.LastSeq)
+	assert.Equal(t, "C1", record.CustomerID)
+	assert.Equal(t, common.RiskReview, record.RiskVerdict)
+	assert.JSONEq(t, `["[large_amount] 订单金额超过 10000", "[order_velocity] 1 小时内下单 6 次"]`, record.RiskReasons)
+
+	// 按命中规则查订单
+	var ids []string
+	db.Model(&OrderRiskRule{}).Where("rule = ?", "order_velocity").Pluck("order_id", &ids)
+	assert.Equal(t, []string{"PROJ_001"}, ids)
+
+	var lines []OrderLine
+	db.Where("order_id = ?", "PROJ_001").Find(&lines)
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "iPhone15", lines[0].SKU)
+
+	var events []OrderEventRecord
+	db.Where("order_id = ?", "PROJ_001").Order("seq").Find(&events)
+	assert.Len(t, events, 3)
+	assert.Equal(t, string(common.StateRiskCheck), events[1].Status)
+
+	// 每次投影后推送 (重试会重复推送，订阅方按序号去重)
+	var seqs []int
+	for i := 0; i < 4; i++ {
+		var msg OrderEventMessage
+		require.NoError(t, json.Unmarshal(<-sub.C, &msg))
+		assert.Equal(t, "C1", msg.CustomerID)
+		seqs = append(seqs, msg.Seq)
+	}
+	assert.Equal(t, []int{1, 1, 3, 2}, seqs)
+}
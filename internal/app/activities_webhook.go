@@ -0,0 +1,189 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"gorm.io/gorm"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/dedup"
+	"omniflow/internal/pkg/webhook"
+)
+
+// WebhookMaxAttempts 单次投递最多尝试次数 (Temporal 重试策略与死信判断共用)
+const WebhookMaxAttempts = 8
+
+// webhookRequestTimeout 单次请求超时，需小于投递 Activity 的 StartToCloseTimeout，
+// 保证最后一次尝试能写入死信记录
+const webhookRequestTimeout = 10 * time.Second
+
+// WebhookActivities 订单生命周期的 Webhook：生成投递记录并逐条投递
+type WebhookActivities struct {
+	DB   *gorm.DB
+	HTTP *http.Client // 为空时使用带超时的默认客户端
+}
+
+func (a *WebhookActivities) client() *http.Client {
+	if a.HTTP != nil {
+		return a.HTTP
+	}
+	return &http.Client{Timeout: webhookRequestTimeout}
+}
+
+// EnqueueWebhooks 为一次状态流转生成投递记录 (每个订阅了该事件的启用订阅一条)，返回投递 ID
+// 幂等：同一订单同一序号只生成一次，重试时返回已生成的投递
+func (a *WebhookActivities) EnqueueWebhooks(ctx context.Context, event common.OrderEvent) ([]uint, error) {
+	eventType, ok := WebhookEventType(common.OrderState(event.Status))
+	if !ok {
+		return nil, nil
+	}
+	eventID := fmt.Sprintf("%s-%d", event.OrderID, event.Seq)
+	payload, err := json.Marshal(WebhookPayload{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: event.OccurredAt,
+		Data: WebhookOrderData{
+			OrderID:     event.OrderID,
+			Status:      event.Status,
+			StatusLabel: event.Label,
+			Reason:      event.Reason,
+			Amount:      event.Order.Amount,
+			Items:       event.Order.Items,
+			Campaign:    event.Order.Campaign,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = dedup.Execute(a.DB.WithContext(ctx), "webhook_"+eventID, func(tx *gorm.DB) error {
+		var subs []WebhookSubscription
+		if err := tx.Where("active = ?", true).Find(&subs).Error; err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if !sub.Subscribes(eventType) {
+				continue
+			}
+			if err := tx.Create(&WebhookDelivery{
+				SubscriptionID: sub.ID,
+				EventID:        eventID,
+				EventType:      eventType,
+				OrderID:        event.OrderID,
+				Payload:        string(payload),
+				Status:         DeliveryPending,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	err = a.DB.WithContext(ctx).Model(&WebhookDelivery{}).
+		Where("event_id = ? AND replay_of IS NULL", eventID).Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// DeliverWebhook 投递一次 (失败由 Temporal 按指数退避重试)
+// 最后一次尝试仍失败时写入死信 (DEAD) 并不再重试，之后可通过后台接口重放
+func (a *WebhookActivities) DeliverWebhook(ctx context.Context, deliveryID uint) error {
+	return a.deliver(ctx, deliveryID, int(activity.GetInfo(ctx).Attempt))
+}
+
+func (a *WebhookActivities) deliver(ctx context.Context, deliveryID uint, attempt int) error {
+	var d WebhookDelivery
+	if err := a.DB.WithContext(ctx).First(&d, deliveryID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if d.Status != DeliveryPending {
+		// 上一次尝试已送达 (Activity 结果未回报)，或已进入死信
+		return nil
+	}
+
+	var sub WebhookSubscription
+	err := a.DB.WithContext(ctx).First(&sub, d.SubscriptionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && !sub.Active {
+		return a.deadLetter(ctx, &d, attempt, 0, "订阅已停用")
+	} else if err != nil {
+		return err
+	}
+
+	code, sendErr := a.send(ctx, &sub, &d)
+	if sendErr == nil {
+		now := time.Now()
+		return a.DB.WithContext(ctx).Model(&d).Updates(map[string]interface{}{
+			"status":           DeliveryDelivered,
+			"attempts":         attempt,
+			"last_status_code": code,
+			"last_error":       "",
+			"delivered_at":     &now,
+		}).Error
+	}
+	if attempt >= WebhookMaxAttempts {
+		return a.deadLetter(ctx, &d, attempt, code, sendErr.Error())
+	}
+	if err := a.DB.WithContext(ctx).Model(&d).Updates(map[string]interface{}{
+		"attempts":         attempt,
+		"last_status_code": code,
+		"last_error":       sendErr.Error(),
+	}).Error; err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// send 发送签名后的请求，2xx 视为成功
+func (a *WebhookActivities) send(ctx context.Context, sub *WebhookSubscription, d *WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OmniFlow-Webhook/1.0")
+	req.Header.Set(webhook.EventHeader, d.EventType)
+	req.Header.Set(webhook.EventIDHeader, d.EventID)
+	req.Header.Set(webhook.DeliveryHeader, strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(sub.Secret, time.Now(), body))
+
+	resp, err := a.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// deadLetter 写入死信并返回不可重试的错误
+func (a *WebhookActivities) deadLetter(ctx context.Context, d *WebhookDelivery, attempt, code int, reason string) error {
+	if err := a.DB.WithContext(ctx).Model(d).Updates(map[string]interface{}{
+		"status":           DeliveryDead,
+		"attempts":         attempt,
+		"last_status_code": code,
+		"last_error":       reason,
+	}).Error; err != nil {
+		return err
+	}
+	fmt.Printf("☠️ [Webhook] 投递 #%d (%s) 进入死信: %s\n", d.ID, d.EventID, reason)
+	return temporal.NewNonRetryableApplicationError("webhook 投递失败，已进入死信: "+reason, "WebhookDeadLetter", nil)
+}
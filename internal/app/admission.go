@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"golang.org/x/time/rate"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/store"
+)
+
+// ErrAdmissionFull 准入队列已满，调用方应拒绝请求并归还本次扣减的库存
+var ErrAdmissionFull = errors.New("下单队列已满")
+
+var (
+	admissionDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "omniflow_admission_queue_depth",
+		Help: "准入队列中等待启动 Workflow 的订单数",
+	})
+	admissionRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "omniflow_admission_rejected_total",
+		Help: "队列已满被拒绝的订单数",
+	})
+	admissionStarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "omniflow_admission_starts_total",
+		Help: "准入队列启动 Workflow 的结果: started / duplicate / failed",
+	}, []string{"result"})
+)
+
+// AdmissionOptions 准入队列配置，零值使用默认值
+type AdmissionOptions struct {
+	QueueSize int     // 队列长度，默认 10000
+	Workers   int     // 同时启动 Workflow 的 goroutine 数，默认 16
+	Rate      float64 // 每秒最多启动的 Workflow 数，默认 500
+	Burst     int     // 令牌桶容量，默认等于 Workers
+}
+
+// AdmissionStats 队列积压情况
+type AdmissionStats struct {
+	Depth    int // 排队中
+	Capacity int // 队列长度
+	InFlight int // 正在启动
+}
+
+// Admission 漏斗与 Temporal 之间的准入队列
+// 抢到库存的订单进入有界队列后立即返回订单号，Worker 池按令牌桶速率启动 Workflow，
+// 瞬间上万个赢家不会变成上万个并发的 StartWorkflowExecution
+//
+// 队列只在内存中：进程崩溃时未启动的订单仍有 Outbox 记录，由 OutboxSweeper 补启动
+type Admission struct {
+	Store  store.StockStore
+	Client client.Client
+
+	opt     AdmissionOptions
+	queue   chan admissionJob
+	limiter *rate.Limiter
+	pending atomic.Int64 // 已入队但还没处理完的订单 (排队 + 正在启动)
+}
+
+type admissionJob struct {
+	order common.Order
+}
+
+// NewAdmission 创建准入队列，需要调用 Run 启动 Worker
+func NewAdmission(s store.StockStore, c client.Client, opt AdmissionOptions) *Admission {
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = 10000
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = 16
+	}
+	if opt.Rate <= 0 {
+		opt.Rate = 500
+	}
+	if opt.Burst <= 0 {
+		opt.Burst = opt.Workers
+	}
+	return &Admission{
+		Store:   s,
+		Client:  c,
+		opt:     opt,
+		queue:   make(chan admissionJob, opt.QueueSize),
+		limiter: rate.NewLimiter(rate.Limit(opt.Rate), opt.Burst),
+	}
+}
+
+// Submit 订单入队，不阻塞；队列已满返回 ErrAdmissionFull
+func (a *Admission) Submit(order common.Order) error {
+	a.pending.Add(1)
+	select {
+	case a.queue <- admissionJob{order: order}:
+		admissionDepth.Set(float64(len(a.queue)))
+		return nil
+	default:
+		a.pending.Add(-1)
+		admissionRejected.Inc()
+		return ErrAdmissionFull
+	}
+}
+
+// Saturated 队列已满 (api-server 在扣减库存前检查，满了直接拒绝)
+func (a *Admission) Saturated() bool {
+	return len(a.queue) >= cap(a.queue)
+}
+
+// Stats 当前积压
+func (a *Admission) Stats() AdmissionStats {
+	depth := len(a.queue)
+	return AdmissionStats{Depth: depth, Capacity: cap(a.queue), InFlight: max(int(a.pending.Load())-depth, 0)}
+}
+
+// RetryAfter 按当前积压和启动速率估算多久后有空位 (至少 1 秒)
+func (a *Admission) RetryAfter() time.Duration {
+	seconds := math.Ceil(float64(len(a.queue)) / a.opt.Rate)
+	return time.Duration(math.Max(seconds, 1)) * time.Second
+}
+
+// DrainTime 队列排满时全部启动需要的时间
+// 必须小于 Outbox 补启动的等待时间，否则排队中的订单会先被 OutboxSweeper 启动 (api-server 启动时校验)
+func (a *Admission) DrainTime() time.Duration {
+	return time.Duration(float64(cap(a.queue)) / a.opt.Rate * float64(time.Second))
+}
+
+// Run 启动 Worker 池直到 ctx 结束；退出时队列里剩下的订单交给 OutboxSweeper
+func (a *Admission) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < a.opt.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-a.queue:
+					admissionDepth.Set(float64(len(a.queue)))
+					if err := a.limiter.Wait(ctx); err != nil {
+						return
+					}
+					a.start(ctx, job)
+					a.pending.Add(-1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// start 启动订单 Workflow 并确认 Outbox 记录
+// 启动失败时保留 Outbox 记录，由 OutboxSweeper 补启动 (超时未启动则归还库存)
+func (a *Admission) start(ctx context.Context, job admissionJob) {
+	orderID, sku := job.order.OrderID, job.order.FlashSKU()
+	_, err := a.Client.ExecuteWorkflow(ctx, OrderWorkflowOptions(orderID), OrderFulfillmentWorkflow, job.order)
+	var alreadyStarted *serviceerror.WorkflowExecutionAlreadyStarted
+	switch {
+	case errors.As(err, &alreadyStarted):
+		// 已由 OutboxSweeper 或之前的请求启动：与 Sweeper 一样只确认 Outbox，
+		// 预占归 Workflow 所有，是否归还由 ReservationSweeper 按 Workflow 状态决定
+		admissionStarts.WithLabelValues("duplicate").Inc()
+	case err != nil:
+		admissionStarts.WithLabelValues("failed").Inc()
+		log.Printf("⚠️ Workflow 启动失败，留给 Outbox Sweeper 补启动 %s: %v", orderID, err)
+		return
+	default:
+		admissionStarts.WithLabelValues("started").Inc()
+	}
+	// Workflow 已接管库存 (失败也没关系，Sweeper 会发现 Workflow 已存在)
+	if err := a.Store.AckOutbox(ctx, sku, orderID); err != nil {
+		log.Printf("Outbox 确认失败: %v", err)
+	}
+}
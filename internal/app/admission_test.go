@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/store"
+)
+
+func TestAdmission_RateLimitedStartsAndBackpressure(t *testing.T) {
+	s := miniredis.RunT(t)
+	rs, err := store.NewRedisStore(s.Addr())
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, rs.PreheatStock(ctx, "iPhone15", 10))
+
+	now := time.Now()
+	deduct := func(id string) common.Order {
+		res, err := rs.DeductStockWithOutbox(ctx, store.OutboxEntry{OrderID: id, SKU: "iPhone15", Amount: 1, CreatedAt: now}, now.Add(time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, 1, res)
+		return common.Order{OrderID: id, Items: []string{"iPhone15"}}
+	}
+	byID := func(id string) interface{} {
+		return mock.MatchedBy(func(o client.StartWorkflowOptions) bool { return o.ID == id })
+	}
+
+	c := &mocks.Client{}
+	for _, id := range []string{"ORD-1", "ORD-2", "ORD-3"} {
+		c.On("ExecuteWorkflow", mock.Anything, byID(id), mock.Anything, mock.Anything).Return(&mocks.WorkflowRun{}, nil).Once()
+	}
+	c.On("ExecuteWorkflow", mock.Anything, byID("DUP"), mock.Anything, mock.Anything).
+		Return(nil, serviceerror.NewWorkflowExecutionAlreadyStarted("started", "", "run-1")).Once()
+	c.On("ExecuteWorkflow", mock.Anything, byID("DOWN"), mock.Anything, mock.Anything).
+		Return(nil, errors.New("temporal unavailable")).Once()
+
+	// 1. 队列长度 5：第 6 单被拒绝
+	a := NewAdmission(rs, c, AdmissionOptions{QueueSize: 5, Workers: 2, Rate: 20, Burst: 1})
+	for _, id := range []string{"ORD-1", "ORD-2", "ORD-3", "DUP", "DOWN"} {
+		require.NoError(t, a.Submit(deduct(id)))
+	}
+	assert.True(t, a.Saturated())
+	assert.ErrorIs(t, a.Submit(common.Order{OrderID: "ORD-6"}), ErrAdmissionFull)
+	assert.Equal(t, AdmissionStats{Depth: 5, Capacity: 5}, a.Stats())
+	assert.Equal(t, time.Second, a.RetryAfter())
+	s.CheckGet(t, "stock:iPhone15", "5")
+
+	// 2. 每秒 20 个、桶容量 1：5 单至少需要 200ms
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		a.Run(runCtx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return a.Stats() == AdmissionStats{Capacity: 5}
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+	cancel()
+	<-done
+	c.AssertExpectations(t)
+
+	// 3. 启动成功的已确认；已被 Sweeper 启动的 (DUP) 只确认 Outbox，预占留给运行中的订单，不归还库存；
+	// 启动失败的留在 Outbox 等 Sweeper 补启动
+	s.CheckGet(t, "stock:iPhone15", "5")
+	pending, err := rs.PendingOutbox(ctx, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "DOWN", pending[0].OrderID)
+	dup, err := rs.GetReservation(ctx, "iPhone15", "DUP")
+	require.NoError(t, err)
+	require.NotNil(t, dup)
+	assert.Equal(t, 1, dup.Quantity)
+}
@@ -0,0 +1,281 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.temporal.io/sdk/client"
+	"gorm.io/gorm"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/store"
+)
+
+// CampaignState 秒杀活动状态
+//
+//	SCHEDULED --(开始时间)--> LIVE --(结束时间)--> ENDED
+//	SCHEDULED/LIVE --(暂停)--> PAUSED --(恢复)--> SCHEDULED/LIVE (按当前时间)
+//	PAUSED --(结束时间)--> ENDED
+type CampaignState string
+
+const (
+	CampaignScheduled CampaignState = "SCHEDULED"
+	CampaignLive      CampaignState = "LIVE"
+	CampaignPaused    CampaignState = "PAUSED"
+	CampaignEnded     CampaignState = "ENDED"
+)
+
+// Campaign 秒杀活动
+type Campaign struct {
+	ID           string `gorm:"primaryKey;size:64"`
+	Name         string
+	StartAt      time.Time
+	EndAt        time.Time
+	PerUserLimit int           // 每个客户最多抢购件数，0 表示不限
+	State        CampaignState `gorm:"size:16;index"`
+	Allocations  []CampaignAllocation
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// CampaignAllocation 活动中一个 SKU 的库存与售价；Remaining/Sold/Pending 在活动结束时对账写入
+// Pending 为结束时仍未确认/释放的预占，全部结束后 (SettleCampaign) 计入 Sold 或 Remaining 并清零
+type CampaignAllocation struct {
+	ID         uint   `gorm:"primaryKey"`
+	CampaignID string `gorm:"size:64;index"`
+	SKU        string `gorm:"size:64;index"`
+	Quantity   int
+	SalePrice  int
+	Remaining  int
+	Sold       int
+	Pending    int
+}
+
+// SKUs 活动包含的 SKU
+func (c *Campaign) SKUs() []string {
+	skus := make([]string, 0, len(c.Allocations))
+	for _, a := range c.Allocations {
+		skus = append(skus, a.SKU)
+	}
+	return skus
+}
+
+// CampaignModels 活动相关的表
+func CampaignModels() []interface{} {
+	return []interface{}{&Campaign{}, &CampaignAllocation{}}
+}
+
+var (
+	ErrCampaignNotFound = errors.New("活动不存在")
+	ErrCampaignConflict = errors.New("活动时间与其他活动重叠")
+	ErrCampaignState    = errors.New("活动当前状态不允许该操作")
+)
+
+// CampaignInputError 创建活动的参数错误，Field 为出错的参数名
+type CampaignInputError struct {
+	Field string
+}
+
+func (e *CampaignInputError) Error() string {
+	return "活动参数错误: " + e.Field
+}
+
+// 活动开始/结束由一次性的 Temporal Schedule 触发
+func campaignScheduleID(id, phase string) string {
+	return fmt.Sprintf("campaign-%s-%s", id, phase)
+}
+
+// CampaignService 活动管理 (后台 API 使用)
+type CampaignService struct {
+	DB     *gorm.DB
+	Store  store.StockStore
+	Client client.Client
+}
+
+// HasOpenCampaign SKU 是否属于未结束的活动 (Redis 熔断时按 MySQL 判断，降级下单拒绝活动商品)
+func (s *CampaignService) HasOpenCampaign(ctx context.Context, sku string) (bool, error) {
+	var n int64
+	err := s.DB.WithContext(ctx).Model(&CampaignAllocation{}).
+		Joins("JOIN campaigns ON campaigns.id = campaign_allocations.campaign_id").
+		Where("campaign_allocations.sku = ?", sku).
+		Where("campaigns.state <> ?", CampaignEnded).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// Create 校验并保存活动，创建开始/结束两个 Schedule
+// 开始时间已过的活动立即发布
+func (s *CampaignService) Create(ctx context.Context, c Campaign, now time.Time) (*Campaign, error) {
+	if err := validateCampaign(c, now); err != nil {
+		return nil, err
+	}
+	c.ID = "CAMP-" + uuid.New().String()[:8]
+	c.State = CampaignScheduled
+	for i := range c.Allocations {
+		c.Allocations[i].ID = 0
+		c.Allocations[i].CampaignID = c.ID
+		c.Allocations[i].Remaining = c.Allocations[i].Quantity
+		c.Allocations[i].Sold = 0
+		c.Allocations[i].Pending = 0
+	}
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		skus := c.SKUs()
+		// 同一个 SKU 在同一时间只能属于一个未结束的活动 (Redis 中 SKU -> 活动只有一个映射)
+		var overlapping int64
+		err := tx.Model(&CampaignAllocation{}).
+			Joins("JOIN campaigns ON campaigns.id = campaign_allocations.campaign_id").
+			Where("campaign_allocations.sku IN ?", skus).
+			Where("campaigns.state <> ?", CampaignEnded).
+			Where("campaigns.start_at < ? AND campaigns.end_at > ?", c.EndAt, c.StartAt).
+			Count(&overlapping).Error
+		if err != nil {
+			return err
+		}
+		if overlapping > 0 {
+			return ErrCampaignConflict
+		}
+		return tx.Create(&c).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.schedule(ctx, c, now); err != nil {
+		// 没有 Schedule 的活动永远不会开始，删掉让调用方重试
+		s.DB.WithContext(ctx).Where("campaign_id = ?", c.ID).Delete(&CampaignAllocation{})
+		s.DB.WithContext(ctx).Delete(&Campaign{}, "id = ?", c.ID)
+		return nil, err
+	}
+	return &c, nil
+}
+
+func validateCampaign(c Campaign, now time.Time) error {
+	switch {
+	case c.Name == "":
+		return &CampaignInputError{Field: "name"}
+	case c.StartAt.IsZero():
+		return &CampaignInputError{Field: "start_at"}
+	case !c.EndAt.After(c.StartAt) || !c.EndAt.After(now):
+		return &CampaignInputError{Field: "end_at"}
+	case c.PerUserLimit < 0:
+		return &CampaignInputError{Field: "per_user_limit"}
+	case len(c.Allocations) == 0:
+		return &CampaignInputError{Field: "allocations"}
+	}
+	seen := make(map[string]bool, len(c.Allocations))
+	for _, a := range c.Allocations {
+		if a.SKU == "" || seen[a.SKU] || a.Quantity <= 0 || a.SalePrice <= 0 {
+			return &CampaignInputError{Field: "allocations"}
+		}
+		seen[a.SKU] = true
+	}
+	return nil
+}
+
+// schedule 创建开始/结束 Schedule (各触发一次)，开始时间已过时直接启动开始 Workflow
+func (s *CampaignService) schedule(ctx context.Context, c Campaign, now time.Time) error {
+	if c.StartAt.After(now) {
+		if err := s.createSchedule(ctx, c.ID, "start", c.StartAt, CampaignStartWorkflow); err != nil {
+			return err
+		}
+	} else {
+		opts := client.StartWorkflowOptions{ID: campaignScheduleID(c.ID, "start"), TaskQueue: common.TaskQueue}
+		if _, err := s.Client.ExecuteWorkflow(ctx, opts, CampaignStartWorkflow, c.ID); err != nil {
+			return err
+		}
+	}
+	return s.createSchedule(ctx, c.ID, "end", c.EndAt, CampaignEndWorkflow)
+}
+
+func (s *CampaignService) createSchedule(ctx context.Context, id, phase string, at time.Time, wf interface{}) error {
+	at = at.UTC()
+	exactly := func(v int) []client.ScheduleRange { return []client.ScheduleRange{{Start: v}} }
+	_, err := s.Client.ScheduleClient().Create(ctx, client.ScheduleOptions{
+		ID: campaignScheduleID(id, phase),
+		Spec: client.ScheduleSpec{
+			Calendars: []client.ScheduleCalendarSpec{{
+				Second:     exactly(at.Second()),
+				Minute:     exactly(at.Minute()),
+				Hour:       exactly(at.Hour()),
+				DayOfMonth: exactly(at.Day()),
+				Month:      exactly(int(at.Month())),
+				Year:       exactly(at.Year()),
+			}},
+		},
+		Action: &client.ScheduleWorkflowAction{
+			ID:        campaignScheduleID(id, phase),
+			Workflow:  wf,
+			Args:      []interface{}{id},
+			TaskQueue: common.TaskQueue,
+		},
+		RemainingActions: 1,
+	})
+	return err
+}
+
+// Get 查询活动及其 SKU 配置
+func (s *CampaignService) Get(ctx context.Context, id string) (*Campaign, error) {
+	var c Campaign
+	err := s.DB.WithContext(ctx).Preload("Allocations").First(&c, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCampaignNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Pause 暂停未结束的活动，漏斗立即拒绝新请求 (已抢到的订单不受影响)
+func (s *CampaignService) Pause(ctx context.Context, id string) (*Campaign, error) {
+	return s.setState(ctx, id, func(c *Campaign, _ time.Time) (CampaignState, error) {
+		if c.State != CampaignScheduled && c.State != CampaignLive {
+			return "", ErrCampaignState
+		}
+		return CampaignPaused, nil
+	})
+}
+
+// Resume 恢复已暂停的活动：开始时间前回到 SCHEDULED，活动时间内直接 LIVE
+func (s *CampaignService) Resume(ctx context.Context, id string) (*Campaign, error) {
+	return s.setState(ctx, id, func(c *Campaign, now time.Time) (CampaignState, error) {
+		switch {
+		case c.State != CampaignPaused || !now.Before(c.EndAt):
+			return "", ErrCampaignState
+		case now.Before(c.StartAt):
+			return CampaignScheduled, nil
+		default:
+			return CampaignLive, nil
+		}
+	})
+}
+
+func (s *CampaignService) setState(ctx context.Context, id string, next func(*Campaign, time.Time) (CampaignState, error)) (*Campaign, error) {
+	var c Campaign
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Allocations").First(&c, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCampaignNotFound
+			}
+			return err
+		}
+		state, err := next(&c, time.Now())
+		if err != nil {
+			return err
+		}
+		c.State = state
+		return tx.Model(&c).Update("state", state).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 尚未发布到 Redis 的活动没有需要同步的内容，开始时会按 MySQL 中的状态发布
+	if _, err := s.Store.SetCampaignState(ctx, id, c.SKUs(), string(c.State)); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+
+	"omniflow/internal/pkg/store"
+)
+
+func TestCampaignService_Lifecycle(t *testing.T) {
+	db := setupTestDB()
+	s := miniredis.RunT(t)
+	rs, err := store.NewRedisStore(s.Addr())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	now := time.Now()
+	start := now.Add(time.Hour).Truncate(time.Second)
+	end := start.Add(2 * time.Hour)
+
+	// 开始/结束各一个只触发一次的 Schedule，精确到秒 (UTC)
+	schedules := &mocks.ScheduleClient{}
+	scheduledAt := func(phase string, at time.Time) interface{} {
+		return mock.MatchedBy(func(o client.ScheduleOptions) bool {
+			cal := o.Spec.Calendars[0]
+			return o.ID == "campaign-"+o.Action.(*client.ScheduleWorkflowAction).Args[0].(string)+"-"+phase &&
+				o.RemainingActions == 1 &&
+				cal.Year[0].Start == at.UTC().Year() && cal.Hour[0].Start == at.UTC().Hour() &&
+				cal.Minute[0].Start == at.Minute() && cal.Second[0].Start == at.Second()
+		})
+	}
+	schedules.On("Create", mock.Anything, scheduledAt("start", start)).Return(&mocks.ScheduleHandle{}, nil).Once()
+	schedules.On("Create", mock.Anything, scheduledAt("end", end)).Return(&mocks.ScheduleHandle{}, nil).Once()
+	c := &mocks.Client{}
+	c.On("ScheduleClient").Return(schedules)
+
+	svc := &CampaignService{DB: db, Store: rs, Client: c}
+	campaign, err := svc.Create(ctx, Campaign{
+		Name:         "双十一",
+		StartAt:      start,
+		EndAt:        end,
+		PerUserLimit: 1,
+		Allocations:  []CampaignAllocation{{SKU: "CAMP_PHONE", Quantity: 3, SalePrice: 4999}},
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, CampaignScheduled, campaign.State)
+	schedules.AssertExpectations(t)
+	open, err := svc.HasOpenCampaign(ctx, "CAMP_PHONE")
+	require.NoError(t, err)
+	assert.True(t, open)
+	open, err = svc.HasOpenCampaign(ctx, "PLAIN_SKU")
+	require.NoError(t, err)
+	assert.False(t, open)
+
+	// 同一 SKU 时间重叠的活动被拒绝；参数错误返回出错字段
+	_, err = svc.Create(ctx, Campaign{Name: "冲突", StartAt: start.Add(time.Hour), EndAt: end.Add(time.Hour),
+		Allocations: []CampaignAllocation{{SKU: "CAMP_PHONE", Quantity: 1, SalePrice: 1}}}, now)
+	assert.ErrorIs(t, err, ErrCampaignConflict)
+	_, err = svc.Create(ctx, Campaign{Name: "无效", StartAt: end, EndAt: start,
+		Allocations: []CampaignAllocation{{SKU: "CAMP_PAD", Quantity: 1, SalePrice: 1}}}, now)
+	var inputErr *CampaignInputError
+	require.ErrorAs(t, err, &inputErr)
+	assert.Equal(t, "end_at", inputErr.Field)
+
+	// 开始前暂停：开始时照常预热，但漏斗仍拒绝
+	_, err = svc.Pause(ctx, campaign.ID)
+	require.NoError(t, err)
+	acts := &CampaignActivities{DB: db, Store: rs}
+	require.NoError(t, acts.ActivateCampaign(ctx, campaign.ID))
+	s.CheckGet(t, "stock:CAMP_PHONE", "3")
+	meta, price, err := rs.CampaignForSKU(ctx, "CAMP_PHONE")
+	require.NoError(t, err)
+	assert.Equal(t, string(CampaignPaused), meta.State)
+	assert.Equal(t, 4999, price)
+
+	// 恢复：开始时间前回到 SCHEDULED (Redis 中同步)，重试开始不会重复预热
+	resumed, err := svc.Resume(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CampaignScheduled, resumed.State)
+	require.NoError(t, acts.ActivateCampaign(ctx, campaign.ID))
+	got, err := svc.Get(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CampaignLive, got.State)
+	s.CheckGet(t, "stock:CAMP_PHONE", "3")
+
+	// 两件下单，一件已支付、一件未支付时结束：未确认的预占记为待定，不算售出
+	for _, id := range []string{"ORD-CAMP-1", "ORD-CAMP-2"} {
+		res, err := rs.DeductStockWithOutbox(ctx, store.OutboxEntry{OrderID: id, SKU: "CAMP_PHONE", Amount: 1, CreatedAt: now}, now.Add(time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, 1, res)
+	}
+	require.NoError(t, rs.ConfirmReservation(ctx, "CAMP_PHONE", "ORD-CAMP-1"))
+	require.NoError(t, acts.EndCampaign(ctx, campaign.ID))
+	got, err = svc.Get(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CampaignEnded, got.State)
+	assert.Equal(t, 1, got.Allocations[0].Remaining)
+	assert.Equal(t, 1, got.Allocations[0].Sold)
+	assert.Equal(t, 1, got.Allocations[0].Pending)
+
+	// 预占结束前最终对账会重试；未支付的订单释放后，归还的库存计入剩余
+	assert.ErrorIs(t, acts.SettleCampaign(ctx, campaign.ID), ErrReservationsPending)
+	released, err := rs.ReleaseReservation(ctx, "CAMP_PHONE", "ORD-CAMP-2")
+	require.NoError(t, err)
+	require.True(t, released)
+	require.NoError(t, acts.SettleCampaign(ctx, campaign.ID))
+	got, err = svc.Get(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, got.Allocations[0].Remaining)
+	assert.Equal(t, 1, got.Allocations[0].Sold)
+	assert.Equal(t, 0, got.Allocations[0].Pending)
+	open, err = svc.HasOpenCampaign(ctx, "CAMP_PHONE")
+	require.NoError(t, err)
+	assert.False(t, open, "活动结束后 SKU 恢复为普通商品")
+	_, err = svc.Pause(ctx, campaign.ID)
+	assert.ErrorIs(t, err, ErrCampaignState)
+	_, err = svc.Get(ctx, "CAMP-MISSING")
+	assert.ErrorIs(t, err, ErrCampaignNotFound)
+}
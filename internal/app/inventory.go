@@ -0,0 +1,265 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/store"
+)
+
+// StockAdjustmentLog 库存调整审计记录，与库存变更在同一个事务中写入
+// 补货、盘点、报损都走这里；订单的预占/释放不记录 (由 Workflow 历史审计)
+type StockAdjustmentLog struct {
+	ID          uint   `gorm:"primaryKey"`
+	RequestID   string `gorm:"size:128;uniqueIndex"`
+	SKU         string `gorm:"size:64;index"`
+	Delta       int
+	Reason      string
+	Operator    string `gorm:"size:64"`
+	StockBefore int
+	StockAfter  int
+	RedisSynced bool // 补货已同步到 Redis 秒杀库存
+	CreatedAt   time.Time
+}
+
+// InventoryModels 库存管理相关的表 (商品表由 Worker 单独迁移)
+func InventoryModels() []interface{} {
+	return []interface{}{&StockAdjustmentLog{}}
+}
+
+var (
+	ErrProductNotFound    = errors.New("商品不存在")
+	ErrProductExists      = errors.New("商品已存在")
+	ErrStockNegative      = errors.New("调整后库存小于 0")
+	ErrAdjustmentConflict = errors.New("同一个请求 ID 已用于不同的库存调整")
+	ErrRestockSyncUnknown = errors.New("补货已写入 MySQL，Redis 同步结果未知，请在库存视图核对 Redis 库存")
+)
+
+// InventoryInputError 库存管理的参数错误，Field 为出错的参数名
+type InventoryInputError struct {
+	Field string
+}
+
+func (e *InventoryInputError) Error() string {
+	return "库存参数错误: " + e.Field
+}
+
+// ReasonRestock 补货的调整原因
+const ReasonRestock = "restock"
+
+// StockView 一个 SKU 在 MySQL 与 Redis 中的库存，便于对账
+// Redis 不可用或 SKU 未预热时 RedisStock 为 nil
+type StockView struct {
+	Product
+	RedisStock  *int
+	Reserved    int    // Redis 中已扣减、尚未确认/释放的预占件数
+	RedisError  string // Redis 读取失败的原因 (熔断等)
+	Adjustments []StockAdjustmentLog
+}
+
+// InventoryService 商品与库存管理 (后台 API 使用)
+type InventoryService struct {
+	DB    *gorm.DB
+	Store store.StockStore
+}
+
+func (s *InventoryService) activities() *InventoryActivities {
+	return &InventoryActivities{DB: s.DB}
+}
+
+// CreateProduct 创建商品；初始库存作为一次调整写入审计记录
+func (s *InventoryService) CreateProduct(ctx context.Context, p Product, operator string) (*Product, error) {
+	switch {
+	case p.ID == "" || len(p.ID) > 64:
+		return nil, &InventoryInputError{Field: "id"}
+	case p.Name == "":
+		return nil, &InventoryInputError{Field: "name"}
+	case p.Price <= 0:
+		return nil, &InventoryInputError{Field: "price"}
+	case p.Stock < 0:
+		return nil, &InventoryInputError{Field: "stock"}
+	}
+	initial := p.Stock
+	p.Stock = 0
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Product{}).Where("id = ?", p.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrProductExists
+		}
+		if err := tx.Create(&p).Error; err != nil {
+			return err
+		}
+		if initial == 0 {
+			return nil
+		}
+		return adjustStock(tx, common.StockAdjustment{
+			RequestID: "init-" + p.ID,
+			SKU:       p.ID,
+			Delta:     initial,
+			Reason:    "initial stock",
+			Operator:  operator,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.Stock = initial
+	return &p, nil
+}
+
+// ProductUpdate 修改商品信息，nil 表示不修改；库存只能通过调整修改
+type ProductUpdate struct {
+	Name  *string
+	Price *int
+}
+
+// UpdateProduct 修改商品名称与价格
+func (s *InventoryService) UpdateProduct(ctx context.Context, sku string, u ProductUpdate) (*Product, error) {
+	updates := map[string]interface{}{}
+	if u.Name != nil {
+		if *u.Name == "" {
+			return nil, &InventoryInputError{Field: "name"}
+		}
+		updates["name"] = *u.Name
+	}
+	if u.Price != nil {
+		if *u.Price <= 0 {
+			return nil, &InventoryInputError{Field: "price"}
+		}
+		updates["price"] = *u.Price
+	}
+	if len(updates) > 0 {
+		res := s.DB.WithContext(ctx).Model(&Product{}).Where("id = ?", sku).Updates(updates)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+	}
+	var p Product
+	if err := s.DB.WithContext(ctx).First(&p, "id = ?", sku).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Adjust 调整 MySQL 库存 (盘点、报损等)，同一个 RequestID 重试返回首次的调整记录
+func (s *InventoryService) Adjust(ctx context.Context, adj common.StockAdjustment) (*StockAdjustmentLog, error) {
+	switch {
+	case adj.RequestID == "" || len(adj.RequestID) > 100: // 去重键还要加前缀，不能超过 128
+		return nil, &InventoryInputError{Field: "request_id"}
+	case adj.Delta == 0:
+		return nil, &InventoryInputError{Field: "delta"}
+	case adj.Reason == "":
+		return nil, &InventoryInputError{Field: "reason"}
+	}
+	if err := s.activities().AdjustStock(ctx, adj); err != nil {
+		return nil, err
+	}
+
+	var record StockAdjustmentLog
+	if err := s.DB.WithContext(ctx).First(&record, "request_id = ?", adj.RequestID).Error; err != nil {
+		return nil, err
+	}
+	if record.SKU != adj.SKU || record.Delta != adj.Delta || record.Reason != adj.Reason {
+		return nil, ErrAdjustmentConflict
+	}
+	return &record, nil
+}
+
+// Restock 补货：增加 MySQL 库存，并同步到已预热的 Redis 秒杀库存 (未预热的 SKU 只改 MySQL)
+// 用同一个 RequestID 重试不会重复加 MySQL 库存；SKU 未预热时重试会补做同步
+// Redis 调用出错 (超时等) 时脚本可能已经执行，不再自动重试同步，返回 ErrRestockSyncUnknown 由运营按库存视图核对
+func (s *InventoryService) Restock(ctx context.Context, requestID, sku string, qty int, operator string) (*StockAdjustmentLog, error) {
+	if qty <= 0 {
+		return nil, &InventoryInputError{Field: "quantity"}
+	}
+	record, err := s.Adjust(ctx, common.StockAdjustment{RequestID: requestID, SKU: sku, Delta: qty, Reason: ReasonRestock, Operator: operator})
+	if err != nil || record.RedisSynced {
+		return record, err
+	}
+
+	// 先抢占同步标记再加 Redis 库存：并发重试时只有一个请求执行，进程崩溃最多少同步一次 (少卖不超卖)
+	claim := s.DB.WithContext(ctx).Model(&StockAdjustmentLog{}).
+		Where("id = ? AND redis_synced = ?", record.ID, false).Update("redis_synced", true)
+	if claim.Error != nil {
+		return nil, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		record.RedisSynced = true
+		return record, nil
+	}
+	synced, err := s.Store.AddStock(ctx, sku, qty)
+	if err != nil {
+		// 结果未知：保留同步标记，重试不会再加一次 (宁可少加也不超卖)
+		return nil, fmt.Errorf("%w: %v", ErrRestockSyncUnknown, err)
+	}
+	if !synced {
+		// 明确未预热：没有加到 Redis，释放标记，预热后可以用同一个 RequestID 补做同步
+		if err := s.DB.WithContext(ctx).Model(&StockAdjustmentLog{}).Where("id = ?", record.ID).Update("redis_synced", false).Error; err != nil {
+			return nil, err
+		}
+	}
+	record.RedisSynced = synced
+	return record, nil
+}
+
+// Stock 查看 SKU 在 MySQL 与 Redis 中的库存，以及最近 limit 条调整记录
+// Redis 不可用时仍返回 MySQL 数据，错误放在 RedisError 中
+func (s *InventoryService) Stock(ctx context.Context, sku string, limit int) (*StockView, error) {
+	var view StockView
+	if err := s.DB.WithContext(ctx).First(&view.Product, "id = ?", sku).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	if limit > 0 {
+		err := s.DB.WithContext(ctx).Where("sku = ?", sku).Order("id DESC").Limit(limit).Find(&view.Adjustments).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.fillRedis(ctx, &view)
+	return &view, nil
+}
+
+// List 所有商品的库存 (商品数量有限，不分页)
+func (s *InventoryService) List(ctx context.Context) ([]StockView, error) {
+	var products []Product
+	if err := s.DB.WithContext(ctx).Order("id").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	views := make([]StockView, len(products))
+	for i, p := range products {
+		views[i].Product = p
+		s.fillRedis(ctx, &views[i])
+	}
+	return views, nil
+}
+
+func (s *InventoryService) fillRedis(ctx context.Context, view *StockView) {
+	total, ok, err := s.Store.StockLevel(ctx, view.ID)
+	if err == nil {
+		view.Reserved, err = s.Store.ReservedStock(ctx, view.ID)
+	}
+	if err != nil {
+		log.Printf("⚠️ 读取 Redis 库存失败 %s: %v", view.ID, err)
+		view.RedisError = err.Error()
+		return
+	}
+	if ok {
+		view.RedisStock = &total
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/store"
+)
+
+func TestInventoryService_AdjustAndRestock(t *testing.T) {
+	db := setupTestDB()
+	s := miniredis.RunT(t)
+	rs, err := store.NewRedisStore(s.Addr())
+	require.NoError(t, err)
+	ctx := context.Background()
+	svc := &InventoryService{DB: db, Store: rs}
+
+	// 1. 创建商品，初始库存记一条调整
+	_, err = svc.CreateProduct(ctx, Product{ID: "INV_PHONE", Name: "Phone", Price: 3999, Stock: 5}, "admin-1")
+	require.NoError(t, err)
+	_, err = svc.CreateProduct(ctx, Product{ID: "INV_PHONE", Name: "Phone", Price: 3999}, "admin-1")
+	assert.ErrorIs(t, err, ErrProductExists)
+
+	// 2. 盘点调整：同一个请求 ID 重试只生效一次；请求 ID 复用于不同调整被拒绝
+	adj := common.StockAdjustment{RequestID: "inv-req-1", SKU: "INV_PHONE", Delta: -2, Reason: "盘点", Operator: "admin-1"}
+	first, err := svc.Adjust(ctx, adj)
+	require.NoError(t, err)
+	assert.Equal(t, 5, first.StockBefore)
+	assert.Equal(t, 3, first.StockAfter)
+	retry, err := svc.Adjust(ctx, adj)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, retry.ID)
+
+	adj.Delta = -1
+	_, err = svc.Adjust(ctx, adj)
+	assert.ErrorIs(t, err, ErrAdjustmentConflict)
+	_, err = svc.Adjust(ctx, common.StockAdjustment{RequestID: "inv-req-2", SKU: "INV_PHONE", Delta: -10, Reason: "报损"})
+	assert.ErrorIs(t, err, ErrStockNegative)
+
+	// 3. 补货：未预热的 SKU 只改 MySQL
+	record, err := svc.Restock(ctx, "inv-req-3", "INV_PHONE", 4, "admin-1")
+	require.NoError(t, err)
+	assert.False(t, record.RedisSynced)
+
+	// 已预热的 SKU 同步加到 Redis，重试不会重复加
+	require.NoError(t, rs.PreheatStock(ctx, "INV_PHONE", 2))
+	for i := 0; i < 2; i++ {
+		record, err = svc.Restock(ctx, "inv-req-4", "INV_PHONE", 3, "admin-1")
+		require.NoError(t, err)
+		assert.True(t, record.RedisSynced)
+	}
+
+	view, err := svc.Stock(ctx, "INV_PHONE", 10)
+	require.NoError(t, err)
+	assert.Equal(t, 10, view.Stock) // 5 - 2 + 4 + 3
+	require.NotNil(t, view.RedisStock)
+	assert.Equal(t, 5, *view.RedisStock) // 2 + 3
+	assert.Len(t, view.Adjustments, 4)
+	assert.Equal(t, "inv-req-4", view.Adjustments[0].RequestID)
+
+	// 4. Redis 不可用时仍能看到 MySQL 库存
+	s.Close()
+	views, err := svc.List(ctx)
+	require.NoError(t, err)
+	for _, v := range views {
+		if v.ID == "INV_PHONE" {
+			assert.Equal(t, 10, v.Stock)
+			assert.Nil(t, v.RedisStock)
+			assert.NotEmpty(t, v.RedisError)
+		}
+	}
+}
+
+// syncFailingStore AddStock 在脚本执行后返回超时 (结果未知)
+type syncFailingStore struct {
+	store.StockStore
+}
+
+func (f syncFailingStore) AddStock(ctx context.Context, sku string, qty int) (bool, error) {
+	if _, err := f.StockStore.AddStock(ctx, sku, qty); err != nil {
+		return false, err
+	}
+	return false, context.DeadlineExceeded
+}
+
+func TestInventoryService_RestockSyncUnknown(t *testing.T) {
+	db := setupTestDB()
+	s := miniredis.RunT(t)
+	rs, err := store.NewRedisStore(s.Addr())
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = (&InventoryService{DB: db, Store: rs}).CreateProduct(ctx, Product{ID: "SYNC_PHONE", Name: "Phone", Price: 3999, Stock: 5}, "admin-1")
+	require.NoError(t, err)
+	require.NoError(t, rs.PreheatStock(ctx, "SYNC_PHONE", 2))
+
+	// 已加到 Redis 但调用方看到超时：报错，同步标记保留
+	failing := &InventoryService{DB: db, Store: syncFailingStore{rs}}
+	_, err = failing.Restock(ctx, "sync-req-1", "SYNC_PHONE", 3, "admin-1")
+	assert.ErrorIs(t, err, ErrRestockSyncUnknown)
+	s.CheckGet(t, "stock:SYNC_PHONE", "5")
+
+	// 同一个请求 ID 重试不会再加一次 Redis 库存
+	svc := &InventoryService{DB: db, Store: rs}
+	record, err := svc.Restock(ctx, "sync-req-1", "SYNC_PHONE", 3, "admin-1")
+	require.NoError(t, err)
+	assert.True(t, record.RedisSynced)
+	view, err := svc.Stock(ctx, "SYNC_PHONE", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 8, view.Stock)
+	require.NotNil(t, view.RedisStock)
+	assert.Equal(t, 5, *view.RedisStock)
+}
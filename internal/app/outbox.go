@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/store"
+)
+
+// OrderWorkflowOptions 订单 Workflow 的启动参数
+// 同一个 Workflow ID 只允许启动一次 (包括已结束的)，重复启动返回 WorkflowExecutionAlreadyStarted
+func OrderWorkflowOptions(workflowID string) client.StartWorkflowOptions {
+	return client.StartWorkflowOptions{
+		ID:                                       workflowID,
+		TaskQueue:                                common.TaskQueue,
+		WorkflowIDReusePolicy:                    enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE,
+		WorkflowIDConflictPolicy:                 enumspb.WORKFLOW_ID_CONFLICT_POLICY_FAIL,
+		WorkflowExecutionErrorWhenAlreadyStarted: true,
+	}
+}
+
+// ErrOrderNotStarted 订单 Workflow 不存在 (未启动或已过保留期)
+var ErrOrderNotStarted = errors.New("订单 Workflow 不存在")
+
+// OrderCustomer 订单 Workflow 启动参数中的客户 ID
+// 读模型由 ProjectOrderEvent 异步写入，可能滞后或写入失败；这里以 Workflow 历史的第一个事件为准
+func OrderCustomer(ctx context.Context, c client.Client, orderID string) (string, error) {
+	iter := c.GetWorkflowHistory(ctx, orderID, "", false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	if !iter.HasNext() {
+		return "", ErrOrderNotStarted
+	}
+	event, err := iter.Next()
+	var notFound *serviceerror.NotFound
+	if errors.As(err, &notFound) {
+		return "", ErrOrderNotStarted
+	} else if err != nil {
+		return "", err
+	}
+	attrs := event.GetWorkflowExecutionStartedEventAttributes()
+	if attrs == nil || attrs.GetWorkflowType().GetName() != "OrderFulfillmentWorkflow" {
+		return "", ErrOrderNotStarted
+	}
+	var order common.Order
+	if err := converter.GetDefaultDataConverter().FromPayloads(attrs.GetInput(), &order); err != nil {
+		return "", err
+	}
+	return order.CustomerID, nil
+}
+
+// OutboxSweeper 处理 api-server 扣减库存后没来得及确认的 Outbox 记录
+//   - 超过 StartAfter：补启动 Workflow (已存在则直接确认)
+//   - 超过 ReturnAfter：订单已无意义，确认 Workflow 不存在后释放预占、归还库存
+//
+// 多个实例同时运行是安全的：启动依赖 Workflow ID 去重，归还以删除预占记录为准，只执行一次
+type OutboxSweeper struct {
+	Store       store.StockStore
+	Client      client.Client
+	StartAfter  time.Duration
+	ReturnAfter time.Duration
+	BatchSize   int64
+}
+
+// Run 按 interval 周期清扫，直到 ctx 结束
+func (s *OutboxSweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			started, returned, err := s.SweepOnce(ctx, time.Now())
+			if err != nil {
+				log.Printf("⚠️ Outbox 清扫失败: %v", err)
+			}
+			if started > 0 || returned > 0 {
+				log.Printf("🧹 Outbox 清扫: 补启动 %d 单，归还库存 %d 单", started, returned)
+			}
+		}
+	}
+}
+
+// SweepOnce 清扫一批早于 now-StartAfter 的记录
+func (s *OutboxSweeper) SweepOnce(ctx context.Context, now time.Time) (started, returned int, err error) {
+	batch := s.BatchSize
+	if batch <= 0 {
+		batch = 100
+	}
+	entries, err := s.Store.PendingOutbox(ctx, now.Add(-s.StartAfter), batch)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, entry := range entries {
+		var order common.Order
+		if json.Unmarshal(entry.Payload, &order) != nil {
+			// 记录损坏，无法补启动也无法归还，只能清理并留日志人工核对
+			log.Printf("⚠️ Outbox 记录损坏，已丢弃: %s", entry.OrderID)
+			_ = s.Store.AckOutbox(ctx, entry.SKU, entry.OrderID)
+			continue
+		}
+
+		if now.Sub(entry.CreatedAt) >= s.ReturnAfter {
+			ok, err := s.returnIfMissing(ctx, entry)
+			if err != nil {
+				log.Printf("⚠️ Outbox 归还失败 %s: %v", entry.OrderID, err)
+				continue
+			}
+			if ok {
+				returned++
+			}
+			continue
+		}
+
+		_, err := s.Client.ExecuteWorkflow(ctx, OrderWorkflowOptions(entry.OrderID), OrderFulfillmentWorkflow, order)
+		var alreadyStarted *serviceerror.WorkflowExecutionAlreadyStarted
+		switch {
+		case err == nil:
+			started++
+		case errors.As(err, &alreadyStarted):
+			// api-server 已启动，只是没来得及确认
+		default:
+			log.Printf("⚠️ Outbox 补启动失败 %s: %v", entry.OrderID, err)
+			continue
+		}
+		if err := s.Store.AckOutbox(ctx, entry.SKU, entry.OrderID); err != nil {
+			log.Printf("⚠️ Outbox 确认失败 %s: %v", entry.OrderID, err)
+		}
+	}
+	return started, returned, nil
+}
+
+// returnIfMissing Workflow 不存在时释放预占、归还库存；已存在则只确认记录
+func (s *OutboxSweeper) returnIfMissing(ctx context.Context, entry store.OutboxEntry) (bool, error) {
+	_, err := s.Client.DescribeWorkflowExecution(ctx, entry.OrderID, "")
+	var notFound *serviceerror.NotFound
+	switch {
+	case err == nil:
+		return false, s.Store.AckOutbox(ctx, entry.SKU, entry.OrderID)
+	case errors.As(err, &notFound):
+		released, err := s.Store.ReleaseReservation(ctx, entry.SKU, entry.OrderID)
+		if err != nil {
+			return false, err
+		}
+		return released, s.Store.AckOutbox(ctx, entry.SKU, entry.OrderID)
+	default:
+		return false, err
+	}
+}
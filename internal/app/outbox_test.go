@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	historypb "go.temporal.io/api/history/v1"
+	"go.temporal.io/api/serviceerror"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/mocks"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/store"
+)
+
+func TestOutboxSweeper_SweepOnce(t *testing.T) {
+	s := miniredis.RunT(t)
+	rs, err := store.NewRedisStore(s.Addr())
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, rs.PreheatStock(ctx, "iPhone15", 10))
+
+	now := time.Now()
+	deduct := func(id string, age time.Duration) {
+		payload, _ := json.Marshal(common.Order{OrderID: id, Items: []string{"iPhone15"}})
+		res, err := rs.DeductStockWithOutbox(ctx, store.OutboxEntry{OrderID: id, SKU: "iPhone15", Amount: 1, Payload: payload, CreatedAt: now.Add(-age)}, now.Add(time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, 1, res)
+	}
+	deduct("IN_FLIGHT", 5*time.Second)      // 请求仍在处理，不动
+	deduct("CRASHED", time.Minute)          // 崩溃前没启动 -> 补启动
+	deduct("NOT_ACKED", time.Minute)        // 已启动但没确认 -> 只确认
+	deduct("STALE", 20*time.Minute)         // 太久没启动 -> 归还库存
+	deduct("STALE_STARTED", 20*time.Minute) // 太久但 Workflow 已存在 -> 只确认
+	s.CheckGet(t, "stock:iPhone15", "5")
+
+	byID := func(id string) interface{} {
+		return mock.MatchedBy(func(o client.StartWorkflowOptions) bool { return o.ID == id })
+	}
+	c := &mocks.Client{}
+	c.On("ExecuteWorkflow", mock.Anything, byID("CRASHED"), mock.Anything, mock.MatchedBy(func(o common.Order) bool {
+		return o.OrderID == "CRASHED"
+	})).Return(&mocks.WorkflowRun{}, nil).Once()
+	c.On("ExecuteWorkflow", mock.Anything, byID("NOT_ACKED"), mock.Anything, mock.Anything).
+		Return(nil, serviceerror.NewWorkflowExecutionAlreadyStarted("started", "", "run-1")).Once()
+	c.On("DescribeWorkflowExecution", mock.Anything, "STALE", "").Return(nil, serviceerror.NewNotFound("not found")).Once()
+	c.On("DescribeWorkflowExecution", mock.Anything, "STALE_STARTED", "").Return(&workflowservice.DescribeWorkflowExecutionResponse{}, nil).Once()
+
+	sweeper := &OutboxSweeper{Store: rs, Client: c, StartAfter: 30 * time.Second, ReturnAfter: 10 * time.Minute}
+	started, returned, err := sweeper.SweepOnce(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, started)
+	assert.Equal(t, 1, returned)
+	c.AssertExpectations(t)
+
+	// 只归还了 STALE 的库存，其余记录都已确认，只剩处理中的请求
+	s.CheckGet(t, "stock:iPhone15", "6")
+	pending, err := rs.PendingOutbox(ctx, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "IN_FLIGHT", pending[0].OrderID)
+
+	// 再扫一次没有任何动作
+	started, returned, err = sweeper.SweepOnce(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, started+returned)
+}
+
+func TestReservationSweeper_SweepOnce(t *testing.T) {
+	s := miniredis.RunT(t)
+	rs, err := store.NewRedisStore(s.Addr())
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, rs.PreheatStock(ctx, "iPhone15", 10))
+
+	now := time.Now()
+	for _, id := range []string{"GONE", "IN_REVIEW", "CANCELLED", "SOLD", "TERMINATED"} {
+		res, err := rs.DeductStockWithOutbox(ctx, store.OutboxEntry{OrderID: id, SKU: "iPhone15", Amount: 1, CreatedAt: now.Add(-2 * time.Hour)}, now.Add(-time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, 1, res)
+		require.NoError(t, rs.AckOutbox(ctx, "iPhone15", id))
+	}
+	s.CheckGet(t, "stock:iPhone15", "5")
+
+	described := func(status enumspb.WorkflowExecutionStatus) *workflowservice.DescribeWorkflowExecutionResponse {
+		return &workflowservice.DescribeWorkflowExecutionResponse{WorkflowExecutionInfo: &workflowpb.WorkflowExecutionInfo{Status: status}}
+	}
+	finished := func(status common.OrderState) *mocks.WorkflowRun {
+		run := &mocks.WorkflowRun{}
+		run.On("Get", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(1).(*common.OrderStatus) = common.OrderStatus{Status: string(status)}
+		}).Return(nil)
+		return run
+	}
+
+	c := &mocks.Client{}
+	c.On("DescribeWorkflowExecution", mock.Anything, "GONE", "").Return(nil, serviceerror.NewNotFound("not found"))
+	c.On("DescribeWorkflowExecution", mock.Anything, "IN_REVIEW", "").Return(described(enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING), nil)
+	c.On("DescribeWorkflowExecution", mock.Anything, "CANCELLED", "").Return(described(enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED), nil)
+	c.On("DescribeWorkflowExecution", mock.Anything, "SOLD", "").Return(described(enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED), nil)
+	c.On("DescribeWorkflowExecution", mock.Anything, "TERMINATED", "").Return(described(enumspb.WORKFLOW_EXECUTION_STATUS_TERMINATED), nil)
+	c.On("GetWorkflow", mock.Anything, "CANCELLED", "").Return(finished(common.StateCancelled))
+	c.On("GetWorkflow", mock.Anything, "SOLD", "").Return(finished(common.StateCompleted))
+
+	sweeper := &ReservationSweeper{Store: rs, Client: c, TTL: time.Hour}
+	released, confirmed, err := sweeper.SweepOnce(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, released)  // GONE + CANCELLED
+	assert.Equal(t, 2, confirmed) // SOLD + TERMINATED
+	s.CheckGet(t, "stock:iPhone15", "7")
+
+	// 审核中的订单已续期，其余预占都已处理
+	expired, err := rs.ExpiredReservations(ctx, now.Add(30*time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+	res, err := rs.GetReservation(ctx, "iPhone15", "IN_REVIEW")
+	require.NoError(t, err)
+	assert.NotNil(t, res)
+}
+
+func TestOrderCustomer(t *testing.T) {
+	ctx := context.Background()
+	input, err := converter.GetDefaultDataConverter().ToPayloads(common.Order{OrderID: "ORDER-1", CustomerID: "C1"})
+	require.NoError(t, err)
+	started := func(workflowType string) *historypb.HistoryEvent {
+		return &historypb.HistoryEvent{
+			EventType: enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED,
+			Attributes: &historypb.HistoryEvent_WorkflowExecutionStartedEventAttributes{
+				WorkflowExecutionStartedEventAttributes: &historypb.WorkflowExecutionStartedEventAttributes{
+					WorkflowType: &commonpb.WorkflowType{Name: workflowType},
+					Input:        input,
+				},
+			},
+		}
+	}
+	history := func(event *historypb.HistoryEvent, err error) *mocks.HistoryEventIterator {
+		iter := &mocks.HistoryEventIterator{}
+		iter.On("HasNext").Return(true)
+		iter.On("Next").Return(event, err)
+		return iter
+	}
+
+	c := &mocks.Client{}
+	c.On("GetWorkflowHistory", mock.Anything, "ORDER-1", "", false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT).
+		Return(history(started("OrderFulfillmentWorkflow"), nil))
+	c.On("GetWorkflowHistory", mock.Anything, "WEBHOOK-1", "", false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT).
+		Return(history(started("WebhookDeliveryWorkflow"), nil))
+	c.On("GetWorkflowHistory", mock.Anything, "MISSING", "", false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT).
+		Return(history(nil, serviceerror.NewNotFound("not found")))
+
+	customer, err := OrderCustomer(ctx, c, "ORDER-1")
+	require.NoError(t, err)
+	assert.Equal(t, "C1", customer)
+
+	// 非订单 Workflow 与不存在的 Workflow 都视为订单不存在
+	_, err = OrderCustomer(ctx, c, "WEBHOOK-1")
+	assert.ErrorIs(t, err, ErrOrderNotStarted)
+	_, err = OrderCustomer(ctx, c, "MISSING")
+	assert.ErrorIs(t, err, ErrOrderNotStarted)
+}
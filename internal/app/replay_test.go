@@ -0,0 +1,27 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/worker"
+)
+
+// TestReplayWorkflowHistories 用当前代码重放 testdata/ 下录制的历史
+// 如果修改改变了命令序列却没有用 GetVersion 保护，这里会报 non-determinism 错误
+func TestReplayWorkflowHistories(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, files, "testdata/ 下没有录制的历史")
+
+	replayer := worker.NewWorkflowReplayer()
+	replayer.RegisterWorkflow(OrderFulfillmentWorkflow)
+	replayer.RegisterWorkflow(ShippingChildWorkflow)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			require.NoError(t, replayer.ReplayWorkflowHistoryFromJSONFile(nil, file))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/store"
+)
+
+// ReservationSweeper 处理过期仍未确认/释放的秒杀预占 (Worker 丢失、旧版本订单等)
+//   - 订单仍在进行 (如人工审核中)：续期 TTL
+//   - 订单不存在，或以取消/拒绝/失败结束：释放预占，库存放回秒杀池
+//   - 订单已完成：确认售出
+//   - 订单异常结束 (终止/超时等)：无法判断是否已售出，保守确认并留日志人工对账
+type ReservationSweeper struct {
+	Store     store.StockStore
+	Client    client.Client
+	TTL       time.Duration
+	BatchSize int64
+}
+
+// Run 按 interval 周期清扫，直到 ctx 结束
+func (s *ReservationSweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			released, confirmed, err := s.SweepOnce(ctx, time.Now())
+			if err != nil {
+				log.Printf("⚠️ 秒杀预占清扫失败: %v", err)
+			}
+			if released > 0 || confirmed > 0 {
+				log.Printf("🧹 秒杀预占清扫: 归还 %d 单，确认 %d 单", released, confirmed)
+			}
+		}
+	}
+}
+
+// SweepOnce 处理一批 now 之前过期的预占
+func (s *ReservationSweeper) SweepOnce(ctx context.Context, now time.Time) (released, confirmed int, err error) {
+	batch := s.BatchSize
+	if batch <= 0 {
+		batch = 100
+	}
+	reservations, err := s.Store.ExpiredReservations(ctx, now, batch)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, res := range reservations {
+		if res.Quantity <= 0 {
+			log.Printf("⚠️ 秒杀预占记录损坏，已丢弃: %s", res.OrderID)
+			_ = s.Store.ConfirmReservation(ctx, res.SKU, res.OrderID)
+			continue
+		}
+
+		action, err := s.decide(ctx, res.OrderID)
+		if err != nil {
+			log.Printf("⚠️ 秒杀预占处理失败 %s: %v", res.OrderID, err)
+			continue
+		}
+		switch action {
+		case reservationExtend:
+			if err := s.Store.ExtendReservation(ctx, res.SKU, res.OrderID, now.Add(s.TTL)); err != nil {
+				log.Printf("⚠️ 秒杀预占续期失败 %s: %v", res.OrderID, err)
+			}
+		case reservationRelease:
+			ok, err := s.Store.ReleaseReservation(ctx, res.SKU, res.OrderID)
+			if err != nil {
+				log.Printf("⚠️ 秒杀预占归还失败 %s: %v", res.OrderID, err)
+			} else if ok {
+				released++
+			}
+		case reservationConfirm:
+			if err := s.Store.ConfirmReservation(ctx, res.SKU, res.OrderID); err != nil {
+				log.Printf("⚠️ 秒杀预占确认失败 %s: %v", res.OrderID, err)
+			} else {
+				confirmed++
+			}
+		}
+	}
+	return released, confirmed, nil
+}
+
+type reservationAction int
+
+const (
+	reservationExtend reservationAction = iota
+	reservationRelease
+	reservationConfirm
+)
+
+// decide 根据订单 Workflow 的状态决定续期、归还还是确认
+func (s *ReservationSweeper) decide(ctx context.Context, orderID string) (reservationAction, error) {
+	desc, err := s.Client.DescribeWorkflowExecution(ctx, orderID, "")
+	var notFound *serviceerror.NotFound
+	if errors.As(err, &notFound) {
+		return reservationRelease, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	switch status := desc.GetWorkflowExecutionInfo().GetStatus(); status {
+	case enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING:
+		return reservationExtend, nil
+	case enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED:
+		var result common.OrderStatus
+		if err := s.Client.GetWorkflow(ctx, orderID, "").Get(ctx, &result); err != nil {
+			return 0, err
+		}
+		if result.Status == string(common.StateCompleted) {
+			return reservationConfirm, nil
+		}
+		return reservationRelease, nil
+	default:
+		log.Printf("⚠️ 订单 %s 异常结束 (%s)，秒杀预占按售出处理，请人工对账", orderID, status)
+		return reservationConfirm, nil
+	}
+}
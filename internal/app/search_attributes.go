@@ -0,0 +1,73 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+)
+
+// 订单搜索属性 (需要提前在 Namespace 中注册，见 README)
+var (
+	SearchAttrOrderStatus     = temporal.NewSearchAttributeKeyKeyword("OrderStatus")
+	SearchAttrCustomerID      = temporal.NewSearchAttributeKeyKeyword("CustomerID")
+	SearchAttrAmount          = temporal.NewSearchAttributeKeyInt64("Amount")
+	SearchAttrCampaign        = temporal.NewSearchAttributeKeyKeyword("Campaign")
+	SearchAttrSKUs            = temporal.NewSearchAttributeKeyKeywordList("SKUs")
+	SearchAttrStatusChangedAt = temporal.NewSearchAttributeKeyTime("StatusChangedAt")
+	SearchAttrRiskVerdict     = temporal.NewSearchAttributeKeyKeyword("RiskVerdict")
+	SearchAttrRiskRules       = temporal.NewSearchAttributeKeyKeywordList("RiskRules")
+)
+
+// OrderListFilter 订单列表的筛选条件，零值字段不参与筛选
+type OrderListFilter struct {
+	Status      string
+	CustomerID  string
+	RiskVerdict string        // 风控结论 (APPROVE / REVIEW / REJECT)
+	RiskRule    string        // 命中的风控规则名
+	From        time.Time     // 下单时间下限 (含)
+	To          time.Time     // 下单时间上限 (含)
+	StaleFor    time.Duration // 停留在当前状态超过该时长
+	Now         time.Time     // 计算 StaleFor 的基准时间
+}
+
+// ListQuery 把筛选条件转换成 Temporal Visibility 查询语句
+func (f OrderListFilter) ListQuery() (string, error) {
+	conds := []string{"WorkflowType = 'OrderFulfillmentWorkflow'"}
+
+	for _, kv := range []struct {
+		key   string
+		value string
+	}{
+		{SearchAttrOrderStatus.GetName(), f.Status},
+		{SearchAttrCustomerID.GetName(), f.CustomerID},
+		{SearchAttrRiskVerdict.GetName(), f.RiskVerdict},
+		{SearchAttrRiskRules.GetName(), f.RiskRule}, // KeywordList：包含该规则即匹配
+	} {
+		if kv.value == "" {
+			continue
+		}
+		if strings.ContainsAny(kv.value, `'"\`) {
+			return "", fmt.Errorf("%s 包含非法字符", kv.key)
+		}
+		conds = append(conds, fmt.Sprintf("%s = '%s'", kv.key, kv.value))
+	}
+
+	if !f.From.IsZero() {
+		conds = append(conds, fmt.Sprintf("StartTime >= '%s'", f.From.UTC().Format(time.RFC3339)))
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, fmt.Sprintf("StartTime <= '%s'", f.To.UTC().Format(time.RFC3339)))
+	}
+	if f.StaleFor > 0 {
+		now := f.Now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		conds = append(conds, fmt.Sprintf("%s <= '%s'", SearchAttrStatusChangedAt.GetName(), now.Add(-f.StaleFor).UTC().Format(time.RFC3339)))
+	}
+
+	// SQL 版 Visibility 不支持 ORDER BY，默认即按 StartTime 倒序
+	return strings.Join(conds, " AND "), nil
+}
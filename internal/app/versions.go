@@ -0,0 +1,26 @@
+package app
+
+// OrderFulfillmentWorkflow 的版本变更记录 (workflow.GetVersion 的 changeID)
+//
+// 运行中的订单会在新 Worker 上重放历史，任何改变命令序列的修改
+// (增删 Activity / Timer / 子流程 / Marker、调整顺序等) 都必须：
+//  1. 在这里新增一个 changeID，并用 workflow.GetVersion 同时保留新旧两段逻辑；
+//  2. 用旧代码录制一份历史放进 testdata/ (temporal workflow show -w <id> -o json)，
+//     TestReplayWorkflowHistories 会自动重放；
+//  3. 旧版本订单全部结束后 (超过保留期)，才能把 minSupported 提升并删除旧分支。
+//
+// 只改 Query / Update / 日志文案等不产生命令的逻辑不需要新版本。
+const (
+	// 人工审核增加催办/升级/超时自动拒绝计时器
+	versionReviewSLA = "review-sla"
+	// 风控由金额判断改为 AssessRisk 规则引擎 Activity
+	versionRiskEngine = "risk-engine"
+	// 每次状态流转时 UpsertSearchAttributes (风控评估后的流转一并写入 RiskVerdict / RiskRules)
+	versionSearchAttributes = "search-attributes"
+	// 每次状态流转时调用 ProjectOrderEvent 写 MySQL 读模型
+	versionReadModel = "read-model"
+	// 秒杀预占：失败/补偿时 ReleaseReservation，支付成功后 ConfirmReservation
+	versionFlashReservation = "flash-reservation"
+	// 每次状态流转时 EnqueueWebhooks，每条投递启动一个 WebhookDeliveryWorkflow 子流程 (ABANDON)
+	versionWebhooks = "webhooks"
+)
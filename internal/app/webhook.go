@@ -0,0 +1,289 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/client"
+	"gorm.io/gorm"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/webhook"
+)
+
+// 订单生命周期的 Webhook 事件类型；风控检查/审核等内部状态不推送
+const (
+	WebhookOrderCreated        = "order.created"
+	WebhookOrderPendingPayment = "order.pending_payment"
+	WebhookOrderPaid           = "order.paid"
+	WebhookOrderShipped        = "order.shipped"
+	WebhookOrderCancelled      = "order.cancelled"
+	WebhookOrderRejected       = "order.rejected"
+	WebhookOrderFailed         = "order.failed"
+)
+
+// 明确不支持的事件类型 (订阅时返回原因，而不是当作未知类型)
+var unsupportedWebhookEvents = map[string]string{
+	"order.refunded": "当前没有退款流程，不推送 order.refunded",
+}
+
+var webhookEventTypes = map[common.OrderState]string{
+	common.StateReserving:      WebhookOrderCreated,
+	common.StatePendingPayment: WebhookOrderPendingPayment,
+	common.StateShipping:       WebhookOrderPaid,    // 支付成功后进入发货
+	common.StateCompleted:      WebhookOrderShipped, // 所有包裹已发出
+	common.StateCancelled:      WebhookOrderCancelled,
+	common.StateRejected:       WebhookOrderRejected,
+	common.StateFailed:         WebhookOrderFailed,
+}
+
+// WebhookEventType 状态流转对应的事件类型，不推送的状态返回 false
+func WebhookEventType(state common.OrderState) (string, bool) {
+	t, ok := webhookEventTypes[state]
+	return t, ok
+}
+
+// WebhookEventTypes 所有可订阅的事件类型
+func WebhookEventTypes() []string {
+	types := make([]string, 0, len(webhookEventTypes))
+	for _, t := range webhookEventTypes {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// WebhookSubscription 内部系统的 Webhook 订阅 (webhook_subscriptions 表)
+// 订阅没有归属，每个订阅都会收到所有订单的事件，因此只能由管理员创建、只能投递到 WebhookService.AllowedHosts 中的主机
+type WebhookSubscription struct {
+	ID         uint   `gorm:"primaryKey"`
+	URL        string `gorm:"size:512"`
+	Secret     string `gorm:"size:128"` // HMAC-SHA256 签名密钥，只在创建时返回
+	EventTypes string `gorm:"size:512"` // 逗号分隔
+	Active     bool   `gorm:"index"`    // 停用后不再产生新的投递，已有的投递进入死信
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Events 订阅的事件类型
+func (s *WebhookSubscription) Events() []string {
+	return strings.Split(s.EventTypes, ",")
+}
+
+// Subscribes 是否订阅了该事件类型
+func (s *WebhookSubscription) Subscribes(eventType string) bool {
+	return slices.Contains(s.Events(), eventType)
+}
+
+// WebhookDeliveryStatus 投递状态
+//
+//	PENDING --(2xx)--> DELIVERED
+//	PENDING --(重试耗尽 / 订阅已停用)--> DEAD --(重放)--> REPLAYED (新建一条 PENDING 投递)
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "PENDING"
+	DeliveryDelivered WebhookDeliveryStatus = "DELIVERED"
+	DeliveryDead      WebhookDeliveryStatus = "DEAD"
+	DeliveryReplayed  WebhookDeliveryStatus = "REPLAYED"
+)
+
+// WebhookDelivery 一个事件对一个订阅的投递 (webhook_deliveries 表)，DEAD 即死信记录
+// 请求体在创建时固定，重试与重放发送完全相同的内容 (签名时间戳除外)
+type WebhookDelivery struct {
+	ID             uint                  `gorm:"primaryKey"`
+	SubscriptionID uint                  `gorm:"index"`
+	EventID        string                `gorm:"size:128;index"` // <订单号>-<事件序号>
+	EventType      string                `gorm:"size:64"`
+	OrderID        string                `gorm:"size:64;index"`
+	Payload        string                `gorm:"type:text"`
+	Status         WebhookDeliveryStatus `gorm:"size:16;index"`
+	Attempts       int
+	LastStatusCode int
+	LastError      string `gorm:"type:text"`
+	ReplayOf       *uint  // 重放时指向原投递
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// WebhookModels Webhook 相关的表
+func WebhookModels() []interface{} {
+	return []interface{}{&WebhookSubscription{}, &WebhookDelivery{}}
+}
+
+// WebhookPayload 推送的请求体
+type WebhookPayload struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookOrderData `json:"data"`
+}
+
+// WebhookOrderData 流转时的订单快照；不含客户 ID、地址等个人信息 (接收方需要时按订单号回查)
+type WebhookOrderData struct {
+	OrderID     string   `json:"order_id"`
+	Status      string   `json:"status"`
+	StatusLabel string   `json:"status_label"`
+	Reason      string   `json:"reason,omitempty"`
+	Amount      int      `json:"amount"`
+	Items       []string `json:"items"`
+	Campaign    string   `json:"campaign,omitempty"`
+}
+
+var (
+	ErrWebhookNotFound    = errors.New("订阅或投递记录不存在")
+	ErrDeliveryInProgress = errors.New("投递仍在进行中")
+)
+
+// WebhookInputError 订阅参数错误，Field 为出错的参数名
+type WebhookInputError struct {
+	Field  string
+	Reason string // 附加说明 (如明确不支持的事件类型)
+}
+
+func (e *WebhookInputError) Error() string {
+	return "Webhook 参数错误: " + e.Field
+}
+
+// webhookWorkflowID 投递 Workflow 的 ID (重放使用)
+func webhookWorkflowID(deliveryID uint) string {
+	return fmt.Sprintf("WEBHOOK-%d", deliveryID)
+}
+
+// WebhookService 订阅管理、死信查询与重放 (后台 API 使用)
+type WebhookService struct {
+	DB     *gorm.DB
+	Client client.Client
+	// AllowedHosts 允许订阅的内部主机名 (WEBHOOK_ALLOWED_HOSTS)，未配置时不能创建订阅
+	AllowedHosts []string
+}
+
+// Create 创建订阅；未指定密钥时生成一个 (只在创建时返回)
+func (s *WebhookService) Create(ctx context.Context, target, secret string, eventTypes []string) (*WebhookSubscription, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(target) > 512 {
+		return nil, &WebhookInputError{Field: "url"}
+	}
+	if !slices.Contains(s.AllowedHosts, u.Hostname()) {
+		return nil, &WebhookInputError{Field: "url", Reason: "只能订阅 WEBHOOK_ALLOWED_HOSTS 中的内部主机"}
+	}
+	known := WebhookEventTypes()
+	if len(eventTypes) == 0 {
+		return nil, &WebhookInputError{Field: "event_types"}
+	}
+	for _, t := range eventTypes {
+		if reason, ok := unsupportedWebhookEvents[t]; ok {
+			return nil, &WebhookInputError{Field: "event_types", Reason: reason}
+		}
+		if !slices.Contains(known, t) {
+			return nil, &WebhookInputError{Field: "event_types"}
+		}
+	}
+	if secret == "" {
+		secret = webhook.NewSecret()
+	} else if len(secret) < 16 || len(secret) > 128 {
+		return nil, &WebhookInputError{Field: "secret"}
+	}
+
+	slices.Sort(eventTypes)
+	sub := WebhookSubscription{URL: target, Secret: secret, EventTypes: strings.Join(slices.Compact(eventTypes), ","), Active: true}
+	if err := s.DB.WithContext(ctx).Create(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// List 所有订阅 (含已停用)
+func (s *WebhookService) List(ctx context.Context) ([]WebhookSubscription, error) {
+	var subs []WebhookSubscription
+	err := s.DB.WithContext(ctx).Order("id").Find(&subs).Error
+	return subs, err
+}
+
+// Deactivate 停用订阅 (保留投递记录)
+func (s *WebhookService) Deactivate(ctx context.Context, id uint) (*WebhookSubscription, error) {
+	var sub WebhookSubscription
+	err := s.DB.WithContext(ctx).First(&sub, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWebhookNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := s.DB.WithContext(ctx).Model(&sub).Update("active", false).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Deliveries 最近的投递记录，status 为空时不过滤 (DEAD 即死信队列)
+func (s *WebhookService) Deliveries(ctx context.Context, status WebhookDeliveryStatus, limit int) ([]WebhookDelivery, error) {
+	q := s.DB.WithContext(ctx).Order("id DESC").Limit(limit)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var deliveries []WebhookDelivery
+	err := q.Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Replay 重新投递：复制原投递 (事件 ID 与请求体不变) 并启动投递 Workflow，重试策略与首次投递相同
+// 原投递为死信时标记为 REPLAYED；投递中的记录不能重放；订阅已停用时视为不存在
+func (s *WebhookService) Replay(ctx context.Context, id uint) (*WebhookDelivery, error) {
+	var replay WebhookDelivery
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orig WebhookDelivery
+		if err := tx.First(&orig, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWebhookNotFound
+		} else if err != nil {
+			return err
+		}
+		if orig.Status == DeliveryPending {
+			return ErrDeliveryInProgress
+		}
+		var sub WebhookSubscription
+		if err := tx.First(&sub, orig.SubscriptionID).Error; errors.Is(err, gorm.ErrRecordNotFound) || err == nil && !sub.Active {
+			return ErrWebhookNotFound
+		} else if err != nil {
+			return err
+		}
+
+		replay = WebhookDelivery{
+			SubscriptionID: orig.SubscriptionID,
+			EventID:        orig.EventID,
+			EventType:      orig.EventType,
+			OrderID:        orig.OrderID,
+			Payload:        orig.Payload,
+			Status:         DeliveryPending,
+			ReplayOf:       &orig.ID,
+		}
+		if err := tx.Create(&replay).Error; err != nil {
+			return err
+		}
+		if orig.Status == DeliveryDead {
+			return tx.Model(&orig).Update("status", DeliveryReplayed).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.Client.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:        webhookWorkflowID(replay.ID),
+		TaskQueue: common.TaskQueue,
+	}, WebhookDeliveryWorkflow, replay.ID)
+	if err != nil {
+		// 启动失败：新投递直接进入死信，可以再次重放
+		replay.Status = DeliveryDead
+		replay.LastError = "启动投递失败: " + err.Error()
+		_ = s.DB.WithContext(ctx).Model(&replay).Updates(map[string]interface{}{"status": replay.Status, "last_error": replay.LastError}).Error
+		return nil, err
+	}
+	return &replay, nil
+}
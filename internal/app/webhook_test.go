@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/temporal"
+
+	"omniflow/internal/common"
+	"omniflow/internal/pkg/webhook"
+)
+
+// webhookReceiver 校验签名并记录收到的事件
+type webhookReceiver struct {
+	mu       sync.Mutex
+	secret   string
+	status   int
+	received []WebhookPayload
+	eventIDs []string
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	if err := webhook.Verify(r.secret, req.Header.Get(webhook.SignatureHeader), body, time.Now(), webhook.DefaultTolerance); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.status != http.StatusOK {
+		w.WriteHeader(r.status)
+		return
+	}
+	var p WebhookPayload
+	_ = json.Unmarshal(body, &p)
+	r.received = append(r.received, p)
+	r.eventIDs = append(r.eventIDs, req.Header.Get(webhook.EventIDHeader))
+}
+
+func (r *webhookReceiver) respond(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func TestWebhooks_DeliveryDeadLetterReplay(t *testing.T) {
+	db := setupTestDB()
+	ctx := context.Background()
+	receiver := &webhookReceiver{secret: "merchant-secret-0123456789", status: http.StatusInternalServerError}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	temporalClient := &mocks.Client{}
+	srvURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	svc := &WebhookService{DB: db, Client: temporalClient, AllowedHosts: []string{srvURL.Hostname()}}
+
+	// 参数校验；只能订阅内部主机；未指定密钥时自动生成
+	_, err = svc.Create(ctx, "ftp://example.com", "", []string{WebhookOrderPaid})
+	assert.Equal(t, &WebhookInputError{Field: "url"}, err)
+	_, err = svc.Create(ctx, "https://hooks.example.com/omniflow", "", []string{WebhookOrderPaid})
+	var inputErr *WebhookInputError
+	require.ErrorAs(t, err, &inputErr)
+	assert.Equal(t, "url", inputErr.Field)
+	assert.NotEmpty(t, inputErr.Reason)
+	_, err = svc.Create(ctx, srv.URL, "", []string{"order.unknown"})
+	assert.Equal(t, &WebhookInputError{Field: "event_types"}, err)
+	_, err = svc.Create(ctx, srv.URL, "", []string{WebhookOrderPaid, "order.refunded"})
+	assert.Equal(t, &WebhookInputError{Field: "event_types", Reason: unsupportedWebhookEvents["order.refunded"]}, err)
+	generated, err := svc.Create(ctx, srv.URL+"/paid", "", []string{WebhookOrderPaid})
+	require.NoError(t, err)
+	assert.Contains(t, generated.Secret, "whsec_")
+
+	sub, err := svc.Create(ctx, srv.URL, receiver.secret, []string{WebhookOrderCancelled, WebhookOrderShipped})
+	require.NoError(t, err)
+	stopped, err := svc.Create(ctx, srv.URL+"/stopped", receiver.secret, []string{WebhookOrderCancelled})
+	require.NoError(t, err)
+	_, err = svc.Deactivate(ctx, stopped.ID)
+	require.NoError(t, err)
+
+	acts := &WebhookActivities{DB: db}
+	order := common.Order{OrderID: "WH_ORDER_1", CustomerID: "C1", Amount: 300, Items: []string{"iPhone15"}}
+	event := common.OrderEvent{OrderID: order.OrderID, Seq: 5, Status: string(common.StateCancelled), Label: "已取消", Reason: "支付超时", OccurredAt: time.Now(), Order: order}
+
+	// 内部状态不产生投递；只有订阅了该事件的启用订阅产生投递，重试不会重复生成
+	ids, err := acts.EnqueueWebhooks(ctx, common.OrderEvent{OrderID: order.OrderID, Seq: 2, Status: string(common.StateRiskCheck), Order: order})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+	ids, err = acts.EnqueueWebhooks(ctx, event)
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+	again, err := acts.EnqueueWebhooks(ctx, event)
+	require.NoError(t, err)
+	assert.Equal(t, ids, again)
+
+	// 接收方报错：记录失败原因，返回错误交给 Temporal 重试
+	require.Error(t, acts.deliver(ctx, ids[0], 1))
+	var d WebhookDelivery
+	require.NoError(t, db.First(&d, ids[0]).Error)
+	assert.Equal(t, DeliveryPending, d.Status)
+	assert.Equal(t, sub.ID, d.SubscriptionID)
+	assert.NotContains(t, d.Payload, "customer_id", "请求体不含客户个人信息")
+	assert.Equal(t, http.StatusInternalServerError, d.LastStatusCode)
+
+	// 最后一次仍失败：进入死信，不再重试
+	err = acts.deliver(ctx, ids[0], WebhookMaxAttempts)
+	var appErr *temporal.ApplicationError
+	require.ErrorAs(t, err, &appErr)
+	assert.True(t, appErr.NonRetryable())
+	dead, err := svc.Deliveries(ctx, DeliveryDead, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, ids[0], dead[0].ID)
+	assert.Equal(t, WebhookMaxAttempts, dead[0].Attempts)
+
+	// 重放：复制出一条新投递并启动投递 Workflow，原死信标记为 REPLAYED
+	temporalClient.On("ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(&mocks.WorkflowRun{}, nil).Once()
+	replay, err := svc.Replay(ctx, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryPending, replay.Status)
+	assert.Equal(t, ids[0], *replay.ReplayOf)
+	temporalClient.AssertExpectations(t)
+	_, err = svc.Replay(ctx, replay.ID)
+	assert.ErrorIs(t, err, ErrDeliveryInProgress)
+	dead, _ = svc.Deliveries(ctx, DeliveryDead, 10)
+	assert.Empty(t, dead)
+
+	receiver.respond(http.StatusOK)
+	require.NoError(t, acts.deliver(ctx, replay.ID, 1))
+	// 已送达的投递再次执行 (Activity 结果未回报时的重试) 不会重复推送
+	require.NoError(t, acts.deliver(ctx, replay.ID, 2))
+	var delivered WebhookDelivery
+	require.NoError(t, db.First(&delivered, replay.ID).Error)
+	assert.Equal(t, DeliveryDelivered, delivered.Status)
+	assert.NotNil(t, delivered.DeliveredAt)
+
+	require.Len(t, receiver.received, 1)
+	assert.Equal(t, []string{"WH_ORDER_1-5"}, receiver.eventIDs)
+	got := receiver.received[0]
+	assert.Equal(t, WebhookOrderCancelled, got.Type)
+	assert.Equal(t, "WH_ORDER_1", got.Data.OrderID)
+	assert.Equal(t, "支付超时", got.Data.Reason)
+	assert.Equal(t, 300, got.Data.Amount)
+
+	// 停用的订阅不能重放 (进行中的投递会直接进入死信)
+	_, err = svc.Deactivate(ctx, sub.ID)
+	require.NoError(t, err)
+	_, err = svc.Replay(ctx, replay.ID)
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+}
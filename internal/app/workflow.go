@@ -2,6 +2,7 @@ package app
 
 import (
 	"omniflow/internal/common"
+	"strings"
 	"time"
 
 	"go.temporal.io/sdk/temporal"
@@ -16,67 +17,236 @@ func OrderFulfillmentWorkflow(ctx workflow.Context, order common.Order) (*common
 	ctx = workflow.WithActivityOptions(ctx, ao)
 	logger := workflow.GetLogger(ctx)
 
-	// 状态查询支持
-	currentState := "初始化"
+	// 状态机：记录每次流转的时间与原因
+	// get_order_status 返回中文文案 (兼容旧调用方)，get_order_timeline 返回结构化时间线
+	sm := common.NewStateMachine(workflow.Now(ctx))
 	workflow.SetQueryHandler(ctx, "get_order_status", func() (string, error) {
-		return currentState, nil
+		return sm.Label(), nil
 	})
+	workflow.SetQueryHandler(ctx, "get_order_timeline", func() (common.OrderTimeline, error) {
+		return sm.Timeline(), nil
+	})
+
+	// 状态流转：写入时间线，并把状态码写入搜索属性 (订单列表 / 卡单排查)
+	// 首次流转时一并写入客户、金额、活动、商品等不变的属性
+	// 同时投影到 MySQL 读模型 (失败只记日志，不影响订单本身)
+	upsertSearchAttrs := workflow.GetVersion(ctx, versionSearchAttributes, workflow.DefaultVersion, 1) != workflow.DefaultVersion
+	projectReadModel := workflow.GetVersion(ctx, versionReadModel, workflow.DefaultVersion, 1) != workflow.DefaultVersion
+	projCtx := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 5},
+	})
+	var projActs *ProjectionActivities
+	// Webhook：每次流转生成投递记录，投递在独立的子流程中重试，订单结束不等待接收方
+	sendWebhooks := workflow.GetVersion(ctx, versionWebhooks, workflow.DefaultVersion, 1) != workflow.DefaultVersion
+	webhooks := newWebhookDispatcher(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+		RetryPolicy:         &temporal.RetryPolicy{MaximumAttempts: 5},
+	})
+	// 风控评估结果 (审核人查看命中原因)；评估之后的流转随事件投影到读模型，并写入搜索属性
+	var assessment common.RiskAssessment
+	assessed := false
+	workflow.SetQueryHandler(ctx, "get_risk_assessment", func() (common.RiskAssessment, error) {
+		return assessment, nil
+	})
+
+	eventSeq := 0
+	attrsInitialized := false
+	riskAttrsInitialized := false
+	transition := func(state common.OrderState, reason string) {
+		prev := sm.Current().State
+		if err := sm.Transition(state, workflow.Now(ctx), reason); err != nil {
+			logger.Error("状态流转被拒绝", "error", err)
+			return
+		}
+		// 同一状态内的进展 (催办/升级) 只记入时间线
+		if state == prev {
+			return
+		}
+		status := string(state)
+		eventSeq++
+		event := common.OrderEvent{OrderID: order.OrderID, Seq: eventSeq, Status: status, Label: sm.Label(), Reason: reason, OccurredAt: workflow.Now(ctx), Order: order}
+		if assessed {
+			risk := assessment
+			event.Risk = &risk
+		}
+		if projectReadModel {
+			if err := workflow.ExecuteActivity(projCtx, projActs.ProjectOrderEvent, event).Get(ctx, nil); err != nil {
+				logger.Warn("读模型投影失败", "status", status, "error", err)
+			}
+		}
+		if sendWebhooks {
+			webhooks.dispatch(ctx, event)
+		}
+		if !upsertSearchAttrs {
+			return
+		}
+		updates := []temporal.SearchAttributeUpdate{
+			SearchAttrOrderStatus.ValueSet(status),
+			SearchAttrStatusChangedAt.ValueSet(workflow.Now(ctx)),
+		}
+		if !attrsInitialized {
+			updates = append(updates, SearchAttrAmount.ValueSet(int64(order.Amount)), SearchAttrSKUs.ValueSet(order.Items))
+			if order.CustomerID != "" {
+				updates = append(updates, SearchAttrCustomerID.ValueSet(order.CustomerID))
+			}
+			if order.Campaign != "" {
+				updates = append(updates, SearchAttrCampaign.ValueSet(order.Campaign))
+			}
+			attrsInitialized = true
+		}
+		if assessed && !riskAttrsInitialized {
+			updates = append(updates, SearchAttrRiskVerdict.ValueSet(assessment.Verdict))
+			if rules := assessment.Rules(); len(rules) > 0 {
+				updates = append(updates, SearchAttrRiskRules.ValueSet(rules))
+			}
+			riskAttrsInitialized = true
+		}
+		if err := workflow.UpsertTypedSearchAttributes(ctx, updates...); err != nil {
+			logger.Warn("搜索属性更新失败", "status", status, "error", err)
+		}
+	}
+
+	// 秒杀预占按下单时的 SKU 存放 (删除商品行会修改 order.Items，先记下来)
+	flashSKU := order.FlashSKU()
+
+	// 同步修改订单 (Update)
+	progress := &orderProgress{}
+	payments := workflow.NewBufferedChannel(ctx, 1)
+	if err := registerUpdateHandlers(ctx, &order, progress, ao, payments); err != nil {
+		return nil, err
+	}
+	// 结束订单：拒绝后续修改，并等待进行中的修改完成
+	finish := func() {
+		progress.Finished = true
+		waitForUpdates(ctx)
+	}
 
 	// var invActs *InventoryActivities
 	invActs := &InventoryActivities{}
 	var compensations []func(workflow.Context) error
 
+	// 秒杀预占 (api-server 在 Redis 漏斗中扣减)：任何失败都要把库存放回 Redis，支付成功后才算售出
+	flashReservation := workflow.GetVersion(ctx, versionFlashReservation, workflow.DefaultVersion, 1) != workflow.DefaultVersion
+	var flashActs *FlashSaleActivities
+	if flashReservation {
+		compensations = append(compensations, func(ctx workflow.Context) error {
+			return workflow.ExecuteActivity(ctx, flashActs.ReleaseReservation, order.OrderID, flashSKU).Get(ctx, nil)
+		})
+	}
+
 	// === Step 1: 预占库存 ===
-	currentState = "正在预占库存"
+	transition(common.StateReserving, "")
 	if err := workflow.ExecuteActivity(ctx, invActs.ReserveInventory, order).Get(ctx, nil); err != nil {
-		currentState = "库存失败"
-		return &common.OrderStatus{Status: "FAILED", Message: err.Error()}, nil
+		finish()
+		rollback(ctx, compensations)
+		transition(common.StateFailed, err.Error())
+		return &common.OrderStatus{Status: string(common.StateFailed), Message: err.Error()}, nil
 	}
+	progress.Reserved = true
 
 	// 注册补偿
 	compensations = append(compensations, func(ctx workflow.Context) error {
 		return workflow.ExecuteActivity(ctx, invActs.ReleaseInventory, order).Get(ctx, nil)
 	})
 
-	// === Step 2: 风控 (大额订单) ===
-	if order.Amount > 10000 {
-		currentState = "⚠️ 待风控审核"
-		var action string
-		workflow.GetSignalChannel(ctx, "SIGNAL_ADMIN_ACTION").Receive(ctx, &action)
+	// === Step 2: 风控 (规则引擎 + 人工审核 SLA) ===
+	transition(common.StateRiskCheck, "")
+	if workflow.GetVersion(ctx, versionRiskEngine, workflow.DefaultVersion, 1) == workflow.DefaultVersion {
+		// 旧版本：只按金额判断，不调用风控 Activity
+		assessment = common.RiskAssessment{Verdict: common.RiskApprove}
+		if order.Amount > 10000 {
+			assessment = common.RiskAssessment{Verdict: common.RiskReview, Reasons: []string{"订单金额超过 10000"}}
+		}
+	} else {
+		var riskActs *RiskActivities
+		if err := workflow.ExecuteActivity(ctx, riskActs.AssessRisk, order).Get(ctx, &assessment); err != nil {
+			// 风控引擎不可用时保守处理：转人工
+			assessment = common.RiskAssessment{Verdict: common.RiskReview, Reasons: []string{"风控引擎不可用: " + err.Error()}}
+		}
+	}
+	assessed = true
+
+	if assessment.Verdict == common.RiskReject {
+		finish()
+		rollback(ctx, compensations)
+		reason := strings.Join(assessment.Reasons, "; ")
+		transition(common.StateRejected, "风控: "+reason)
+		return &common.OrderStatus{Status: string(common.StateRejected), Message: reason}, nil
+	}
+
+	if assessment.Verdict == common.RiskReview {
+		transition(common.StateRiskReview, reviewPolicy(order).PrimaryGroup)
+		action, timedOut := awaitReview(ctx, order, func(reason string) { transition(common.StateRiskReview, reason) })
+		if timedOut {
+			finish()
+			rollback(ctx, compensations)
+			transition(common.StateRejected, "审核超时")
+			return &common.OrderStatus{Status: string(common.StateRejected), Message: "风控审核超时，自动拒绝"}, nil
+		}
 		if action == "REJECT" {
+			finish()
 			rollback(ctx, compensations)
-			currentState = "已拒绝"
-			return &common.OrderStatus{Status: "REJECTED"}, nil
+			transition(common.StateRejected, "人工审核拒绝")
+			return &common.OrderStatus{Status: string(common.StateRejected)}, nil
 		}
 	}
 
 	// === Step 3: 支付 (含超时) ===
-	currentState = "待支付 (30s超时)"
+	transition(common.StatePendingPayment, "30s超时")
 	selector := workflow.NewSelector(ctx)
 	hasPaid := false
+	cancelReason := ""
 
 	selector.AddReceive(workflow.GetSignalChannel(ctx, "SIGNAL_PAYMENT_PAID"), func(c workflow.ReceiveChannel, more bool) {
 		c.Receive(ctx, nil)
 		hasPaid = true
+		progress.PaymentDecided = true
+	})
+	// pay_order / cancel_order Update
+	selector.AddReceive(payments, func(c workflow.ReceiveChannel, more bool) {
+		var d paymentDecision
+		c.Receive(ctx, &d)
+		hasPaid, cancelReason = d.Paid, d.Reason
+		progress.PaymentAppliedBy = d.UpdateID
 	})
 	selector.AddFuture(workflow.NewTimer(ctx, 30*time.Second), func(f workflow.Future) {
 		logger.Info("超时触发")
 	})
 
+	progress.AwaitingPayment = true
 	selector.Select(ctx)
+	progress.AwaitingPayment = false
+	// 记录实际采用的结果，等待中的 pay_order / cancel_order 据此返回
+	progress.PaymentResolved, progress.Paid = true, hasPaid
 
 	if !hasPaid {
+		finish()
 		rollback(ctx, compensations)
-		currentState = "已取消 (超时)"
-		return &common.OrderStatus{Status: "CANCELLED"}, nil
+		if cancelReason != "" {
+			transition(common.StateCancelled, cancelReason)
+			return &common.OrderStatus{Status: string(common.StateCancelled), Message: cancelReason}, nil
+		}
+		transition(common.StateCancelled, "支付超时")
+		return &common.OrderStatus{Status: string(common.StateCancelled)}, nil
+	}
+
+	if flashReservation {
+		// 确认失败不影响发货，过期后由 Sweeper 根据订单结果确认
+		if err := workflow.ExecuteActivity(ctx, flashActs.ConfirmReservation, order.OrderID, flashSKU).Get(ctx, nil); err != nil {
+			logger.Warn("秒杀预占确认失败", "error", err)
+		}
 	}
 
 	// === Step 4: 拆单 (子流程) ===
-	currentState = "拆单发货中"
+	// 进入发货后不再接受修改，先等进行中的修改落定
+	progress.ShippingStarted = true
+	waitForUpdates(ctx)
+	transition(common.StateShipping, "")
 	// 模拟拆成两个包裹
 	pkgs := []common.Shipment{
-		{ShipmentID: order.OrderID + "-A", OrderID: order.OrderID, Warehouse: "Shanghai"},
-		{ShipmentID: order.OrderID + "-B", OrderID: order.OrderID, Warehouse: "Guangzhou"},
+		{ShipmentID: order.OrderID + "-A", OrderID: order.OrderID, Warehouse: "Shanghai", Address: order.ShippingAddress},
+		{ShipmentID: order.OrderID + "-B", OrderID: order.OrderID, Warehouse: "Guangzhou", Address: order.ShippingAddress},
 	}
 
 	var futures []workflow.ChildWorkflowFuture
@@ -91,8 +261,9 @@ func OrderFulfillmentWorkflow(ctx workflow.Context, order common.Order) (*common
 		}
 	}
 
-	currentState = "已完成"
-	return &common.OrderStatus{Status: "COMPLETED"}, nil
+	finish()
+	transition(common.StateCompleted, "")
+	return &common.OrderStatus{Status: string(common.StateCompleted)}, nil
 }
 
 func rollback(ctx workflow.Context, compensations []func(workflow.Context) error) {
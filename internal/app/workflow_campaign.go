@@ -0,0 +1,42 @@
+package app
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+var campaignActivityOptions = workflow.ActivityOptions{
+	StartToCloseTimeout: 30 * time.Second,
+	RetryPolicy: &temporal.RetryPolicy{
+		InitialInterval: time.Second,
+		MaximumInterval: 10 * time.Second,
+	},
+}
+
+// CampaignStartWorkflow 由活动开始 Schedule 触发：发布活动、预热库存
+func CampaignStartWorkflow(ctx workflow.Context, campaignID string) error {
+	ctx = workflow.WithActivityOptions(ctx, campaignActivityOptions)
+	var a *CampaignActivities
+	return workflow.ExecuteActivity(ctx, a.ActivateCampaign, campaignID).Get(ctx, nil)
+}
+
+// campaignSettleOptions 最终对账要等待结束时的预占全部确认或释放 (最长约为预占有效期)，按分钟级间隔重试
+var campaignSettleOptions = workflow.ActivityOptions{
+	StartToCloseTimeout: 30 * time.Second,
+	RetryPolicy: &temporal.RetryPolicy{
+		InitialInterval:    time.Minute,
+		BackoffCoefficient: 2,
+		MaximumInterval:    10 * time.Minute,
+	},
+}
+
+// CampaignEndWorkflow 由活动结束 Schedule 触发：关闭漏斗并对账，待定的预占全部结束后再做最终对账
+func CampaignEndWorkflow(ctx workflow.Context, campaignID string) error {
+	var a *CampaignActivities
+	if err := workflow.ExecuteActivity(workflow.WithActivityOptions(ctx, campaignActivityOptions), a.EndCampaign, campaignID).Get(ctx, nil); err != nil {
+		return err
+	}
+	return workflow.ExecuteActivity(workflow.WithActivityOptions(ctx, campaignSettleOptions), a.SettleCampaign, campaignID).Get(ctx, nil)
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"fmt"
+	"omniflow/internal/common"
+	"time"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// reviewPolicy 订单携带的审核 SLA，未指定时使用默认值
+func reviewPolicy(order common.Order) common.ReviewPolicy {
+	if order.ReviewPolicy != nil {
+		return *order.ReviewPolicy
+	}
+	return common.DefaultReviewPolicy()
+}
+
+// awaitReview 等待管理员审核信号，期间按 SLA 依次催办、升级、超时自动拒绝
+// 催办/升级通过 progress 回调记入状态时间线
+// 返回审核动作；timedOut=true 表示到达 RejectAfter 仍无人处理
+func awaitReview(ctx workflow.Context, order common.Order, progress func(reason string)) (action string, timedOut bool) {
+	policy := reviewPolicy(order)
+	logger := workflow.GetLogger(ctx)
+	notifyActs := &NotificationActivities{}
+	signalCh := workflow.GetSignalChannel(ctx, "SIGNAL_ADMIN_ACTION")
+	start := workflow.Now(ctx)
+
+	notify := func(group, kind string) {
+		notice := common.ReviewNotice{OrderID: order.OrderID, Group: group, Kind: kind, Waited: workflow.Now(ctx).Sub(start)}
+		// 通知失败不影响审核流程本身
+		if err := workflow.ExecuteActivity(ctx, notifyActs.NotifyReviewers, notice).Get(ctx, nil); err != nil {
+			logger.Warn("审核通知发送失败", "kind", kind, "error", err)
+		}
+	}
+
+	if workflow.GetVersion(ctx, versionReviewSLA, workflow.DefaultVersion, 1) == workflow.DefaultVersion {
+		// 旧版本：无 SLA 计时，一直等待审核
+		signalCh.Receive(ctx, &action)
+		return action, false
+	}
+
+	stages := []struct {
+		after  time.Duration
+		onFire func()
+	}{
+		{policy.RemindAfter, func() {
+			notify(policy.PrimaryGroup, common.ReviewNoticeRemind)
+			progress(fmt.Sprintf("已催办 %s", policy.PrimaryGroup))
+		}},
+		{policy.EscalateAfter, func() {
+			notify(policy.EscalationGroup, common.ReviewNoticeEscalate)
+			progress(fmt.Sprintf("已升级至 %s", policy.EscalationGroup))
+		}},
+		{policy.RejectAfter, func() {
+			timedOut = true
+		}},
+	}
+
+	for _, stage := range stages {
+		if stage.after <= 0 {
+			continue
+		}
+		received := false
+		if remaining := stage.after - workflow.Now(ctx).Sub(start); remaining > 0 {
+			timerCtx, cancelTimer := workflow.WithCancel(ctx)
+			selector := workflow.NewSelector(ctx)
+			selector.AddReceive(signalCh, func(c workflow.ReceiveChannel, more bool) {
+				c.Receive(ctx, &action)
+				received = true
+			})
+			selector.AddFuture(workflow.NewTimer(timerCtx, remaining), func(f workflow.Future) {})
+			selector.Select(ctx)
+			cancelTimer()
+		} else {
+			// 阶段已过期 (阶段时长未递增，或前一阶段的通知耗时超过间隔)：不再计时，
+			// 已到达的审核信号优先，否则立即触发该阶段
+			received = signalCh.ReceiveAsync(&action)
+		}
+
+		if received {
+			return action, false
+		}
+		stage.onFire()
+		if timedOut {
+			return "REJECT", true
+		}
+	}
+
+	// 未配置自动拒绝：一直等到有人处理
+	signalCh.Receive(ctx, &action)
+	return action, false
+}
@@ -3,17 +3,45 @@ package app
 import (
 	"errors"
 	"omniflow/internal/common"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
 )
 
+// mockRisk 让风控评估直接返回指定结论
+func mockRisk(env *testsuite.TestWorkflowEnvironment, verdict string) {
+	riskActs := &RiskActivities{}
+	env.OnActivity(riskActs.AssessRisk, mock.Anything, mock.Anything).
+		Return(common.RiskAssessment{Verdict: verdict, Reasons: []string{"[test] " + verdict}}, nil).Once()
+}
+
+// mockProjection 读模型投影与 Webhook 在 Activity 测试中单独验证，这里直接放行 (没有订阅，不产生投递)
+func mockProjection(env *testsuite.TestWorkflowEnvironment) {
+	projActs := &ProjectionActivities{}
+	env.OnActivity(projActs.ProjectOrderEvent, mock.Anything, mock.Anything).Return(nil)
+	webhookActs := &WebhookActivities{}
+	env.OnActivity(webhookActs.EnqueueWebhooks, mock.Anything, mock.Anything).Return([]uint(nil), nil).Maybe()
+}
+
+// mockFlashSale 秒杀预占的确认/释放直接放行 (需要校验调用次数的测试单独 mock)
+func mockFlashSale(env *testsuite.TestWorkflowEnvironment) {
+	flashActs := &FlashSaleActivities{}
+	env.OnActivity(flashActs.ReleaseReservation, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	env.OnActivity(flashActs.ConfirmReservation, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+}
+
 func TestOrderFulfillmentWorkflow_Timeout(t *testing.T) {
 	s := testsuite.WorkflowTestSuite{}
 	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
 
 	invActs := &InventoryActivities{}
 
@@ -23,6 +51,10 @@ func TestOrderFulfillmentWorkflow_Timeout(t *testing.T) {
 
 	// 同理，ReleaseInventory 也要两个
 	env.OnActivity(invActs.ReleaseInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	// 超时取消：秒杀库存放回 Redis
+	flashActs := &FlashSaleActivities{}
+	env.OnActivity(flashActs.ReleaseReservation, mock.Anything, "TEST_ORDER_TIMEOUT", "iPhone15").Return(nil).Once()
+	mockRisk(env, common.RiskApprove)
 
 	order := common.Order{
 		OrderID: "TEST_ORDER_TIMEOUT",
@@ -45,11 +77,17 @@ func TestOrderFulfillmentWorkflow_Timeout(t *testing.T) {
 func TestOrderFulfillmentWorkflow_Success(t *testing.T) {
 	s := testsuite.WorkflowTestSuite{}
 	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
 
 	invActs := &InventoryActivities{}
 
 	// 1. Activity 只会调用一次
 	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskApprove)
+
+	// 支付成功：秒杀预占转为售出，不归还
+	flashActs := &FlashSaleActivities{}
+	env.OnActivity(flashActs.ConfirmReservation, mock.Anything, "TEST_ORDER_SUCCESS", "").Return(nil).Once()
 
 	// 🔥 修复点：拆单逻辑会启动 2 个子流程，所以这里要改为 .Times(2)
 	env.OnWorkflow(ShippingChildWorkflow, mock.Anything, mock.Anything).Return("SF-123", nil).Times(2)
@@ -74,11 +112,14 @@ func TestOrderFulfillmentWorkflow_Success(t *testing.T) {
 func TestOrderFulfillmentWorkflow_AdminReject(t *testing.T) {
 	s := testsuite.WorkflowTestSuite{}
 	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	mockFlashSale(env)
 	invActs := &InventoryActivities{}
 
-	// Mock: 预占成功，回滚成功
+	// Mock: 预占成功，回滚成功，风控要求人工审核
 	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
 	env.OnActivity(invActs.ReleaseInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskReview)
 
 	// 1. 模拟管理员拒绝信号
 	// 假设风控审核需要 1秒
@@ -110,12 +151,16 @@ func TestOrderFulfillmentWorkflow_AdminReject(t *testing.T) {
 func TestOrderFulfillmentWorkflow_ActivityFail(t *testing.T) {
 	s := testsuite.WorkflowTestSuite{}
 	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
 	invActs := &InventoryActivities{}
 
 	mockErr := errors.New("数据库连接断开")
 
 	// Mock 失败，允许重试多次
 	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(mockErr)
+	// MySQL 预占失败：Redis 里扣掉的秒杀库存也要归还
+	flashActs := &FlashSaleActivities{}
+	env.OnActivity(flashActs.ReleaseReservation, mock.Anything, "FAIL_ORDER", "").Return(nil).Once()
 
 	order := common.Order{OrderID: "FAIL_ORDER", Amount: 100}
 	env.ExecuteWorkflow(OrderFulfillmentWorkflow, order)
@@ -135,3 +180,482 @@ func TestOrderFulfillmentWorkflow_ActivityFail(t *testing.T) {
 	// 验证 Mock 是否生效
 	env.AssertExpectations(t)
 }
+
+func TestOrderFulfillmentWorkflow_ReviewSLA(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	mockFlashSale(env)
+	invActs := &InventoryActivities{}
+	notifyActs := &NotificationActivities{}
+
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(invActs.ReleaseInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskReview)
+
+	// 催办发给一线，升级发给二线
+	env.OnActivity(notifyActs.NotifyReviewers, mock.Anything, mock.MatchedBy(func(n common.ReviewNotice) bool {
+		return n.Kind == common.ReviewNoticeRemind && n.Group == "risk-l1"
+	})).Return(nil).Once()
+	env.OnActivity(notifyActs.NotifyReviewers, mock.Anything, mock.MatchedBy(func(n common.ReviewNotice) bool {
+		return n.Kind == common.ReviewNoticeEscalate && n.Group == "risk-l2"
+	})).Return(nil).Once()
+
+	queryState := func() string {
+		val, err := env.QueryWorkflow("get_order_status")
+		assert.NoError(t, err)
+		var state string
+		val.Get(&state)
+		return state
+	}
+
+	// 每个阶段都能通过状态查询看到
+	env.RegisterDelayedCallback(func() {
+		assert.Contains(t, queryState(), "待风控审核 (risk-l1)")
+	}, time.Minute*5)
+	env.RegisterDelayedCallback(func() {
+		assert.Contains(t, queryState(), "已催办")
+	}, time.Minute*20)
+	env.RegisterDelayedCallback(func() {
+		assert.Contains(t, queryState(), "已升级至 risk-l2")
+	}, time.Minute*50)
+
+	order := common.Order{
+		OrderID: "SLOW_REVIEW_ORDER",
+		Amount:  20000,
+		ReviewPolicy: &common.ReviewPolicy{
+			RemindAfter:     10 * time.Minute,
+			EscalateAfter:   30 * time.Minute,
+			RejectAfter:     time.Hour,
+			PrimaryGroup:    "risk-l1",
+			EscalationGroup: "risk-l2",
+		},
+	}
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, order)
+
+	assert.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+
+	var result common.OrderStatus
+	env.GetWorkflowResult(&result)
+
+	// 无人审核 -> 自动拒绝，并且回滚了库存
+	assert.Equal(t, "REJECTED", result.Status)
+	assert.Contains(t, result.Message, "超时")
+	assert.Equal(t, "已拒绝 (审核超时)", queryState())
+
+	// 时间线：催办/升级作为 RISK_REVIEW 内的进展记录，附带原因与时间
+	val, err := env.QueryWorkflow("get_order_timeline")
+	require.NoError(t, err)
+	var timeline common.OrderTimeline
+	require.NoError(t, val.Get(&timeline))
+	assert.Equal(t, common.StateRejected, timeline.State)
+	var states, reasons []string
+	for _, tr := range timeline.Transitions {
+		states = append(states, string(tr.State))
+		reasons = append(reasons, tr.Reason)
+	}
+	assert.Equal(t, []string{"CREATED", "RESERVING", "RISK_CHECK", "RISK_REVIEW", "RISK_REVIEW", "RISK_REVIEW", "REJECTED"}, states)
+	assert.Equal(t, []string{"", "", "", "risk-l1", "已催办 risk-l1", "已升级至 risk-l2", "审核超时"}, reasons)
+	assert.Equal(t, 10*time.Minute, timeline.Transitions[4].EnteredAt.Sub(timeline.Transitions[3].EnteredAt))
+	env.AssertExpectations(t)
+}
+
+// 旧 api-server 下发的 SLA 可能未校验：升级早于催办时，催办后立即升级，不会卡住或跳过
+func TestOrderFulfillmentWorkflow_ReviewSLAOverdueStage(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	mockFlashSale(env)
+	invActs := &InventoryActivities{}
+	notifyActs := &NotificationActivities{}
+
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(invActs.ReleaseInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskReview)
+	env.OnActivity(notifyActs.NotifyReviewers, mock.Anything, mock.Anything).Return(nil).Twice()
+
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, common.Order{
+		OrderID: "MISORDERED_SLA_ORDER",
+		Amount:  20000,
+		ReviewPolicy: &common.ReviewPolicy{
+			RemindAfter:     30 * time.Minute,
+			EscalateAfter:   10 * time.Minute,
+			RejectAfter:     time.Hour,
+			PrimaryGroup:    "risk-l1",
+			EscalationGroup: "risk-l2",
+		},
+	})
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+
+	val, err := env.QueryWorkflow("get_order_timeline")
+	require.NoError(t, err)
+	var timeline common.OrderTimeline
+	require.NoError(t, val.Get(&timeline))
+	var reasons []string
+	for _, tr := range timeline.Transitions {
+		reasons = append(reasons, tr.Reason)
+	}
+	assert.Equal(t, []string{"", "", "", "risk-l1", "已催办 risk-l1", "已升级至 risk-l2", "审核超时"}, reasons)
+	assert.Equal(t, 30*time.Minute, timeline.Transitions[4].EnteredAt.Sub(timeline.Transitions[3].EnteredAt))
+	assert.Equal(t, timeline.Transitions[4].EnteredAt, timeline.Transitions[5].EnteredAt)
+	assert.Equal(t, time.Hour, timeline.Transitions[6].EnteredAt.Sub(timeline.Transitions[3].EnteredAt))
+	env.AssertExpectations(t)
+}
+
+func TestOrderFulfillmentWorkflow_RiskReject(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	mockFlashSale(env)
+	invActs := &InventoryActivities{}
+	riskActs := &RiskActivities{}
+
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(invActs.ReleaseInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(riskActs.AssessRisk, mock.Anything, mock.Anything).Return(common.RiskAssessment{
+		Verdict: common.RiskReject,
+		Reasons: []string{"[sku_blacklist] 商品 GiftCard 在黑名单中"},
+	}, nil).Once()
+
+	order := common.Order{OrderID: "BLACKLIST_ORDER", Amount: 100, Items: []string{"GiftCard"}}
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, order)
+
+	assert.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+
+	var result common.OrderStatus
+	env.GetWorkflowResult(&result)
+	assert.Equal(t, "REJECTED", result.Status)
+	assert.Contains(t, result.Message, "黑名单")
+
+	// 命中原因保存在订单上，可供审核查询
+	val, err := env.QueryWorkflow("get_risk_assessment")
+	assert.NoError(t, err)
+	var assessment common.RiskAssessment
+	val.Get(&assessment)
+	assert.Equal(t, common.RiskReject, assessment.Verdict)
+	assert.Len(t, assessment.Reasons, 1)
+
+	env.AssertExpectations(t)
+}
+
+func TestOrderFulfillmentWorkflow_Updates(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	mockFlashSale(env)
+	invActs := &InventoryActivities{}
+
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskApprove)
+	// 删除商品行只释放被删除的那一行
+	env.OnActivity(invActs.ReleaseLine, mock.Anything, mock.MatchedBy(func(r common.LineRelease) bool {
+		return r.SKU == "AirPods" && r.RequestID == "remove-1"
+	})).Return(nil).Once()
+	env.OnWorkflow(ShippingChildWorkflow, mock.Anything, mock.MatchedBy(func(s common.Shipment) bool {
+		return s.Address != nil && s.Address.City == "Hangzhou"
+	})).Return("SF-123", nil).Times(2)
+
+	newAddr := common.Address{Country: "CN", Province: "Zhejiang", City: "Hangzhou", Detail: "文一西路 1 号"}
+
+	// 待支付阶段：修改地址 + 删除一行
+	env.RegisterDelayedCallback(func() {
+		env.UpdateWorkflow("change_shipping_address", "addr-1", &testsuite.TestUpdateCallback{
+			OnReject: func(err error) { assert.Fail(t, "地址修改不应被拒绝", err) },
+			OnComplete: func(res interface{}, err error) {
+				assert.NoError(t, err)
+			},
+		}, newAddr)
+
+		env.UpdateWorkflow("remove_line", "remove-1", &testsuite.TestUpdateCallback{
+			OnReject: func(err error) { assert.Fail(t, "删除商品行不应被拒绝", err) },
+			OnComplete: func(res interface{}, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"iPhone15"}, res)
+			},
+		}, "AirPods")
+	}, time.Second*1)
+
+	env.RegisterDelayedCallback(func() {
+		// 最后一个商品不能删除
+		env.UpdateWorkflow("remove_line", "remove-2", &testsuite.TestUpdateCallback{
+			OnAccept: func() { assert.Fail(t, "不应允许删除最后一个商品") },
+			OnReject: func(err error) { assert.Contains(t, err.Error(), "最后一个商品") },
+		}, "iPhone15")
+	}, time.Second*2)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("SIGNAL_PAYMENT_PAID", "PAID_TEST")
+	}, time.Second*3)
+
+	order := common.Order{OrderID: "UPDATE_ORDER", Amount: 100, Items: []string{"iPhone15", "AirPods"},
+		ShippingAddress: &common.Address{Country: "CN", City: "Shanghai", Detail: "旧地址"}}
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, order)
+
+	assert.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+
+	var result common.OrderStatus
+	env.GetWorkflowResult(&result)
+	assert.Equal(t, "COMPLETED", result.Status)
+	env.AssertExpectations(t)
+}
+
+func TestOrderFulfillmentWorkflow_UpdateRejectedAfterShipping(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	mockFlashSale(env)
+	invActs := &InventoryActivities{}
+
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskApprove)
+	// 子流程发货耗时 1 小时，期间尝试修改地址
+	env.OnWorkflow(ShippingChildWorkflow, mock.Anything, mock.Anything).After(time.Hour).Return("SF-123", nil).Times(2)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("SIGNAL_PAYMENT_PAID", "PAID_TEST")
+	}, time.Second*1)
+
+	rejected := false
+	env.RegisterDelayedCallback(func() {
+		env.UpdateWorkflow("change_shipping_address", "addr-late", &testsuite.TestUpdateCallback{
+			OnAccept: func() { assert.Fail(t, "发货后不应允许修改地址") },
+			OnReject: func(err error) {
+				rejected = true
+				assert.Contains(t, err.Error(), "已开始发货")
+			},
+		}, common.Address{Country: "CN", City: "Hangzhou", Detail: "文一西路 1 号"})
+	}, time.Minute*10)
+
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, common.Order{OrderID: "SHIPPED_ORDER", Amount: 100, Items: []string{"iPhone15"}})
+
+	assert.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+	assert.True(t, rejected)
+	env.AssertExpectations(t)
+}
+
+func TestOrderFulfillmentWorkflow_PayUpdate(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	mockFlashSale(env)
+	invActs := &InventoryActivities{}
+
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskReview)
+	env.OnWorkflow(ShippingChildWorkflow, mock.Anything, mock.Anything).Return("SF-123", nil).Times(2)
+
+	// 审核中还不能支付
+	env.RegisterDelayedCallback(func() {
+		env.UpdateWorkflow("pay_order", "pay-early", &testsuite.TestUpdateCallback{
+			OnAccept: func() { assert.Fail(t, "审核中不应允许支付") },
+			OnReject: func(err error) { assert.Contains(t, err.Error(), "不在待支付状态") },
+		}, "PAY-1")
+		env.SignalWorkflow("SIGNAL_ADMIN_ACTION", "APPROVE")
+	}, time.Second)
+
+	paid := false
+	env.RegisterDelayedCallback(func() {
+		env.UpdateWorkflow("pay_order", "pay-1", &testsuite.TestUpdateCallback{
+			OnReject:   func(err error) { assert.Fail(t, "待支付时应允许支付", err) },
+			OnComplete: func(_ interface{}, err error) { paid = err == nil },
+		}, "PAY-1")
+	}, time.Second*2)
+
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, common.Order{OrderID: "PAY_UPDATE_ORDER", Amount: 100, Items: []string{"iPhone15"}})
+
+	assert.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+	assert.True(t, paid)
+	var result common.OrderStatus
+	require.NoError(t, env.GetWorkflowResult(&result))
+	assert.Equal(t, "COMPLETED", result.Status)
+	env.AssertExpectations(t)
+}
+
+func TestOrderFulfillmentWorkflow_CancelUpdate(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	invActs := &InventoryActivities{}
+
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(invActs.ReleaseInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	flashActs := &FlashSaleActivities{}
+	env.OnActivity(flashActs.ReleaseReservation, mock.Anything, "CANCEL_ORDER", "iPhone15").Return(nil).Once()
+	mockRisk(env, common.RiskApprove)
+
+	env.RegisterDelayedCallback(func() {
+		env.UpdateWorkflow("cancel_order", "cancel-1", &testsuite.TestUpdateCallback{
+			OnReject:   func(err error) { assert.Fail(t, "待支付时应允许取消", err) },
+			OnComplete: func(_ interface{}, err error) { assert.NoError(t, err) },
+		}, "不想要了")
+		// 已取消后不能再支付
+		env.UpdateWorkflow("pay_order", "pay-after-cancel", &testsuite.TestUpdateCallback{
+			OnAccept: func() { assert.Fail(t, "取消后不应允许支付") },
+			OnReject: func(err error) { assert.Error(t, err) },
+		}, "PAY-1")
+	}, time.Second)
+
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, common.Order{OrderID: "CANCEL_ORDER", Amount: 100, Items: []string{"iPhone15"}})
+
+	assert.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+	var result common.OrderStatus
+	require.NoError(t, env.GetWorkflowResult(&result))
+	assert.Equal(t, "CANCELLED", result.Status)
+	assert.Equal(t, "不想要了", result.Message)
+	env.AssertExpectations(t)
+}
+
+func TestPaymentUpdate_LostRace(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+
+	// 支付回调与 cancel_order 在同一批事件中就绪，selector 采用了支付回调：取消留在 payments 中没有生效
+	raceWorkflow := func(ctx workflow.Context) error {
+		progress := &orderProgress{Reserved: true, AwaitingPayment: true}
+		payments := workflow.NewBufferedChannel(ctx, 1)
+		if err := registerUpdateHandlers(ctx, &common.Order{}, progress, workflow.ActivityOptions{}, payments); err != nil {
+			return err
+		}
+		if err := workflow.Await(ctx, func() bool { return progress.PaymentDecided }); err != nil {
+			return err
+		}
+		progress.PaymentResolved, progress.Paid = true, true
+		return workflow.Await(ctx, func() bool { return workflow.AllHandlersFinished(ctx) })
+	}
+	env.RegisterWorkflowWithOptions(raceWorkflow, workflow.RegisterOptions{Name: "PaymentRaceWorkflow"})
+
+	var cancelErr error
+	env.RegisterDelayedCallback(func() {
+		env.UpdateWorkflow("cancel_order", "cancel-1", &testsuite.TestUpdateCallback{
+			OnReject:   func(err error) { assert.Fail(t, "待支付时应允许取消", err) },
+			OnComplete: func(_ interface{}, err error) { cancelErr = err },
+		}, "不想要了")
+	}, time.Second)
+
+	env.ExecuteWorkflow("PaymentRaceWorkflow")
+
+	require.NoError(t, env.GetWorkflowError())
+	require.Error(t, cancelErr)
+	assert.Contains(t, cancelErr.Error(), "订单已支付")
+}
+
+func TestOrderFulfillmentWorkflow_SearchAttributes(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	mockProjection(env)
+	mockFlashSale(env)
+	invActs := &InventoryActivities{}
+
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskApprove)
+	env.OnWorkflow(ShippingChildWorkflow, mock.Anything, mock.Anything).Return("SF-123", nil).Times(2)
+
+	// 记录每次流转写入的状态
+	var statuses []string
+	var customer string
+	riskAttrs := map[string]interface{}{}
+	env.OnUpsertTypedSearchAttributes(mock.Anything).Run(func(args mock.Arguments) {
+		attrs := args.Get(0).(temporal.SearchAttributes)
+		status, _ := attrs.GetKeyword(SearchAttrOrderStatus)
+		statuses = append(statuses, status)
+		_, hasTime := attrs.GetTime(SearchAttrStatusChangedAt)
+		assert.True(t, hasTime)
+		if c, ok := attrs.GetKeyword(SearchAttrCustomerID); ok {
+			customer = c
+		}
+		// 风控结论在评估后的第一次流转中写入一次
+		if v, ok := attrs.GetKeyword(SearchAttrRiskVerdict); ok {
+			assert.NotContains(t, riskAttrs, status)
+			rules, _ := attrs.GetKeywordList(SearchAttrRiskRules)
+			riskAttrs[status] = []string{v, strings.Join(rules, ",")}
+		}
+	}).Return(nil)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("SIGNAL_PAYMENT_PAID", "PAID_TEST")
+	}, time.Second*1)
+
+	order := common.Order{OrderID: "SA_ORDER", Amount: 100, Items: []string{"iPhone15"}, CustomerID: "CUST_1"}
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, order)
+
+	assert.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+	assert.Equal(t, []string{
+		string(common.StateReserving), string(common.StateRiskCheck), string(common.StatePendingPayment),
+		string(common.StateShipping), string(common.StateCompleted),
+	}, statuses)
+	assert.Equal(t, "CUST_1", customer)
+	assert.Equal(t, map[string]interface{}{string(common.StatePendingPayment): []string{common.RiskApprove, "test"}}, riskAttrs)
+}
+
+func TestOrderFulfillmentWorkflow_Webhooks(t *testing.T) {
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	webhookActs := &WebhookActivities{}
+
+	// 支付超时取消：order.cancelled 有一个订阅，投递在独立子流程中进行；前两次失败，按重试策略第三次送达
+	cancelled := mock.MatchedBy(func(e common.OrderEvent) bool { return e.Status == string(common.StateCancelled) })
+	env.OnActivity(webhookActs.EnqueueWebhooks, mock.Anything, cancelled).Return([]uint{7}, nil).Once()
+	// 测试环境会等被放弃 (ABANDON) 的子流程跑完：最终送达时订单应该早已结束
+	var childID string
+	var orderDoneFirst bool
+	env.RegisterWorkflow(WebhookDeliveryWorkflow)
+	env.SetOnChildWorkflowStartedListener(func(info *workflow.Info, _ workflow.Context, _ converter.EncodedValues) {
+		childID = info.WorkflowExecution.ID
+	})
+	env.OnActivity(webhookActs.DeliverWebhook, mock.Anything, uint(7)).Return(errors.New("HTTP 503")).Twice()
+	env.OnActivity(webhookActs.DeliverWebhook, mock.Anything, uint(7)).Return(nil).Once().
+		Run(func(mock.Arguments) { orderDoneFirst = env.IsWorkflowCompleted() })
+	mockProjection(env)
+	mockFlashSale(env)
+	invActs := &InventoryActivities{}
+	env.OnActivity(invActs.ReserveInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	env.OnActivity(invActs.ReleaseInventory, mock.Anything, mock.Anything).Return(nil).Once()
+	mockRisk(env, common.RiskApprove)
+
+	env.ExecuteWorkflow(OrderFulfillmentWorkflow, common.Order{OrderID: "WEBHOOK_ORDER", Amount: 100, Items: []string{"iPhone15"}})
+
+	// 订单不等待投递：支付超时后即结束，投递子流程在订单结束后继续重试
+	assert.True(t, env.IsWorkflowCompleted())
+	assert.NoError(t, env.GetWorkflowError())
+	var result common.OrderStatus
+	require.NoError(t, env.GetWorkflowResult(&result))
+	assert.Equal(t, string(common.StateCancelled), result.Status)
+	assert.Equal(t, webhookWorkflowID(7), childID)
+	assert.True(t, orderDoneFirst)
+	env.AssertExpectations(t)
+}
+
+func TestOrderListFilter_ListQuery(t *testing.T) {
+	now := time.Date(2025, 11, 11, 12, 0, 0, 0, time.UTC)
+
+	q, err := OrderListFilter{}.ListQuery()
+	assert.NoError(t, err)
+	assert.Equal(t, "WorkflowType = 'OrderFulfillmentWorkflow'", q)
+
+	// 卡在风控审核超过 1 小时的订单
+	q, err = OrderListFilter{Status: string(common.StateRiskReview), StaleFor: time.Hour, Now: now}.ListQuery()
+	assert.NoError(t, err)
+	assert.Equal(t, "WorkflowType = 'OrderFulfillmentWorkflow' AND OrderStatus = 'RISK_REVIEW' AND StatusChangedAt <= '2025-11-11T11:00:00Z'", q)
+
+	q, err = OrderListFilter{CustomerID: "C1", From: now.Add(-24 * time.Hour), To: now}.ListQuery()
+	assert.NoError(t, err)
+	assert.Contains(t, q, "CustomerID = 'C1'")
+	assert.Contains(t, q, "StartTime >= '2025-11-10T12:00:00Z' AND StartTime <= '2025-11-11T12:00:00Z'")
+
+	// 防注入
+	// 按风控结论与命中规则筛选 (RiskRules 为 KeywordList，包含即匹配)
+	q, err = OrderListFilter{RiskVerdict: common.RiskReview, RiskRule: "order_velocity"}.ListQuery()
+	assert.NoError(t, err)
+	assert.Equal(t, "WorkflowType = 'OrderFulfillmentWorkflow' AND RiskVerdict = 'REVIEW' AND RiskRules = 'order_velocity'", q)
+
+	_, err = OrderListFilter{CustomerID: "x' OR 1=1 --"}.ListQuery()
+	assert.Error(t, err)
+}
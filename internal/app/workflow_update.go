@@ -0,0 +1,191 @@
+package app
+
+import (
+	"fmt"
+	"omniflow/internal/common"
+	"slices"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// orderProgress 订单推进到了哪一步，供 Update 校验器判断是否还允许修改
+type orderProgress struct {
+	Reserved        bool // 库存已预占
+	AwaitingPayment bool // 等待支付 (可以支付或取消)
+	PaymentDecided  bool // 已收到支付或取消，不再接受第二个结果
+	ShippingStarted bool // 已进入拆单发货
+	Finished        bool // 已结束 (完成/取消/拒绝)
+
+	// 支付 selector 实际采用的结果：支付信号、Update 与超时可能在同一批事件中同时就绪，只有一个生效
+	PaymentResolved  bool
+	Paid             bool
+	PaymentAppliedBy string // 被采用的 Update ID (支付信号或超时为空)
+}
+
+// paymentDecision 待支付阶段收到的结果 (pay_order / cancel_order Update)
+type paymentDecision struct {
+	Paid     bool
+	Reason   string // 取消原因
+	UpdateID string
+}
+
+func (p *orderProgress) checkPayable() error {
+	switch {
+	case p.Finished:
+		return fmt.Errorf("订单已结束")
+	case !p.AwaitingPayment || p.PaymentDecided:
+		return fmt.Errorf("订单当前不在待支付状态")
+	}
+	return nil
+}
+
+// awaitPayment 等支付 selector 落定，结果没有被采用时返回实际结果
+func (p *orderProgress) awaitPayment(ctx workflow.Context, updateID string) error {
+	if err := workflow.Await(ctx, func() bool { return p.PaymentResolved }); err != nil {
+		return err
+	}
+	switch {
+	case p.PaymentAppliedBy == updateID:
+		return nil
+	case p.Paid:
+		return fmt.Errorf("订单已支付")
+	default:
+		return fmt.Errorf("订单已取消")
+	}
+}
+
+func (p *orderProgress) checkModifiable() error {
+	switch {
+	case p.Finished:
+		return fmt.Errorf("订单已结束，不能修改")
+	case p.ShippingStarted:
+		return fmt.Errorf("订单已开始发货，不能修改")
+	}
+	return nil
+}
+
+// registerUpdateHandlers 注册同步修改订单的 Update
+// 校验器只读不写；校验通过后 handler 直接修改 order，后续步骤 (包括补偿) 都使用修改后的订单
+// 支付/取消只在待支付阶段接受，结果写入 payments，由主流程的支付 selector 处理；
+// 同时就绪的支付信号或超时可能抢先生效，handler 等 selector 落定后才返回，没被采用时返回错误
+// Update handler 的 ctx 不继承主流程的 ActivityOptions，需要单独传入
+func registerUpdateHandlers(ctx workflow.Context, order *common.Order, progress *orderProgress, ao workflow.ActivityOptions, payments workflow.Channel) error {
+	invActs := &InventoryActivities{}
+
+	// 支付：与 SIGNAL_PAYMENT_PAID 等价，但调用方能同步得知是否被接受
+	err := workflow.SetUpdateHandlerWithOptions(ctx, "pay_order",
+		func(ctx workflow.Context, paymentID string) error {
+			progress.PaymentDecided = true
+			updateID := workflow.GetCurrentUpdateInfo(ctx).ID
+			payments.Send(ctx, paymentDecision{Paid: true, UpdateID: updateID})
+			return progress.awaitPayment(ctx, updateID)
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context, paymentID string) error {
+				if paymentID == "" {
+					return fmt.Errorf("缺少支付流水号")
+				}
+				return progress.checkPayable()
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// 取消：待支付阶段由客户主动取消，补偿与支付超时相同
+	err = workflow.SetUpdateHandlerWithOptions(ctx, "cancel_order",
+		func(ctx workflow.Context, reason string) error {
+			progress.PaymentDecided = true
+			if reason == "" {
+				reason = "客户取消"
+			}
+			updateID := workflow.GetCurrentUpdateInfo(ctx).ID
+			payments.Send(ctx, paymentDecision{Reason: reason, UpdateID: updateID})
+			return progress.awaitPayment(ctx, updateID)
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context, reason string) error {
+				if err := progress.checkPayable(); err != nil {
+					return fmt.Errorf("只有待支付的订单可以取消: %w", err)
+				}
+				return nil
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// 修改收货地址：发货前均可修改
+	err = workflow.SetUpdateHandlerWithOptions(ctx, "change_shipping_address",
+		func(ctx workflow.Context, addr common.Address) (common.Address, error) {
+			order.ShippingAddress = &addr
+			return addr, nil
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context, addr common.Address) error {
+				if err := progress.checkModifiable(); err != nil {
+					return err
+				}
+				if addr.Country == "" || addr.City == "" || addr.Detail == "" {
+					return fmt.Errorf("收货地址不完整")
+				}
+				return nil
+			},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	// 删除商品行：已预占的库存同步释放，返回剩余商品
+	// 多个删除请求串行执行，避免同一行被重复释放
+	lineMu := workflow.NewMutex(ctx)
+	return workflow.SetUpdateHandlerWithOptions(ctx, "remove_line",
+		func(ctx workflow.Context, sku string) ([]string, error) {
+			ctx = workflow.WithActivityOptions(ctx, ao)
+			if err := lineMu.Lock(ctx); err != nil {
+				return nil, err
+			}
+			defer lineMu.Unlock()
+			if !slices.Contains(order.Items, sku) || len(order.Items) == 1 {
+				return nil, fmt.Errorf("商品 %s 已被删除或是最后一个商品", sku)
+			}
+
+			release := common.LineRelease{
+				OrderID:   order.OrderID,
+				SKU:       sku,
+				RequestID: workflow.GetCurrentUpdateInfo(ctx).ID,
+			}
+			if err := workflow.ExecuteActivity(ctx, invActs.ReleaseLine, release).Get(ctx, nil); err != nil {
+				return nil, err
+			}
+			idx := slices.Index(order.Items, sku)
+			order.Items = slices.Delete(order.Items, idx, idx+1)
+			return order.Items, nil
+		},
+		workflow.UpdateHandlerOptions{
+			Validator: func(ctx workflow.Context, sku string) error {
+				if err := progress.checkModifiable(); err != nil {
+					return err
+				}
+				if !progress.Reserved {
+					return fmt.Errorf("库存预占中，请稍后重试")
+				}
+				if !slices.Contains(order.Items, sku) {
+					return fmt.Errorf("订单中没有商品 %s", sku)
+				}
+				if len(order.Items) == 1 {
+					return fmt.Errorf("不能删除最后一个商品，请直接取消订单")
+				}
+				return nil
+			},
+		},
+	)
+}
+
+// waitForUpdates 等待进行中的 Update 执行完毕，避免补偿或结束时和行删除并发释放库存
+func waitForUpdates(ctx workflow.Context) {
+	_ = workflow.Await(ctx, func() bool { return workflow.AllHandlersFinished(ctx) })
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+
+	"omniflow/internal/common"
+)
+
+// webhookDeliveryOptions 投递的指数退避：5s、10s、20s … 最长 5 分钟一次，共 WebhookMaxAttempts 次 (约 10 分钟)
+var webhookDeliveryOptions = workflow.ActivityOptions{
+	StartToCloseTimeout: 30 * time.Second,
+	RetryPolicy: &temporal.RetryPolicy{
+		InitialInterval:    5 * time.Second,
+		BackoffCoefficient: 2,
+		MaximumInterval:    5 * time.Minute,
+		MaximumAttempts:    WebhookMaxAttempts,
+	},
+}
+
+// webhookDispatcher 订单 Workflow 内的 Webhook 投递：每次流转生成投递记录，每条投递启动一个独立的
+// WebhookDeliveryWorkflow 子流程 (ParentClosePolicy=ABANDON)，订单结束不等待投递，接收方宕机时重试在子流程中继续
+type webhookDispatcher struct {
+	enqueueCtx workflow.Context
+}
+
+func newWebhookDispatcher(ctx workflow.Context, enqueueOptions workflow.ActivityOptions) *webhookDispatcher {
+	return &webhookDispatcher{enqueueCtx: workflow.WithActivityOptions(ctx, enqueueOptions)}
+}
+
+// dispatch 推送一次状态流转 (内部状态没有对应的事件，直接跳过)；失败只记日志，不影响订单本身
+func (d *webhookDispatcher) dispatch(ctx workflow.Context, event common.OrderEvent) {
+	if _, ok := WebhookEventType(common.OrderState(event.Status)); !ok {
+		return
+	}
+	logger := workflow.GetLogger(ctx)
+	var acts *WebhookActivities
+	var ids []uint
+	if err := workflow.ExecuteActivity(d.enqueueCtx, acts.EnqueueWebhooks, event).Get(ctx, &ids); err != nil {
+		logger.Warn("Webhook 投递记录生成失败", "status", event.Status, "error", err)
+		return
+	}
+	for _, id := range ids {
+		childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+			WorkflowID:        webhookWorkflowID(id),
+			ParentClosePolicy: enumspb.PARENT_CLOSE_POLICY_ABANDON,
+		})
+		// 只等子流程启动 (订单结束时未启动的子流程会丢失)，不等投递结果
+		child := workflow.ExecuteChildWorkflow(childCtx, WebhookDeliveryWorkflow, id)
+		if err := child.GetChildWorkflowExecution().Get(ctx, nil); err != nil {
+			logger.Warn("Webhook 投递子流程启动失败", "delivery", id, "error", err)
+		}
+	}
+}
+
+// WebhookDeliveryWorkflow 单条投递 (订单流转时作为子流程启动，后台重放死信时直接启动)
+func WebhookDeliveryWorkflow(ctx workflow.Context, deliveryID uint) error {
+	ctx = workflow.WithActivityOptions(ctx, webhookDeliveryOptions)
+	var a *WebhookActivities
+	return workflow.ExecuteActivity(ctx, a.DeliverWebhook, deliveryID).Get(ctx, nil)
+}
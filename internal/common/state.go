@@ -0,0 +1,127 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// OrderState 订单状态 (稳定的机器可读编码，UI 根据它渲染进度)
+type OrderState string
+
+const (
+	StateCreated        OrderState = "CREATED"
+	StateReserving      OrderState = "RESERVING"
+	StateRiskCheck      OrderState = "RISK_CHECK"
+	StateRiskReview     OrderState = "RISK_REVIEW"
+	StatePendingPayment OrderState = "PENDING_PAYMENT"
+	StateShipping       OrderState = "SHIPPING"
+	StateCompleted      OrderState = "COMPLETED"
+	StateCancelled      OrderState = "CANCELLED"
+	StateRejected       OrderState = "REJECTED"
+	StateFailed         OrderState = "FAILED"
+)
+
+// 允许的状态流转；RISK_REVIEW 允许自流转，用于记录催办/升级
+var stateTransitions = map[OrderState][]OrderState{
+	StateCreated:        {StateReserving},
+	StateReserving:      {StateRiskCheck, StateFailed},
+	StateRiskCheck:      {StateRiskReview, StatePendingPayment, StateRejected},
+	StateRiskReview:     {StateRiskReview, StatePendingPayment, StateRejected},
+	StatePendingPayment: {StateShipping, StateCancelled},
+	StateShipping:       {StateCompleted},
+}
+
+var stateLabels = map[OrderState]string{
+	StateCreated:        "初始化",
+	StateReserving:      "正在预占库存",
+	StateRiskCheck:      "风控评估中",
+	StateRiskReview:     "待风控审核",
+	StatePendingPayment: "待支付",
+	StateShipping:       "拆单发货中",
+	StateCompleted:      "已完成",
+	StateCancelled:      "已取消",
+	StateRejected:       "已拒绝",
+	StateFailed:         "库存失败",
+}
+
+// Label 中文展示文案
+func (s OrderState) Label() string {
+	if l, ok := stateLabels[s]; ok {
+		return l
+	}
+	return string(s)
+}
+
+// IsFinal 是否为终态
+func (s OrderState) IsFinal() bool {
+	return len(stateTransitions[s]) == 0
+}
+
+// CanTransitionTo 是否允许流转到 next
+func (s OrderState) CanTransitionTo(next OrderState) bool {
+	for _, allowed := range stateTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// StateTransition 时间线上的一次流转
+type StateTransition struct {
+	State     OrderState `json:"state"`
+	EnteredAt time.Time  `json:"entered_at"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// OrderTimeline get_order_timeline 查询的返回值
+type OrderTimeline struct {
+	State       OrderState        `json:"state"`
+	Label       string            `json:"label"`
+	Transitions []StateTransition `json:"transitions"`
+}
+
+// StateMachine 订单状态机，记录完整时间线
+// 只在 Workflow 内使用，时间由调用方传入 (workflow.Now) 以保证确定性
+type StateMachine struct {
+	timeline []StateTransition
+}
+
+// NewStateMachine 从 CREATED 开始
+func NewStateMachine(createdAt time.Time) *StateMachine {
+	return &StateMachine{timeline: []StateTransition{{State: StateCreated, EnteredAt: createdAt}}}
+}
+
+// Current 当前状态
+func (m *StateMachine) Current() StateTransition {
+	return m.timeline[len(m.timeline)-1]
+}
+
+// Transition 流转到 next，不允许的流转返回错误且状态不变
+func (m *StateMachine) Transition(next OrderState, at time.Time, reason string) error {
+	cur := m.Current().State
+	if !cur.CanTransitionTo(next) {
+		return fmt.Errorf("非法的状态流转: %s -> %s", cur, next)
+	}
+	m.timeline = append(m.timeline, StateTransition{State: next, EnteredAt: at, Reason: reason})
+	return nil
+}
+
+// Label 当前状态的展示文案，带上流转原因
+func (m *StateMachine) Label() string {
+	cur := m.Current()
+	if cur.Reason == "" {
+		return cur.State.Label()
+	}
+	return fmt.Sprintf("%s (%s)", cur.State.Label(), cur.Reason)
+}
+
+// Timeline 完整时间线快照
+func (m *StateMachine) Timeline() OrderTimeline {
+	cur := m.Current()
+	return OrderTimeline{
+		State:       cur.State,
+		Label:       m.Label(),
+		Transitions: append([]StateTransition(nil), m.timeline...),
+	}
+}
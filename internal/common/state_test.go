@@ -0,0 +1,35 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateMachine_Transitions(t *testing.T) {
+	start := time.Date(2025, 11, 11, 0, 0, 0, 0, time.UTC)
+	sm := NewStateMachine(start)
+	assert.Equal(t, StateCreated, sm.Current().State)
+
+	require.NoError(t, sm.Transition(StateReserving, start.Add(time.Second), ""))
+	require.NoError(t, sm.Transition(StateRiskCheck, start.Add(2*time.Second), ""))
+
+	// 非法流转被拒绝，状态不变
+	assert.Error(t, sm.Transition(StateCompleted, start.Add(3*time.Second), ""))
+	assert.Equal(t, StateRiskCheck, sm.Current().State)
+
+	require.NoError(t, sm.Transition(StateRejected, start.Add(4*time.Second), "命中黑名单"))
+	assert.True(t, sm.Current().State.IsFinal())
+	assert.Equal(t, "已拒绝 (命中黑名单)", sm.Label())
+
+	// 终态之后不允许再流转
+	assert.Error(t, sm.Transition(StatePendingPayment, start.Add(5*time.Second), ""))
+
+	timeline := sm.Timeline()
+	assert.Equal(t, StateRejected, timeline.State)
+	require.Len(t, timeline.Transitions, 4)
+	assert.Equal(t, start.Add(4*time.Second), timeline.Transitions[3].EnteredAt)
+	assert.Equal(t, "命中黑名单", timeline.Transitions[3].Reason)
+}
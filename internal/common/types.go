@@ -1,5 +1,11 @@
 package common
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 const TaskQueue = "OMNIFLOW_TASK_QUEUE"
 
 type Order struct {
@@ -7,6 +13,28 @@ type Order struct {
 	Amount     int
 	Items      []string
 	CustomerID string
+	Campaign   string // 所属秒杀活动 (可为空)
+
+	ShippingAddress *Address
+	BillingAddress  *Address
+
+	// ReviewPolicy 人工审核 SLA，为空时使用 DefaultReviewPolicy
+	ReviewPolicy *ReviewPolicy
+}
+
+// FlashSKU 秒杀漏斗扣减的 SKU (下单时的第一个商品)，Outbox 与预占记录按它存放
+func (o Order) FlashSKU() string {
+	if len(o.Items) == 0 {
+		return ""
+	}
+	return o.Items[0]
+}
+
+type Address struct {
+	Country  string `json:"country"`
+	Province string `json:"province"`
+	City     string `json:"city"`
+	Detail   string `json:"detail"`
 }
 
 type Shipment struct {
@@ -14,10 +42,141 @@ type Shipment struct {
 	OrderID    string
 	Warehouse  string
 	Items      []string
+	Address    *Address
+}
+
+// LineRelease 删除订单中的一个商品行时释放其库存
+type LineRelease struct {
+	OrderID   string
+	SKU       string
+	RequestID string // 去重用 (Update ID)
+}
+
+// StockAdjustment 后台调整 MySQL 库存 (补货/盘点/报损)，Delta 为正表示增加
+type StockAdjustment struct {
+	RequestID string // 去重用 (Idempotency-Key)
+	SKU       string
+	Delta     int
+	Reason    string
+	Operator  string // 操作人 (Token 中的 sub)
 }
 
 type OrderStatus struct {
 	OrderID string
-	Status  string
+	Status  string // OrderState 编码
 	Message string
 }
+
+// 风控结论
+const (
+	RiskApprove = "APPROVE"
+	RiskReview  = "REVIEW"
+	RiskReject  = "REJECT"
+)
+
+// RiskAssessment 风控评估结果，随订单保存在 Workflow 中供审核人查看
+type RiskAssessment struct {
+	Verdict string
+	Reasons []string
+}
+
+// Rules 命中的规则名 (原因格式为 "[规则名] 说明")，去重后按出现顺序返回
+// 旧版本金额判断与风控引擎不可用时的原因没有规则名，不计入
+func (r RiskAssessment) Rules() []string {
+	var rules []string
+	seen := map[string]bool{}
+	for _, reason := range r.Reasons {
+		if !strings.HasPrefix(reason, "[") {
+			continue
+		}
+		end := strings.Index(reason, "]")
+		if end <= 1 {
+			continue
+		}
+		if rule := reason[1:end]; !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// OrderEvent 订单状态流转事件，投影到 MySQL 读模型
+type OrderEvent struct {
+	OrderID    string
+	Seq        int    // 从 1 开始递增
+	Status     string // OrderState 编码
+	Label      string
+	Reason     string
+	OccurredAt time.Time
+	Order      Order           // 流转时的订单快照
+	Risk       *RiskAssessment // 风控结论 (风控评估之后的流转才有)
+}
+
+// ReviewPolicy 风控人工审核的 SLA 配置
+// 任一时长 <= 0 表示关闭该阶段
+type ReviewPolicy struct {
+	RemindAfter     time.Duration // 超时未审 -> 催办当前审核组
+	EscalateAfter   time.Duration // 超时未审 -> 升级到二线审核组
+	RejectAfter     time.Duration // 超时未审 -> 自动拒绝并触发补偿
+	PrimaryGroup    string
+	EscalationGroup string
+}
+
+// Validate 校验 SLA：时长不能为负，开启的阶段必须依次递增 (催办 < 升级 < 自动拒绝)，
+// 开启催办/升级时必须配置对应的审核组
+func (p ReviewPolicy) Validate() error {
+	stages := []struct {
+		name  string
+		after time.Duration
+	}{
+		{"催办", p.RemindAfter},
+		{"升级", p.EscalateAfter},
+		{"自动拒绝", p.RejectAfter},
+	}
+	var prev string
+	var prevAfter time.Duration
+	for _, stage := range stages {
+		if stage.after < 0 {
+			return fmt.Errorf("%s时长不能为负: %s", stage.name, stage.after)
+		}
+		if stage.after == 0 {
+			continue
+		}
+		if prevAfter > 0 && stage.after <= prevAfter {
+			return fmt.Errorf("%s时长 (%s) 必须晚于%s时长 (%s)", stage.name, stage.after, prev, prevAfter)
+		}
+		prev, prevAfter = stage.name, stage.after
+	}
+	if p.RemindAfter > 0 && p.PrimaryGroup == "" {
+		return fmt.Errorf("开启催办时必须配置一线审核组")
+	}
+	if p.EscalateAfter > 0 && p.EscalationGroup == "" {
+		return fmt.Errorf("开启升级时必须配置二线审核组")
+	}
+	return nil
+}
+
+func DefaultReviewPolicy() ReviewPolicy {
+	return ReviewPolicy{
+		RemindAfter:     30 * time.Minute,
+		EscalateAfter:   2 * time.Hour,
+		RejectAfter:     24 * time.Hour,
+		PrimaryGroup:    "risk-l1",
+		EscalationGroup: "risk-l2",
+	}
+}
+
+// 审核通知类型
+const (
+	ReviewNoticeRemind   = "REMIND"
+	ReviewNoticeEscalate = "ESCALATE"
+)
+
+// ReviewNotice 发给审核组的通知
+type ReviewNotice struct {
+	OrderID string
+	Group   string
+	Kind    string
+	Waited  time.Duration
+}
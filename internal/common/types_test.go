@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRiskAssessment_Rules(t *testing.T) {
+	r := RiskAssessment{Verdict: RiskReview, Reasons: []string{
+		"[large_amount] 订单金额超过 10000",
+		"[order_velocity] 1 小时内下单 6 次",
+		"[large_amount] 重复命中",
+		"风控引擎不可用: timeout",
+		"[] 空规则名",
+	}}
+	assert.Equal(t, []string{"large_amount", "order_velocity"}, r.Rules())
+	assert.Empty(t, RiskAssessment{Verdict: RiskApprove}.Rules())
+}
+
+func TestReviewPolicy_Validate(t *testing.T) {
+	assert.NoError(t, DefaultReviewPolicy().Validate())
+
+	// 0 表示关闭该阶段，其余阶段仍需递增
+	assert.NoError(t, ReviewPolicy{RejectAfter: time.Hour}.Validate())
+	assert.NoError(t, ReviewPolicy{RemindAfter: time.Minute, RejectAfter: time.Hour, PrimaryGroup: "risk-l1"}.Validate())
+
+	invalid := map[string]ReviewPolicy{
+		"负数":      {RemindAfter: -time.Minute, PrimaryGroup: "risk-l1"},
+		"升级早于催办":  {RemindAfter: time.Hour, EscalateAfter: time.Minute, PrimaryGroup: "risk-l1", EscalationGroup: "risk-l2"},
+		"拒绝等于升级":  {EscalateAfter: time.Hour, RejectAfter: time.Hour, EscalationGroup: "risk-l2"},
+		"缺少一线审核组": {RemindAfter: time.Minute},
+		"缺少二线审核组": {EscalateAfter: time.Minute},
+	}
+	for name, policy := range invalid {
+		assert.Error(t, policy.Validate(), name)
+	}
+}
@@ -0,0 +1,221 @@
+package apierr
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Code 机器可读的错误码，客户端应根据它判断错误类型，不要匹配文案
+type Code string
+
+const (
+	OutOfStock         Code = "OUT_OF_STOCK"           // 秒杀库存不足
+	NotInFlashSale     Code = "NOT_IN_FLASH_SALE"      // 商品未开放秒杀 (未预热)
+	LimitReached       Code = "LIMIT_REACHED"          // 超过活动限购数量
+	RateLimited        Code = "RATE_LIMITED"           // 请求过于频繁 (限流)，响应头 Retry-After 为建议的重试秒数
+	InvalidRequest     Code = "INVALID_REQUEST"        // 参数错误
+	NotFound           Code = "NOT_FOUND"              // 订单不存在或已结束
+	OrderNotModifiable Code = "ORDER_NOT_MODIFIABLE"   // Workflow 校验器拒绝修改
+	IdempotencyReused  Code = "IDEMPOTENCY_KEY_REUSED" // 同一个 Idempotency-Key 用于不同的请求体
+	RequestInProgress  Code = "REQUEST_IN_PROGRESS"    // 同一个 Idempotency-Key 的首个请求仍在处理
+	CampaignNotLive    Code = "CAMPAIGN_NOT_LIVE"      // 秒杀活动未开始、已暂停或已结束
+	CampaignNotFound   Code = "CAMPAIGN_NOT_FOUND"     // 秒杀活动不存在
+	CampaignConflict   Code = "CAMPAIGN_CONFLICT"      // 活动时间与其他活动重叠，或当前状态不允许该操作
+	ServiceDegraded    Code = "SERVICE_DEGRADED"       // Redis 熔断，按降级策略拒绝或排队超时
+	QueueFull          Code = "ORDER_QUEUE_FULL"       // 下单准入队列已满
+	Unauthorized       Code = "UNAUTHORIZED"           // 缺少 Token 或 Token 无效
+	Forbidden          Code = "FORBIDDEN"              // 角色无权访问
+	ProductNotFound    Code = "PRODUCT_NOT_FOUND"      // 商品不存在
+	ProductExists      Code = "PRODUCT_EXISTS"         // 商品 ID 已存在
+	StockConflict      Code = "STOCK_CONFLICT"         // 库存调整后会小于 0
+	WebhookNotFound    Code = "WEBHOOK_NOT_FOUND"      // Webhook 订阅或投递记录不存在 (订阅已停用)
+	DeliveryInProgress Code = "DELIVERY_IN_PROGRESS"   // Webhook 投递仍在重试中，不能重放
+	Internal           Code = "INTERNAL"               // 系统内部错误
+)
+
+// 错误码 -> HTTP 状态码 (OUT_OF_STOCK 沿用 429，压测脚本依赖它统计拦截数)
+var httpStatus = map[Code]int{
+	OutOfStock:         http.StatusTooManyRequests,
+	NotInFlashSale:     http.StatusBadRequest,
+	LimitReached:       http.StatusTooManyRequests,
+	RateLimited:        http.StatusTooManyRequests,
+	InvalidRequest:     http.StatusBadRequest,
+	NotFound:           http.StatusNotFound,
+	OrderNotModifiable: http.StatusConflict,
+	IdempotencyReused:  http.StatusUnprocessableEntity,
+	RequestInProgress:  http.StatusConflict,
+	CampaignNotLive:    http.StatusForbidden,
+	CampaignNotFound:   http.StatusNotFound,
+	CampaignConflict:   http.StatusConflict,
+	ServiceDegraded:    http.StatusServiceUnavailable,
+	QueueFull:          http.StatusServiceUnavailable,
+	Unauthorized:       http.StatusUnauthorized,
+	Forbidden:          http.StatusForbidden,
+	ProductNotFound:    http.StatusNotFound,
+	ProductExists:      http.StatusConflict,
+	StockConflict:      http.StatusConflict,
+	WebhookNotFound:    http.StatusNotFound,
+	DeliveryInProgress: http.StatusConflict,
+	Internal:           http.StatusInternalServerError,
+}
+
+// Lang 支持的语言
+type Lang string
+
+const (
+	ZhCN Lang = "zh-CN"
+	EnUS Lang = "en-US"
+
+	DefaultLang = ZhCN
+)
+
+var messages = map[Lang]map[Code]string{
+	ZhCN: {
+		OutOfStock:         "手慢了，库存不足！",
+		NotInFlashSale:     "该商品未开放秒杀",
+		LimitReached:       "购买数量已达活动限购上限",
+		RateLimited:        "请求过于频繁，请稍后再试",
+		InvalidRequest:     "参数错误",
+		NotFound:           "订单不存在或已结束",
+		OrderNotModifiable: "订单当前不能修改",
+		IdempotencyReused:  "Idempotency-Key 已被用于其他请求",
+		RequestInProgress:  "请求正在处理中，请稍后重试",
+		CampaignNotLive:    "活动未开始或已结束",
+		CampaignNotFound:   "活动不存在",
+		CampaignConflict:   "活动时间冲突或当前状态不允许该操作",
+		ServiceDegraded:    "当前抢购人数过多，请稍后再试",
+		QueueFull:          "下单排队人数已满，请稍后再试",
+		Unauthorized:       "请先登录",
+		Forbidden:          "无权访问",
+		ProductNotFound:    "商品不存在",
+		ProductExists:      "商品已存在",
+		StockConflict:      "库存不足，无法调整",
+		WebhookNotFound:    "Webhook 订阅或投递记录不存在",
+		DeliveryInProgress: "投递仍在进行中，请稍后再重放",
+		Internal:           "系统繁忙，请稍后再试",
+	},
+	EnUS: {
+		OutOfStock:         "Sorry, this item is sold out.",
+		NotInFlashSale:     "This item is not part of a flash sale.",
+		LimitReached:       "You have reached the purchase limit for this sale.",
+		RateLimited:        "Too many requests, please try again later.",
+		InvalidRequest:     "Invalid request",
+		NotFound:           "Order not found or already closed.",
+		OrderNotModifiable: "The order can no longer be modified.",
+		IdempotencyReused:  "Idempotency-Key was already used for a different request.",
+		RequestInProgress:  "The original request is still being processed, please retry later.",
+		CampaignNotLive:    "The flash sale has not started or has ended.",
+		CampaignNotFound:   "Campaign not found.",
+		CampaignConflict:   "The campaign overlaps another campaign or cannot change state now.",
+		ServiceDegraded:    "Too many shoppers right now, please try again shortly.",
+		QueueFull:          "The order queue is full, please try again shortly.",
+		Unauthorized:       "Authentication required.",
+		Forbidden:          "You do not have permission to access this resource.",
+		ProductNotFound:    "Product not found.",
+		ProductExists:      "Product already exists.",
+		StockConflict:      "The adjustment would make stock negative.",
+		WebhookNotFound:    "Webhook subscription or delivery not found.",
+		DeliveryInProgress: "The delivery is still being retried; replay it later.",
+		Internal:           "Service is busy, please try again later.",
+	},
+}
+
+// 带参数名的 INVALID_REQUEST 文案
+var invalidFieldMessages = map[Lang]string{
+	ZhCN: "参数错误: %s",
+	EnUS: "Invalid request parameter: %s",
+}
+
+// Error API 错误
+type Error struct {
+	Code   Code
+	Field  string // INVALID_REQUEST 时出错的参数名
+	Detail string // 附加说明，原样返回不做翻译 (如 Workflow 校验器给出的原因)
+}
+
+func New(code Code) *Error {
+	return &Error{Code: code}
+}
+
+// Invalid 参数错误，field 为出错的参数名
+func Invalid(field string) *Error {
+	return &Error{Code: InvalidRequest, Field: field}
+}
+
+// WithDetail 附加说明
+func (e *Error) WithDetail(detail string) *Error {
+	e.Detail = detail
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+	}
+	return string(e.Code)
+}
+
+// HTTPStatus 对应的 HTTP 状态码，未知错误码按 500 处理
+func (e *Error) HTTPStatus() int {
+	if s, ok := httpStatus[e.Code]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// Message 按语言返回文案，缺失时回退到默认语言
+func (e *Error) Message(lang Lang) string {
+	if _, ok := messages[lang]; !ok {
+		lang = DefaultLang
+	}
+	if e.Code == InvalidRequest && e.Field != "" {
+		return fmt.Sprintf(invalidFieldMessages[lang], e.Field)
+	}
+	if msg, ok := messages[lang][e.Code]; ok {
+		return msg
+	}
+	return messages[lang][Internal]
+}
+
+// ParseAcceptLanguage 按 q 值从 Accept-Language 中选出支持的语言
+// 只比较主语言 (en-GB 也会命中 en-US)，都不支持时返回 DefaultLang
+func ParseAcceptLanguage(header string) Lang {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(f), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{tag, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		primary, _, _ := strings.Cut(c.tag, "-")
+		switch primary {
+		case "zh":
+			return ZhCN
+		case "en":
+			return EnUS
+		}
+	}
+	return DefaultLang
+}
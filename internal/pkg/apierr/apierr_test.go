@@ -0,0 +1,54 @@
+package apierr
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	cases := map[string]Lang{
+		"":                          DefaultLang,
+		"en-US":                     EnUS,
+		"en-GB,en;q=0.9":            EnUS,
+		"zh-CN,zh;q=0.9,en;q=0.8":   ZhCN,
+		"fr-FR, en;q=0.5, zh;q=0.8": ZhCN,
+		"fr-FR":                     DefaultLang,
+		"zh;q=0, en-US;q=0.3":       EnUS,
+		"EN-us":                     EnUS,
+		"de;q=0.9, en-US;q=invalid": EnUS,
+	}
+	for header, want := range cases {
+		assert.Equal(t, want, ParseAcceptLanguage(header), header)
+	}
+}
+
+func TestError_Localization(t *testing.T) {
+	err := New(OutOfStock)
+	assert.Equal(t, http.StatusTooManyRequests, err.HTTPStatus())
+	assert.Equal(t, "手慢了，库存不足！", err.Message(ZhCN))
+	assert.Equal(t, "Sorry, this item is sold out.", err.Message(EnUS))
+	// 不支持的语言回退到默认语言
+	assert.Equal(t, "手慢了，库存不足！", err.Message(Lang("fr-FR")))
+
+	invalid := Invalid("items")
+	assert.Equal(t, http.StatusBadRequest, invalid.HTTPStatus())
+	assert.Equal(t, "Invalid request parameter: items", invalid.Message(EnUS))
+
+	conflict := New(OrderNotModifiable).WithDetail("订单已开始发货，不能修改")
+	assert.Equal(t, http.StatusConflict, conflict.HTTPStatus())
+	assert.Equal(t, "ORDER_NOT_MODIFIABLE: 订单已开始发货，不能修改", conflict.Error())
+
+	// 限流与限购同为 429，但错误码不同：客户端只对限流按 Retry-After 重试
+	assert.Equal(t, http.StatusTooManyRequests, New(RateLimited).HTTPStatus())
+	assert.Equal(t, http.StatusTooManyRequests, New(LimitReached).HTTPStatus())
+	assert.NotEqual(t, New(RateLimited).Message(ZhCN), New(LimitReached).Message(ZhCN))
+
+	// 每个错误码都有双语文案和状态码
+	for code := range httpStatus {
+		for lang := range messages {
+			assert.NotEmpty(t, messages[lang][code], "%s %s", lang, code)
+		}
+	}
+}
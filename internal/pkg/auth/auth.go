@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 角色
+const (
+	RoleCustomer = "customer" // 下单、查询、修改自己的订单
+	RoleReviewer = "reviewer" // 风控人工审核
+	RoleAdmin    = "admin"    // 活动、库存等后台管理
+	RoleImporter = "importer" // 平台/B2B 批量导入订单，可代客户下单
+)
+
+var (
+	ErrMissingToken = errors.New("缺少 Bearer Token")
+	ErrInvalidToken = errors.New("Token 无效或已过期")
+)
+
+// Claims Token 中的身份信息：sub 为客户 ID，roles 为角色列表
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// CustomerID 客户 ID (sub)
+func (c *Claims) CustomerID() string {
+	return c.Subject
+}
+
+// HasRole 是否拥有任一角色
+func (c *Claims) HasRole(roles ...string) bool {
+	for _, r := range roles {
+		if slices.Contains(c.Roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Key 一把验签密钥；kid 对应 Token 头部的 kid，轮换密钥时新旧两把同时存在
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod // HS256 或 RS256
+	verify interface{}       // HS256: []byte；RS256: *rsa.PublicKey
+}
+
+// HS256Key 共享密钥
+func HS256Key(kid string, secret []byte) Key {
+	return Key{ID: kid, Method: jwt.SigningMethodHS256, verify: secret}
+}
+
+// RS256Key RSA 公钥 (私钥由签发方保管)
+func RS256Key(kid string, pub *rsa.PublicKey) Key {
+	return Key{ID: kid, Method: jwt.SigningMethodRS256, verify: pub}
+}
+
+// Verifier 校验 Bearer Token
+type Verifier struct {
+	keys     map[string]Key
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+// NewVerifier issuer / audience 为空时不校验对应字段
+func NewVerifier(issuer, audience string, keys ...Key) (*Verifier, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("至少需要一把验签密钥")
+	}
+	v := &Verifier{keys: make(map[string]Key, len(keys)), issuer: issuer, audience: audience, leeway: 30 * time.Second, now: time.Now}
+	for _, k := range keys {
+		if _, dup := v.keys[k.ID]; dup {
+			return nil, fmt.Errorf("密钥 kid 重复: %q", k.ID)
+		}
+		v.keys[k.ID] = k
+	}
+	return v, nil
+}
+
+// Verify 校验签名、过期时间、签发方与受众，返回 Claims
+// Token 必须带 exp 与 sub (客户 ID，空 sub 会让按客户过滤失效)；只有一把密钥时允许省略 kid
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.leeway),
+		jwt.WithTimeFunc(v.now),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, v.keyFor, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: 缺少 sub", ErrInvalidToken)
+	}
+	return &claims, nil
+}
+
+// keyFor 按 kid 选择密钥，并要求 Token 的 alg 与密钥一致 (防止用公钥当 HMAC 密钥的算法混淆攻击)
+func (v *Verifier) keyFor(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := v.keys[kid]
+	if !ok && kid == "" && len(v.keys) == 1 {
+		for _, only := range v.keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("未知的 kid %q", kid)
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("kid %q 不接受 %s 签名", kid, t.Method.Alg())
+	}
+	return key.verify, nil
+}
+
+// Sign 签发 Token (测试与本地开发使用，生产环境由身份服务签发)
+// signingKey: HS256 为 []byte，RS256 为 *rsa.PrivateKey
+func Sign(claims Claims, kid string, method jwt.SigningMethod, signingKey interface{}) (string, error) {
+	t := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		t.Header["kid"] = kid
+	}
+	return t.SignedString(signingKey)
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("test-secret-0123456789abcdef")
+
+func claimsFor(sub string, ttl time.Duration, roles ...string) Claims {
+	now := time.Now()
+	return Claims{
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   sub,
+			Issuer:    "omniflow-test",
+			Audience:  jwt.ClaimStrings{"omniflow-api"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+func TestVerifier_HS256AndRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	v, err := NewVerifier("omniflow-test", "omniflow-api", HS256Key("hs-1", testSecret), RS256Key("rs-1", &priv.PublicKey))
+	require.NoError(t, err)
+
+	// 1. 两种算法都能通过，Claims 原样带出
+	hs, err := Sign(claimsFor("C1", time.Hour, RoleCustomer), "hs-1", jwt.SigningMethodHS256, testSecret)
+	require.NoError(t, err)
+	claims, err := v.Verify(hs)
+	require.NoError(t, err)
+	assert.Equal(t, "C1", claims.CustomerID())
+	assert.True(t, claims.HasRole(RoleCustomer))
+	assert.False(t, claims.HasRole(RoleReviewer, RoleAdmin))
+
+	rs, err := Sign(claimsFor("R1", time.Hour, RoleReviewer), "rs-1", jwt.SigningMethodRS256, priv)
+	require.NoError(t, err)
+	claims, err = v.Verify(rs)
+	require.NoError(t, err)
+	assert.True(t, claims.HasRole(RoleReviewer))
+
+	// 2. 各种无效 Token
+	pubDER, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	bad := map[string]func() (string, error){
+		"过期": func() (string, error) {
+			return Sign(claimsFor("C1", -time.Hour, RoleCustomer), "hs-1", jwt.SigningMethodHS256, testSecret)
+		},
+		"密钥错误": func() (string, error) {
+			return Sign(claimsFor("C1", time.Hour), "hs-1", jwt.SigningMethodHS256, []byte("wrong"))
+		},
+		"未知 kid": func() (string, error) {
+			return Sign(claimsFor("C1", time.Hour), "hs-9", jwt.SigningMethodHS256, testSecret)
+		},
+		"算法混淆 (用 RSA 公钥做 HMAC)": func() (string, error) {
+			return Sign(claimsFor("C1", time.Hour, RoleAdmin), "rs-1", jwt.SigningMethodHS256, pubPEM)
+		},
+		"多把密钥时缺少 kid": func() (string, error) {
+			return Sign(claimsFor("C1", time.Hour), "", jwt.SigningMethodHS256, testSecret)
+		},
+		"受众错误": func() (string, error) {
+			c := claimsFor("C1", time.Hour)
+			c.Audience = jwt.ClaimStrings{"other"}
+			return Sign(c, "hs-1", jwt.SigningMethodHS256, testSecret)
+		},
+		"没有 sub": func() (string, error) {
+			return Sign(claimsFor("", time.Hour, RoleCustomer), "hs-1", jwt.SigningMethodHS256, testSecret)
+		},
+		"没有 exp": func() (string, error) {
+			c := claimsFor("C1", time.Hour)
+			c.ExpiresAt = nil
+			return Sign(c, "hs-1", jwt.SigningMethodHS256, testSecret)
+		},
+	}
+	for name, mint := range bad {
+		token, err := mint()
+		require.NoError(t, err)
+		_, err = v.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	// 3. 只有一把密钥时允许省略 kid
+	single, err := NewVerifier("", "", HS256Key("hs-1", testSecret))
+	require.NoError(t, err)
+	token, err := Sign(claimsFor("C1", time.Hour), "", jwt.SigningMethodHS256, testSecret)
+	require.NoError(t, err)
+	_, err = single.Verify(token)
+	assert.NoError(t, err)
+}
+
+func TestParse_KeysFromEnvAndPEM(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	pemFile := filepath.Join(t.TempDir(), "rs.pem")
+	require.NoError(t, os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600))
+	t.Setenv("TEST_JWT_SECRET", string(testSecret))
+
+	v, err := Parse([]byte(`
+issuer: omniflow-test
+audience: omniflow-api
+keys:
+  - kid: hs-1
+    alg: HS256
+    secret_env: TEST_JWT_SECRET
+  - kid: hs-unset
+    alg: HS256
+    secret_env: TEST_JWT_SECRET_UNSET
+  - kid: rs-1
+    alg: RS256
+    public_key_file: ` + pemFile + `
+`))
+	require.NoError(t, err)
+	assert.Len(t, v.keys, 2)
+
+	token, err := Sign(claimsFor("C1", time.Hour), "rs-1", jwt.SigningMethodRS256, priv)
+	require.NoError(t, err)
+	_, err = v.Verify(token)
+	assert.NoError(t, err)
+
+	_, err = Parse([]byte("keys:\n  - kid: x\n    alg: none\n"))
+	assert.ErrorContains(t, err, "不支持的算法")
+}
+
+func TestMiddleware_AuthAndRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	v, err := NewVerifier("omniflow-test", "omniflow-api", HS256Key("hs-1", testSecret))
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(Middleware(v, func(c *gin.Context, err error) { c.AbortWithStatus(http.StatusUnauthorized) }))
+	r.GET("/orders", func(c *gin.Context) { c.String(http.StatusOK, FromContext(c).CustomerID()) })
+	forbid := func(c *gin.Context) { c.AbortWithStatus(http.StatusForbidden) }
+	r.GET("/audit", RequireRole(forbid, RoleReviewer, RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(path string, claims *Claims) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if claims != nil {
+			token, err := Sign(*claims, "hs-1", jwt.SigningMethodHS256, testSecret)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	customer := claimsFor("C1", time.Hour, RoleCustomer)
+	reviewer := claimsFor("R1", time.Hour, RoleReviewer)
+
+	w := do("/orders", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+
+	w = do("/orders", &customer)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "C1", w.Body.String())
+
+	assert.Equal(t, http.StatusForbidden, do("/audit", &customer).Code)
+	assert.Equal(t, http.StatusOK, do("/audit", &reviewer).Code)
+
+	// gRPC 等非 Gin 入口：Claims 放在 context.Context 中
+	ctx := NewContext(context.Background(), &customer)
+	assert.Equal(t, "C1", ClaimsFromContext(ctx).CustomerID())
+	assert.Nil(t, ClaimsFromContext(context.Background()))
+	_, ok := BearerToken("Basic abc")
+	assert.False(t, ok)
+}
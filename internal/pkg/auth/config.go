@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// keyConfig YAML 中一把验签密钥；HS256 的密钥从环境变量读取，不写进配置文件
+type keyConfig struct {
+	KID           string `yaml:"kid"`
+	Alg           string `yaml:"alg"`
+	SecretEnv     string `yaml:"secret_env"`      // HS256: 存放共享密钥的环境变量名
+	PublicKeyFile string `yaml:"public_key_file"` // RS256: PEM 格式的公钥
+}
+
+type fileConfig struct {
+	Issuer   string      `yaml:"issuer"`
+	Audience string      `yaml:"audience"`
+	Keys     []keyConfig `yaml:"keys"`
+}
+
+// Parse 从 YAML 构建 Verifier；环境变量未设置的 HS256 密钥跳过 (留日志)
+func Parse(data []byte) (*Verifier, error) {
+	var cfg fileConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析密钥配置失败: %w", err)
+	}
+	keys := make([]Key, 0, len(cfg.Keys))
+	for i, kc := range cfg.Keys {
+		switch kc.Alg {
+		case jwt.SigningMethodHS256.Alg():
+			secret := os.Getenv(kc.SecretEnv)
+			if secret == "" {
+				log.Printf("⚠️ 环境变量 %s 未设置，跳过密钥 %s", kc.SecretEnv, kc.KID)
+				continue
+			}
+			keys = append(keys, HS256Key(kc.KID, []byte(secret)))
+		case jwt.SigningMethodRS256.Alg():
+			pemData, err := os.ReadFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 把密钥 (%s): %w", i+1, kc.KID, err)
+			}
+			pub, err := jwt.ParseRSAPublicKeyFromPEM(pemData)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 把密钥 (%s): %w", i+1, kc.KID, err)
+			}
+			keys = append(keys, RS256Key(kc.KID, pub))
+		default:
+			return nil, fmt.Errorf("第 %d 把密钥 (%s): 不支持的算法 %q", i+1, kc.KID, kc.Alg)
+		}
+	}
+	return NewVerifier(cfg.Issuer, cfg.Audience, keys...)
+}
+
+// LoadFile 从文件构建 Verifier
+func LoadFile(path string) (*Verifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
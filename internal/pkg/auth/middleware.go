@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const claimsKey = "auth_claims"
+
+// Middleware 校验 Authorization: Bearer <token>，通过后把 Claims 放入 gin.Context
+// 失败时调用 reject (由调用方决定响应格式)
+func Middleware(v *Verifier, reject func(c *gin.Context, err error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := BearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="omniflow"`)
+			reject(c, ErrMissingToken)
+			return
+		}
+		claims, err := v.Verify(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="omniflow", error="invalid_token"`)
+			reject(c, err)
+			return
+		}
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// BearerToken 从 "Bearer <token>" 中取出 Token
+func BearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// RequireRole 要求拥有任一角色，否则调用 forbid
+func RequireRole(forbid func(c *gin.Context), roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims := FromContext(c); claims == nil || !claims.HasRole(roles...) {
+			forbid(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// FromContext 当前请求的 Claims，未认证时返回 nil
+func FromContext(c *gin.Context) *Claims {
+	if v, ok := c.Get(claimsKey); ok {
+		return v.(*Claims)
+	}
+	return nil
+}
+
+type ctxKey struct{}
+
+// NewContext 把 Claims 放入 context.Context (gRPC 等非 Gin 入口使用)
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, ctxKey{}, claims)
+}
+
+// ClaimsFromContext NewContext 放入的 Claims，未认证时返回 nil
+func ClaimsFromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(ctxKey{}).(*Claims)
+	return claims
+}
@@ -0,0 +1,99 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// Bus 轻量的发布/订阅：按 topic (如单个订单) 推送消息，尽力而为，不持久化
+// 订阅方需要能从持久化的数据源 (MySQL 读模型) 补齐错过的消息
+type Bus interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+	Subscribe(topic string) *Subscription
+}
+
+// subscriptionBuffer 每个订阅者最多积压的消息数
+const subscriptionBuffer = 16
+
+// Subscription 一个订阅；消费太慢 (积压超过缓冲) 时 C 会被关闭，订阅方应断开并重新补齐
+type Subscription struct {
+	C <-chan []byte
+
+	ch    chan []byte
+	topic string
+	bus   *Memory
+	once  sync.Once
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.bus.remove(s)
+}
+
+// Memory 进程内的 Bus (测试与单实例使用)，也是 Redis Bus 在本实例内的分发层
+type Memory struct {
+	mu   sync.Mutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{subs: make(map[string]map[*Subscription]struct{})}
+}
+
+// Publish 投递给本实例内该 topic 的所有订阅者，不阻塞
+func (m *Memory) Publish(_ context.Context, topic string, data []byte) error {
+	m.deliver(topic, data)
+	return nil
+}
+
+func (m *Memory) Subscribe(topic string) *Subscription {
+	ch := make(chan []byte, subscriptionBuffer)
+	s := &Subscription{C: ch, ch: ch, topic: topic, bus: m}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.subs[topic] == nil {
+		m.subs[topic] = make(map[*Subscription]struct{})
+	}
+	m.subs[topic][s] = struct{}{}
+	return s
+}
+
+func (m *Memory) deliver(topic string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for s := range m.subs[topic] {
+		select {
+		case s.ch <- data:
+		default:
+			// 消费太慢：断开该订阅，避免拖慢发布方或无声丢消息
+			m.removeLocked(s)
+		}
+	}
+}
+
+func (m *Memory) remove(s *Subscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(s)
+}
+
+func (m *Memory) removeLocked(s *Subscription) {
+	s.once.Do(func() {
+		delete(m.subs[s.topic], s)
+		if len(m.subs[s.topic]) == 0 {
+			delete(m.subs, s.topic)
+		}
+		close(s.ch)
+	})
+}
+
+// Subscribers 本实例内的订阅数
+func (m *Memory) Subscribers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, subs := range m.subs {
+		n += len(subs)
+	}
+	return n
+}
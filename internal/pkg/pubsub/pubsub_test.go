@@ -0,0 +1,89 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, s *Subscription) []byte {
+	t.Helper()
+	select {
+	case data, ok := <-s.C:
+		require.True(t, ok, "订阅已关闭")
+		return data
+	case <-time.After(2 * time.Second):
+		t.Fatal("没有收到消息")
+		return nil
+	}
+}
+
+func TestMemory_TopicsAndSlowSubscriber(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemory()
+	a := bus.Subscribe("order:A")
+	b := bus.Subscribe("order:B")
+	defer b.Close()
+
+	// 只投递给对应 topic
+	require.NoError(t, bus.Publish(ctx, "order:A", []byte(`1`)))
+	assert.Equal(t, `1`, string(receive(t, a)))
+	select {
+	case <-b.C:
+		t.Fatal("收到了其他 topic 的消息")
+	default:
+	}
+
+	// 消费太慢的订阅被断开，而不是阻塞发布方
+	for i := 0; i <= subscriptionBuffer; i++ {
+		require.NoError(t, bus.Publish(ctx, "order:A", []byte(`2`)))
+	}
+	n := 0
+	for range a.C {
+		n++
+	}
+	assert.Equal(t, subscriptionBuffer, n)
+	assert.Equal(t, 1, bus.Subscribers())
+
+	a.Close() // 重复关闭无副作用
+	b.Close()
+	assert.Zero(t, bus.Subscribers())
+}
+
+func TestRedis_FanOutAcrossInstances(t *testing.T) {
+	s := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 两个 api-server 实例 + 一个只发布的 Worker
+	newClient := func() redis.UniversalClient {
+		c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	api1, api2, worker := NewRedis(newClient()), NewRedis(newClient()), NewRedis(newClient())
+	go api1.Run(ctx)
+	go api2.Run(ctx)
+	require.Eventually(t, func() bool { return s.PubSubNumSub(DefaultChannel)[DefaultChannel] == 2 }, 2*time.Second, 10*time.Millisecond)
+
+	sub1 := api1.Subscribe("order:A")
+	defer sub1.Close()
+	sub2 := api2.Subscribe("order:A")
+	defer sub2.Close()
+	other := api2.Subscribe("order:B")
+	defer other.Close()
+
+	require.NoError(t, worker.Publish(ctx, "order:A", []byte(`{"seq":1}`)))
+	assert.JSONEq(t, `{"seq":1}`, string(receive(t, sub1)))
+	assert.JSONEq(t, `{"seq":1}`, string(receive(t, sub2)))
+	select {
+	case <-other.C:
+		t.Fatal("收到了其他 topic 的消息")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,69 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultChannel 所有 topic 共用的 Redis 频道
+const DefaultChannel = "omniflow:events"
+
+// envelope Redis 频道中的消息：topic + 原始数据
+type envelope struct {
+	Topic string          `json:"t"`
+	Data  json.RawMessage `json:"d"`
+}
+
+// Redis 跨实例的 Bus：所有 topic 共用一个 Redis 频道，每个实例只占一个订阅连接，收到后在本实例内按 topic 分发
+// (每个 SSE 连接各自 SUBSCRIBE 会为每个客户端占用一条 Redis 连接)
+// 发布方 (Worker) 只需要 Publish；订阅方 (api-server) 需要运行 Run
+type Redis struct {
+	Client  redis.UniversalClient
+	Channel string
+	local   *Memory
+}
+
+func NewRedis(client redis.UniversalClient) *Redis {
+	return &Redis{Client: client, Channel: DefaultChannel, local: NewMemory()}
+}
+
+// Publish data 必须是 JSON
+func (r *Redis) Publish(ctx context.Context, topic string, data []byte) error {
+	raw, err := json.Marshal(envelope{Topic: topic, Data: data})
+	if err != nil {
+		return err
+	}
+	return r.Client.Publish(ctx, r.Channel, raw).Err()
+}
+
+// Subscribe 订阅本实例收到的消息 (需要 Run)
+func (r *Redis) Subscribe(topic string) *Subscription {
+	return r.local.Subscribe(topic)
+}
+
+// Run 订阅 Redis 频道并在本实例内分发，直到 ctx 结束；断线由 go-redis 自动重连
+// 断线期间的消息会丢失，订阅方重连后从读模型补齐
+func (r *Redis) Run(ctx context.Context) {
+	sub := r.Client.Subscribe(ctx, r.Channel)
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var env envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Printf("⚠️ 无法解析事件消息: %v", err)
+				continue
+			}
+			r.local.deliver(env.Topic, env.Data)
+		}
+	}
+}
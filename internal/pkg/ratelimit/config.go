@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyFunc 从请求中取限流维度的值 (如客户端 IP)
+type KeyFunc func(c *gin.Context) string
+
+// ruleConfig YAML 中单条规则的定义
+type ruleConfig struct {
+	Route string  `yaml:"route"` // "POST /api/v1/orders"，不写方法表示所有方法
+	By    string  `yaml:"by"`    // 限流维度，对应 keys 中的名字
+	Rate  float64 `yaml:"rate"`  // 每秒请求数
+	Burst int     `yaml:"burst"` // 允许的突发请求数，默认 max(1, rate)
+}
+
+type fileConfig struct {
+	Rules []ruleConfig `yaml:"rules"`
+}
+
+// Parse 从 YAML 构建限流规则，keys 为可用的限流维度 (by 字段取值)
+func Parse(data []byte, keys map[string]KeyFunc) ([]Rule, error) {
+	var cfg fileConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析限流规则失败: %w", err)
+	}
+	rules := make([]Rule, 0, len(cfg.Rules))
+	for i, rc := range cfg.Rules {
+		method, route := splitRoute(rc.Route)
+		key, ok := keys[rc.By]
+		switch {
+		case route == "":
+			return nil, fmt.Errorf("第 %d 条规则缺少 route", i+1)
+		case !ok:
+			return nil, fmt.Errorf("第 %d 条规则 (%s): 未知限流维度 %q", i+1, rc.Route, rc.By)
+		case rc.Rate <= 0:
+			return nil, fmt.Errorf("第 %d 条规则 (%s): rate 必须大于 0", i+1, rc.Route)
+		}
+		if rc.Burst <= 0 {
+			rc.Burst = max(1, int(rc.Rate))
+		}
+		rules = append(rules, Rule{
+			Name:   fmt.Sprintf("%s%s:%s", method, route, rc.By),
+			Method: method,
+			Route:  route,
+			By:     rc.By,
+			Limit:  Limit{Rate: rc.Rate, Burst: rc.Burst},
+			Key:    key,
+		})
+	}
+	return rules, nil
+}
+
+// LoadFile 从文件构建限流规则
+func LoadFile(path string, keys map[string]KeyFunc) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, keys)
+}
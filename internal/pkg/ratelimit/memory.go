@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter 进程内令牌桶，只在单个实例内生效 (测试、单机部署、Redis 不可用时兜底)
+type MemoryLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	idle   time.Duration // 桶从空到满的时间，超过后桶等同于新建，可以清理
+}
+
+// NewMemoryLimiter 创建进程内限流器
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+func (m *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	return m.take(key, limit, 1), nil
+}
+
+func (m *MemoryLimiter) Peek(_ context.Context, key string, limit Limit) (Result, error) {
+	return m.take(key, limit, 0), nil
+}
+
+func (m *MemoryLimiter) Refund(_ context.Context, key string, limit Limit) error {
+	m.take(key, limit, -1)
+	return nil
+}
+
+// take 补充令牌后按 cost 处理：1 消耗、0 只检查、-1 归还
+func (m *MemoryLimiter) take(key string, limit Limit, cost int) Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.prune(now)
+
+	burst := float64(limit.Burst)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now, idle: retryAfter(burst, limit.Rate)}
+		m.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed.Seconds()*limit.Rate)
+		b.last = now
+	}
+	switch {
+	case cost < 0:
+		b.tokens = math.Min(burst, b.tokens-float64(cost))
+		return Result{Allowed: true, Remaining: int(b.tokens)}
+	case b.tokens >= 1:
+		b.tokens -= float64(cost)
+		return Result{Allowed: true, Remaining: int(b.tokens)}
+	}
+	return Result{RetryAfter: retryAfter(1-b.tokens, limit.Rate)}
+}
+
+// prune 每分钟清理一次已经攒满的桶，避免按 IP 限流时 map 无限增长 (调用方持有锁)
+func (m *MemoryLimiter) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < time.Minute {
+		return
+	}
+	m.lastPrune = now
+	for key, b := range m.buckets {
+		if now.Sub(b.last) > b.idle {
+			delete(m.buckets, key)
+		}
+	}
+}
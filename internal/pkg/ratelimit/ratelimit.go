@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limit 令牌桶参数：每秒补充 Rate 个令牌，最多攒 Burst 个
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result 一次限流判断的结果
+type Result struct {
+	Allowed    bool
+	Remaining  int           // 剩余令牌 (向下取整)
+	RetryAfter time.Duration // 被拒绝时，多久后会有令牌
+}
+
+// Limiter 令牌桶限流器，key 相同的请求共享一个桶
+type Limiter interface {
+	// Allow 有令牌时消耗一个
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	// Peek 只检查是否有令牌，不消耗
+	Peek(ctx context.Context, key string, limit Limit) (Result, error)
+	// Refund 归还一个令牌 (不超过 Burst)
+	Refund(ctx context.Context, key string, limit Limit) error
+}
+
+// Rule 一条路由限流规则
+type Rule struct {
+	Name   string // 桶 Key 的前缀 (同一路由的多条规则用它区分)
+	Method string // 空表示所有方法
+	Route  string // Gin 路由模式 (c.FullPath())，如 /api/v1/orders/:id
+	By     string // 限流维度的名字 (YAML 中的 by)，其他协议按它取值
+	Limit  Limit
+	Key    KeyFunc // 限流维度 (IP / 客户 / SKU)，返回空串表示本次请求不适用
+}
+
+func (r Rule) matches(method, route string) bool {
+	return (r.Method == "" || r.Method == method) && r.Route == route
+}
+
+// Check 按规则检查一次请求 (HTTP 与 gRPC 共用)：method/route 为 HTTP 方法与路由模式，
+// key 返回请求在某条规则上的限流维度取值 (空串表示不适用)。任一规则被拒绝时返回该规则的结果
+// 先检查所有规则再消耗令牌，被后面的规则拒绝时不占用前面规则的限额；
+// 检查与消耗之间被并发请求抢走令牌时，归还已消耗的令牌
+// 限流器出错时放行 (不能因为限流把正常请求拒掉)
+func Check(ctx context.Context, limiter Limiter, rules []Rule, method, route string, key func(Rule) string) Result {
+	type bucket struct {
+		name, key string
+		limit     Limit
+	}
+	var buckets []bucket
+	for _, rule := range rules {
+		if !rule.matches(method, route) {
+			continue
+		}
+		if k := key(rule); k != "" {
+			buckets = append(buckets, bucket{name: rule.Name, key: rule.Name + ":" + k, limit: rule.Limit})
+		}
+	}
+
+	// 1. 只检查，任一规则没有令牌时直接拒绝
+	for _, b := range buckets {
+		res, err := limiter.Peek(ctx, b.key, b.limit)
+		if err != nil {
+			log.Printf("⚠️ 限流器错误 (%s)，已放行: %v", b.name, err)
+			continue
+		}
+		if !res.Allowed {
+			return res
+		}
+	}
+
+	// 2. 消耗令牌
+	for i, b := range buckets {
+		res, err := limiter.Allow(ctx, b.key, b.limit)
+		if err != nil {
+			log.Printf("⚠️ 限流器错误 (%s)，已放行: %v", b.name, err)
+			continue
+		}
+		if !res.Allowed {
+			for _, prev := range buckets[:i] {
+				if err := limiter.Refund(ctx, prev.key, prev.limit); err != nil {
+					log.Printf("⚠️ 归还令牌失败 (%s): %v", prev.name, err)
+				}
+			}
+			return res
+		}
+	}
+	return Result{Allowed: true}
+}
+
+// Middleware 按规则限流，任一规则被拒绝时调用 reject (由调用方决定响应格式)
+// 响应头 Retry-After 为建议的重试秒数
+func Middleware(limiter Limiter, rules []Rule, reject func(c *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res := Check(c.Request.Context(), limiter, rules, c.Request.Method, c.FullPath(), func(r Rule) string { return r.Key(c) })
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(RetryAfterSeconds(res.RetryAfter)))
+			reject(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RetryAfterSeconds Retry-After 只能是整数秒，向上取整且至少 1 秒
+func RetryAfterSeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
+
+// retryAfter 还差 missing 个令牌时需要等待的时间
+func retryAfter(missing float64, rate float64) time.Duration {
+	return time.Duration(math.Ceil(missing / rate * float64(time.Second)))
+}
+
+// splitRoute "POST /api/v1/orders" -> ("POST", "/api/v1/orders")
+func splitRoute(route string) (method, path string) {
+	route = strings.TrimSpace(route)
+	if m, p, ok := strings.Cut(route, " "); ok {
+		return strings.ToUpper(m), strings.TrimSpace(p)
+	}
+	return "", route
+}
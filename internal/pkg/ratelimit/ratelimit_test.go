@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock 测试用的可拨动时钟
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// exhaust 连续请求直到被拒绝，返回放行数与最后一次结果
+func exhaust(t *testing.T, l Limiter, key string, limit Limit) (int, Result) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		res, err := l.Allow(context.Background(), key, limit)
+		require.NoError(t, err)
+		if !res.Allowed {
+			return i, res
+		}
+	}
+	t.Fatal("限流没有生效")
+	return 0, Result{}
+}
+
+func TestLimiters_TokenBucket(t *testing.T) {
+	s := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	clk := &clock{t: time.Now()}
+	mem := NewMemoryLimiter()
+	mem.now = clk.now
+	rl := NewRedisLimiter(rdb)
+	rl.now = clk.now
+
+	limit := Limit{Rate: 2, Burst: 5}
+	for name, l := range map[string]Limiter{"memory": mem, "redis": rl} {
+		t.Run(name, func(t *testing.T) {
+			// 1. 桶满时允许 burst 个突发请求
+			allowed, res := exhaust(t, l, "ip:1.2.3.4", limit)
+			assert.Equal(t, 5, allowed)
+			assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+			// 2. 不同 Key 互不影响
+			res, err := l.Allow(context.Background(), "ip:5.6.7.8", limit)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, 4, res.Remaining)
+
+			// 3. 每秒补充 2 个令牌
+			clk.advance(time.Second)
+			allowed, _ = exhaust(t, l, "ip:1.2.3.4", limit)
+			assert.Equal(t, 2, allowed)
+		})
+	}
+
+	// Redis 中的令牌按小数保存，并设置了过期时间
+	assert.True(t, s.Exists("ratelimit:ip:1.2.3.4"))
+	assert.Positive(t, s.TTL("ratelimit:ip:1.2.3.4"))
+
+	// Redis 不可用时退回进程内限流，仍然限流而不是全部放行/拒绝
+	s.Close()
+	allowed, _ := exhaust(t, rl, "ip:9.9.9.9", limit)
+	assert.Equal(t, 5, allowed)
+}
+
+const testRules = `
+rules:
+  - route: POST /api/v1/orders
+    by: ip
+    rate: 1
+    burst: 2
+  - route: POST /api/v1/orders
+    by: sku
+    rate: 1
+    burst: 3
+  - route: /api/v1/orders/:id
+    by: ip
+    rate: 100
+`
+
+func TestMiddleware_RoutesAndRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := map[string]KeyFunc{
+		"ip":  func(c *gin.Context) string { return c.ClientIP() },
+		"sku": func(c *gin.Context) string { return c.Query("sku") },
+	}
+	rules, err := Parse([]byte(testRules), keys)
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	assert.Equal(t, "POST/api/v1/orders:ip", rules[0].Name)
+	assert.Equal(t, Limit{Rate: 100, Burst: 100}, rules[2].Limit)
+
+	r := gin.New()
+	r.Use(Middleware(NewMemoryLimiter(), rules, func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusTooManyRequests)
+	}))
+	r.POST("/api/v1/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/api/v1/orders/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(method, path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 按 IP：每个 IP 突发 2 次
+	assert.Equal(t, http.StatusOK, do("POST", "/api/v1/orders", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/api/v1/orders", "10.0.0.1").Code)
+	w := do("POST", "/api/v1/orders", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// 按 SKU：不同 IP 抢同一个 SKU 共享 3 次突发 (请求不带 sku 时该规则不适用)
+	assert.Equal(t, http.StatusOK, do("POST", "/api/v1/orders?sku=iPhone15", "10.0.0.2").Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/api/v1/orders?sku=iPhone15", "10.0.0.3").Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/api/v1/orders?sku=iPhone15", "10.0.0.4").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do("POST", "/api/v1/orders?sku=iPhone15", "10.0.0.5").Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/api/v1/orders", "10.0.0.5").Code)
+
+	// 其他路由使用自己的限额
+	assert.Equal(t, http.StatusOK, do("GET", "/api/v1/orders/ORDER-1", "10.0.0.1").Code)
+
+	// 配置错误
+	_, err = Parse([]byte("rules:\n  - route: /x\n    by: device\n    rate: 1\n"), keys)
+	assert.ErrorContains(t, err, "未知限流维度")
+	_, err = Parse([]byte("rules:\n  - route: /x\n    by: ip\n"), keys)
+	assert.ErrorContains(t, err, "rate")
+}
+
+// racyLimiter 模拟检查与消耗之间被并发请求抢走令牌：steal 对应的桶在 Allow 时拒绝
+type racyLimiter struct {
+	Limiter
+	steal string
+}
+
+func (r *racyLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if key == r.steal {
+		return Result{RetryAfter: time.Second}, nil
+	}
+	return r.Limiter.Allow(ctx, key, limit)
+}
+
+func TestCheck_RejectedRuleDoesNotConsumeOthers(t *testing.T) {
+	s := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	rules := []Rule{
+		{Name: "ip", Method: "POST", Route: "/api/v1/orders", Limit: Limit{Rate: 0.01, Burst: 3}},
+		{Name: "sku", Method: "POST", Route: "/api/v1/orders", Limit: Limit{Rate: 0.01, Burst: 1}},
+	}
+	check := func(l Limiter, ip, sku string) Result {
+		return Check(context.Background(), l, rules, "POST", "/api/v1/orders", func(r Rule) string {
+			if r.Name == "ip" {
+				return ip
+			}
+			return sku
+		})
+	}
+
+	for name, l := range map[string]Limiter{"memory": NewMemoryLimiter(), "redis": NewRedisLimiter(rdb)} {
+		t.Run(name, func(t *testing.T) {
+			// SKU 只有 1 个令牌：之后被 SKU 规则拒绝的请求不占用 IP 的限额
+			assert.True(t, check(l, "1.2.3.4", "iPhone15").Allowed)
+			for i := 0; i < 5; i++ {
+				res := check(l, "1.2.3.4", "iPhone15")
+				assert.False(t, res.Allowed)
+				assert.Positive(t, res.RetryAfter)
+			}
+			res, err := l.Peek(context.Background(), "ip:1.2.3.4", rules[0].Limit)
+			require.NoError(t, err)
+			assert.Equal(t, 2, res.Remaining)
+			assert.True(t, check(l, "1.2.3.4", "Cable").Allowed)
+			assert.True(t, check(l, "1.2.3.4", "Case").Allowed)
+			assert.False(t, check(l, "1.2.3.4", "Mouse").Allowed, "IP 限额用完")
+
+			// 检查通过后 SKU 的令牌被并发请求抢走：归还已消耗的 IP 令牌
+			racy := &racyLimiter{Limiter: l, steal: "sku:Pen"}
+			assert.False(t, check(racy, "5.6.7.8", "Pen").Allowed)
+			res, err = l.Peek(context.Background(), "ip:5.6.7.8", rules[0].Limit)
+			require.NoError(t, err)
+			assert.Equal(t, 3, res.Remaining)
+
+			// 归还不超过 Burst
+			require.NoError(t, l.Refund(context.Background(), "ip:5.6.7.8", rules[0].Limit))
+			res, err = l.Peek(context.Background(), "ip:5.6.7.8", rules[0].Limit)
+			require.NoError(t, err)
+			assert.Equal(t, 3, res.Remaining)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript 原子地补充令牌，再按 cost 消耗 (1)、只检查 (0) 或归还 (-1)
+// KEYS[1]: 桶 (HASH tokens / ts)
+// ARGV: rate (每秒), burst, now (毫秒), cost
+// 返回 {是否放行, 需要等待的毫秒数, 剩余令牌}
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+    tokens = burst
+    ts = now
+end
+if now > ts then
+    tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+    ts = now
+end
+
+local allowed, wait = 0, 0
+if cost < 0 then
+    tokens = math.min(burst, tokens - cost)
+    allowed = 1
+elseif tokens >= 1 then
+    tokens = tokens - cost
+    allowed = 1
+else
+    wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+-- 令牌是小数，必须以字符串写入 (Lua number 会被 Redis 截断为整数)；用定点格式，避免 1e-05 这类科学计数法读回时解析失败
+redis.call('HSET', KEYS[1], 'tokens', string.format('%.6f', tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait, math.floor(tokens)}
+`)
+
+// RedisLimiter 基于 Redis 的令牌桶，多个 api-server 实例共享限额
+// 每个桶只有一个 Key，集群模式下不需要 hash tag；Redis 出错时退回进程内限流
+type RedisLimiter struct {
+	Client   redis.UniversalClient
+	Prefix   string        // Key 前缀，默认 ratelimit:
+	Timeout  time.Duration // 单次调用超时，默认 50ms
+	fallback *MemoryLimiter
+	now      func() time.Time
+}
+
+// NewRedisLimiter 创建 Redis 限流器
+func NewRedisLimiter(client redis.UniversalClient) *RedisLimiter {
+	return &RedisLimiter{Client: client, Prefix: "ratelimit:", Timeout: 50 * time.Millisecond, fallback: NewMemoryLimiter(), now: time.Now}
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	return r.take(ctx, key, limit, 1)
+}
+
+func (r *RedisLimiter) Peek(ctx context.Context, key string, limit Limit) (Result, error) {
+	return r.take(ctx, key, limit, 0)
+}
+
+func (r *RedisLimiter) Refund(ctx context.Context, key string, limit Limit) error {
+	_, err := r.take(ctx, key, limit, -1)
+	return err
+}
+
+func (r *RedisLimiter) take(ctx context.Context, key string, limit Limit, cost int) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	now := strconv.FormatInt(r.now().UnixMilli(), 10)
+	vals, err := tokenBucketScript.Run(ctx, r.Client, []string{r.Prefix + key}, limit.Rate, limit.Burst, now, cost).Int64Slice()
+	if err != nil {
+		// 限流不能因为 Redis 故障整体失效，也不能把请求全拒掉：按单实例限额兜底
+		return r.fallback.take(key, limit, cost), nil
+	}
+	return Result{
+		Allowed:    vals[0] == 1,
+		RetryAfter: time.Duration(vals[1]) * time.Millisecond,
+		Remaining:  int(vals[2]),
+	}, nil
+}
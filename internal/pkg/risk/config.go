@@ -0,0 +1,164 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleConfig YAML 中单条规则的定义，按 type 取用对应字段
+type ruleConfig struct {
+	Name      string        `yaml:"name"`
+	Type      string        `yaml:"type"`
+	Action    Verdict       `yaml:"action"`
+	MinAmount int           `yaml:"min_amount"`
+	Window    time.Duration `yaml:"window"`
+	MaxOrders int           `yaml:"max_orders"`
+	MaxAge    time.Duration `yaml:"max_age"`
+	SKUs      []string      `yaml:"skus"`
+}
+
+type fileConfig struct {
+	Rules []ruleConfig `yaml:"rules"`
+}
+
+// Parse 从 YAML 构建规则引擎
+func Parse(data []byte) (*Engine, error) {
+	var cfg fileConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析风控规则失败: %w", err)
+	}
+	rules := make([]Rule, 0, len(cfg.Rules))
+	for i, rc := range cfg.Rules {
+		r, err := rc.build()
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条规则 (%s): %w", i+1, rc.Name, err)
+		}
+		rules = append(rules, r)
+	}
+	return NewEngine(rules...), nil
+}
+
+// LoadFile 从文件构建规则引擎
+func LoadFile(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func (rc ruleConfig) build() (Rule, error) {
+	switch rc.Action {
+	case Approve, Review, Reject:
+	default:
+		return nil, fmt.Errorf("未知 action %q", rc.Action)
+	}
+	if rc.Name == "" {
+		rc.Name = rc.Type
+	}
+	base := baseRule{name: rc.Name, action: rc.Action}
+
+	switch rc.Type {
+	case "amount":
+		return &amountRule{baseRule: base, minAmount: rc.MinAmount}, nil
+	case "velocity":
+		if rc.Window <= 0 || rc.MaxOrders <= 0 {
+			return nil, fmt.Errorf("velocity 规则需要 window 和 max_orders")
+		}
+		return &velocityRule{baseRule: base, window: rc.Window, maxOrders: rc.MaxOrders}, nil
+	case "address_mismatch":
+		return &addressMismatchRule{baseRule: base}, nil
+	case "sku_blacklist":
+		skus := make(map[string]bool, len(rc.SKUs))
+		for _, s := range rc.SKUs {
+			skus[s] = true
+		}
+		return &skuBlacklistRule{baseRule: base, skus: skus}, nil
+	case "new_account":
+		if rc.MaxAge <= 0 {
+			return nil, fmt.Errorf("new_account 规则需要 max_age")
+		}
+		return &newAccountRule{baseRule: base, maxAge: rc.MaxAge, minAmount: rc.MinAmount}, nil
+	default:
+		return nil, fmt.Errorf("未知规则类型 %q", rc.Type)
+	}
+}
+
+// Reloader 持有当前生效的规则引擎，并在规则文件变化时热加载
+// 新规则解析失败时保留旧规则
+type Reloader struct {
+	path    string
+	mu      sync.RWMutex
+	engine  *Engine
+	modTime time.Time
+}
+
+// NewReloader 立即加载一次规则文件，失败直接返回错误
+func NewReloader(path string) (*Reloader, error) {
+	r := &Reloader{path: path}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewStaticReloader 包装一个固定的规则引擎 (测试或不需要热加载时使用)
+func NewStaticReloader(engine *Engine) *Reloader {
+	return &Reloader{engine: engine}
+}
+
+// Engine 返回当前生效的规则引擎
+func (r *Reloader) Engine() *Engine {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.engine
+}
+
+// Reload 文件修改时间变化时重新加载，返回是否发生了替换
+func (r *Reloader) Reload() (bool, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := r.engine != nil && info.ModTime().Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	engine, err := LoadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.engine = engine
+	r.modTime = info.ModTime()
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Watch 按 interval 轮询规则文件，直到 ctx 结束
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.Reload()
+			if err != nil {
+				log.Printf("⚠️ 风控规则热加载失败，继续使用旧规则: %v", err)
+			} else if changed {
+				log.Printf("🔄 风控规则已重新加载: %s", r.path)
+			}
+		}
+	}
+}
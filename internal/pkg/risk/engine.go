@@ -0,0 +1,194 @@
+package risk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Verdict 风控结论，严重程度 APPROVE < REVIEW < REJECT
+type Verdict string
+
+const (
+	Approve Verdict = "APPROVE"
+	Review  Verdict = "REVIEW"
+	Reject  Verdict = "REJECT"
+)
+
+func (v Verdict) severity() int {
+	switch v {
+	case Reject:
+		return 2
+	case Review:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Address 用于收货/账单地址比对
+type Address struct {
+	Country string
+	City    string
+}
+
+// Input 规则引擎的输入 (由 Activity 组装，引擎本身不访问任何外部存储)
+type Input struct {
+	Amount           int
+	Items            []string
+	CustomerID       string
+	ShippingAddress  *Address
+	BillingAddress   *Address
+	AccountCreatedAt time.Time   // 零值表示客户档案不存在
+	RecentOrders     []time.Time // 该客户近期的下单时间 (不含本单)
+	Now              time.Time
+}
+
+// Decision 评估结果
+type Decision struct {
+	Verdict Verdict
+	Reasons []string
+}
+
+// Rule 单条风控规则
+type Rule interface {
+	Name() string
+	// Evaluate 命中时返回 true 和原因
+	Evaluate(in Input) (bool, string)
+	Action() Verdict
+}
+
+// Engine 一组规则的不可变快照，可并发使用
+type Engine struct {
+	rules    []Rule
+	lookback time.Duration
+}
+
+func NewEngine(rules ...Rule) *Engine {
+	e := &Engine{rules: rules}
+	for _, r := range rules {
+		if v, ok := r.(*velocityRule); ok && v.window > e.lookback {
+			e.lookback = v.window
+		}
+	}
+	return e
+}
+
+// Lookback 速度类规则需要回看的最长时间窗口，调用方据此查询 RecentOrders
+func (e *Engine) Lookback() time.Duration {
+	return e.lookback
+}
+
+// Evaluate 执行全部规则，取命中规则中最严重的结论；无命中则 APPROVE
+func (e *Engine) Evaluate(in Input) Decision {
+	if in.Now.IsZero() {
+		in.Now = time.Now()
+	}
+	d := Decision{Verdict: Approve}
+	for _, r := range e.rules {
+		hit, reason := r.Evaluate(in)
+		if !hit {
+			continue
+		}
+		d.Reasons = append(d.Reasons, fmt.Sprintf("[%s] %s", r.Name(), reason))
+		if r.Action().severity() > d.Verdict.severity() {
+			d.Verdict = r.Action()
+		}
+	}
+	return d
+}
+
+type baseRule struct {
+	name   string
+	action Verdict
+}
+
+func (b baseRule) Name() string    { return b.name }
+func (b baseRule) Action() Verdict { return b.action }
+
+// amountRule 金额超过阈值
+type amountRule struct {
+	baseRule
+	minAmount int
+}
+
+func (r *amountRule) Evaluate(in Input) (bool, string) {
+	if in.Amount > r.minAmount {
+		return true, fmt.Sprintf("订单金额 %d 超过 %d", in.Amount, r.minAmount)
+	}
+	return false, ""
+}
+
+// velocityRule 同一客户在时间窗口内下单过多
+type velocityRule struct {
+	baseRule
+	window    time.Duration
+	maxOrders int
+}
+
+func (r *velocityRule) Evaluate(in Input) (bool, string) {
+	if in.CustomerID == "" {
+		return false, ""
+	}
+	count := 1 // 含本单
+	for _, t := range in.RecentOrders {
+		if in.Now.Sub(t) <= r.window {
+			count++
+		}
+	}
+	if count > r.maxOrders {
+		return true, fmt.Sprintf("客户 %s 在 %s 内下单 %d 笔，超过 %d", in.CustomerID, r.window, count, r.maxOrders)
+	}
+	return false, ""
+}
+
+// addressMismatchRule 收货地址与账单地址不一致
+type addressMismatchRule struct {
+	baseRule
+}
+
+func (r *addressMismatchRule) Evaluate(in Input) (bool, string) {
+	s, b := in.ShippingAddress, in.BillingAddress
+	if s == nil || b == nil {
+		return false, ""
+	}
+	if !strings.EqualFold(s.Country, b.Country) || !strings.EqualFold(s.City, b.City) {
+		return true, fmt.Sprintf("收货地址 (%s/%s) 与账单地址 (%s/%s) 不一致", s.Country, s.City, b.Country, b.City)
+	}
+	return false, ""
+}
+
+// skuBlacklistRule 包含黑名单商品
+type skuBlacklistRule struct {
+	baseRule
+	skus map[string]bool
+}
+
+func (r *skuBlacklistRule) Evaluate(in Input) (bool, string) {
+	for _, item := range in.Items {
+		if r.skus[item] {
+			return true, fmt.Sprintf("商品 %s 在黑名单中", item)
+		}
+	}
+	return false, ""
+}
+
+// newAccountRule 新注册账号下大额单
+type newAccountRule struct {
+	baseRule
+	maxAge    time.Duration
+	minAmount int
+}
+
+func (r *newAccountRule) Evaluate(in Input) (bool, string) {
+	if in.CustomerID == "" || in.Amount < r.minAmount {
+		return false, ""
+	}
+	if in.AccountCreatedAt.IsZero() {
+		return true, fmt.Sprintf("客户 %s 无注册记录", in.CustomerID)
+	}
+	if age := in.Now.Sub(in.AccountCreatedAt); age < r.maxAge {
+		return true, fmt.Sprintf("客户 %s 注册仅 %s", in.CustomerID, age.Truncate(time.Minute))
+	}
+	return false, ""
+}
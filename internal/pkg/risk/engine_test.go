@@ -0,0 +1,117 @@
+package risk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+rules:
+  - name: large_amount
+    type: amount
+    min_amount: 10000
+    action: REVIEW
+  - name: order_velocity
+    type: velocity
+    window: 1h
+    max_orders: 3
+    action: REVIEW
+  - name: address_mismatch
+    type: address_mismatch
+    action: REVIEW
+  - name: sku_blacklist
+    type: sku_blacklist
+    skus: ["GiftCard"]
+    action: REJECT
+  - name: new_account
+    type: new_account
+    max_age: 24h
+    min_amount: 5000
+    action: REVIEW
+`
+
+func TestEngine_Evaluate(t *testing.T) {
+	engine, err := Parse([]byte(testRules))
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, engine.Lookback())
+
+	now := time.Now()
+	cases := []struct {
+		name    string
+		in      Input
+		verdict Verdict
+		reasons int
+	}{
+		{"小额普通单", Input{Amount: 100, Items: []string{"iPhone15"}}, Approve, 0},
+		{"大额单", Input{Amount: 20000}, Review, 1},
+		{"下单过快", Input{Amount: 100, CustomerID: "C1", AccountCreatedAt: now.AddDate(-1, 0, 0),
+			RecentOrders: []time.Time{now.Add(-time.Minute), now.Add(-10 * time.Minute), now.Add(-2 * time.Hour), now.Add(-20 * time.Minute)}}, Review, 1},
+		{"地址不一致", Input{Amount: 100,
+			ShippingAddress: &Address{Country: "CN", City: "Shanghai"},
+			BillingAddress:  &Address{Country: "US", City: "New York"}}, Review, 1},
+		{"地址大小写不同视为一致", Input{Amount: 100,
+			ShippingAddress: &Address{Country: "CN", City: "shanghai"},
+			BillingAddress:  &Address{Country: "cn", City: "Shanghai"}}, Approve, 0},
+		{"黑名单优先于人工审核", Input{Amount: 20000, Items: []string{"GiftCard"}}, Reject, 2},
+		{"新账号大额单", Input{Amount: 6000, CustomerID: "C2", AccountCreatedAt: now.Add(-time.Hour)}, Review, 1},
+		{"无档案客户大额单", Input{Amount: 6000, CustomerID: "C3"}, Review, 1},
+		{"老账号", Input{Amount: 6000, CustomerID: "C4", AccountCreatedAt: now.AddDate(0, -1, 0)}, Approve, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.in.Now = now
+			d := engine.Evaluate(tc.in)
+			assert.Equal(t, tc.verdict, d.Verdict)
+			assert.Len(t, d.Reasons, tc.reasons, d.Reasons)
+		})
+	}
+}
+
+func TestParse_InvalidRule(t *testing.T) {
+	_, err := Parse([]byte("rules:\n  - type: amount\n    action: MAYBE\n"))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte("rules:\n  - type: unknown\n    action: REVIEW\n"))
+	assert.Error(t, err)
+}
+
+func TestReloader_HotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testRules), 0o644))
+
+	r, err := NewReloader(path)
+	require.NoError(t, err)
+	assert.Equal(t, Review, r.Engine().Evaluate(Input{Amount: 20000}).Verdict)
+
+	// 阈值调高后，同一订单直接放行
+	updated := "rules:\n  - type: amount\n    min_amount: 50000\n    action: REVIEW\n"
+	require.NoError(t, os.WriteFile(path, []byte(updated), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+
+	changed, err := r.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, Approve, r.Engine().Evaluate(Input{Amount: 20000}).Verdict)
+
+	// 写坏文件：保留旧规则
+	require.NoError(t, os.WriteFile(path, []byte("rules: [oops"), 0o644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+
+	_, err = r.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, Approve, r.Engine().Evaluate(Input{Amount: 20000}).Verdict)
+}
+
+func TestLoadFile_DefaultRules(t *testing.T) {
+	// 仓库自带的规则文件必须能被解析
+	engine, err := LoadFile("../../../config/risk/rules.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, Review, engine.Evaluate(Input{Amount: 10001}).Verdict)
+	assert.Equal(t, Approve, engine.Evaluate(Input{Amount: 10000}).Verdict)
+}
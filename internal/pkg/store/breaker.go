@@ -0,0 +1,394 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen 熔断器打开，请求未发往 Redis
+var ErrCircuitOpen = errors.New("Redis 熔断中")
+
+// BreakerState 熔断器状态
+//
+//	CLOSED --(连续失败达到阈值)--> OPEN --(冷却时间到)--> HALF_OPEN --(探测成功)--> CLOSED
+//	                                                   HALF_OPEN --(探测失败)--> OPEN
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常
+	BreakerHalfOpen                     // 冷却结束，放行一个探测请求
+	BreakerOpen                         // 熔断，所有请求直接失败
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerHalfOpen:
+		return "HALF_OPEN"
+	case BreakerOpen:
+		return "OPEN"
+	default:
+		return "CLOSED"
+	}
+}
+
+// 熔断器指标，name 区分不同的熔断器 (目前只有 redis)
+var (
+	breakerStateGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "omniflow_breaker_state",
+		Help: "熔断器状态: 0=CLOSED, 1=HALF_OPEN, 2=OPEN",
+	}, []string{"name"})
+	breakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "omniflow_breaker_transitions_total",
+		Help: "熔断器状态切换次数",
+	}, []string{"name", "to"})
+	breakerRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "omniflow_breaker_rejected_total",
+		Help: "熔断期间被直接拒绝的调用数",
+	}, []string{"name"})
+)
+
+// BreakerOptions 熔断器配置，零值使用默认值
+type BreakerOptions struct {
+	Name             string        // 指标中的名字，默认 redis
+	FailureThreshold int           // 连续失败多少次后熔断，默认 5
+	OpenTimeout      time.Duration // 熔断后多久放行探测请求，默认 5s
+	CallTimeout      time.Duration // 单次调用超时 (慢调用按失败计)，默认 200ms
+	SlowCallTimeout  time.Duration // 扫描与后台管理调用 (清扫、预热、活动发布等) 的超时，默认 5s
+}
+
+// Breaker 连续失败计数的熔断器
+type Breaker struct {
+	opt BreakerOptions
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool          // HALF_OPEN 时探测请求是否已放行
+	changed  chan struct{} // 状态变化时关闭，唤醒 Wait
+}
+
+// NewBreaker 创建熔断器
+func NewBreaker(opt BreakerOptions) *Breaker {
+	if opt.Name == "" {
+		opt.Name = "redis"
+	}
+	if opt.FailureThreshold <= 0 {
+		opt.FailureThreshold = 5
+	}
+	if opt.OpenTimeout <= 0 {
+		opt.OpenTimeout = 5 * time.Second
+	}
+	if opt.CallTimeout <= 0 {
+		opt.CallTimeout = 200 * time.Millisecond
+	}
+	if opt.SlowCallTimeout <= 0 {
+		opt.SlowCallTimeout = 5 * time.Second
+	}
+	breakerStateGauge.WithLabelValues(opt.Name).Set(float64(BreakerClosed))
+	return &Breaker{opt: opt, now: time.Now, changed: make(chan struct{})}
+}
+
+// State 当前状态 (冷却时间到的 OPEN 视为 HALF_OPEN)
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	return b.state
+}
+
+// refresh 冷却时间到后 OPEN -> HALF_OPEN (调用方持有锁)
+func (b *Breaker) refresh() {
+	if b.state == BreakerOpen && !b.now().Before(b.openedAt.Add(b.opt.OpenTimeout)) {
+		b.transition(BreakerHalfOpen)
+	}
+}
+
+// transition 切换状态并更新指标 (调用方持有锁)
+func (b *Breaker) transition(to BreakerState) {
+	if b.state == to {
+		return
+	}
+	b.state = to
+	b.probing = false
+	if to == BreakerOpen {
+		b.openedAt = b.now()
+	}
+	if to == BreakerClosed {
+		b.failures = 0
+	}
+	breakerStateGauge.WithLabelValues(b.opt.Name).Set(float64(to))
+	breakerTransitions.WithLabelValues(b.opt.Name, to.String()).Inc()
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// allow 判断本次调用能否发出；HALF_OPEN 时只放行一个探测请求
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	switch {
+	case b.state == BreakerOpen, b.state == BreakerHalfOpen && b.probing:
+		breakerRejected.WithLabelValues(b.opt.Name).Inc()
+		return ErrCircuitOpen
+	case b.state == BreakerHalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// record 记录调用结果
+func (b *Breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case !failed:
+		b.failures = 0
+		b.transition(BreakerClosed)
+	case b.state == BreakerHalfOpen:
+		b.transition(BreakerOpen)
+	default:
+		b.failures++
+		if b.failures >= b.opt.FailureThreshold {
+			b.transition(BreakerOpen)
+		}
+	}
+}
+
+// Wait 等待熔断器允许请求 (CLOSED 或可以探测的 HALF_OPEN)，ctx 结束时返回 ctx 的错误
+func (b *Breaker) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		b.refresh()
+		state, probing, changed := b.state, b.probing, b.changed
+		wait := b.openedAt.Add(b.opt.OpenTimeout).Sub(b.now())
+		b.mu.Unlock()
+
+		if state == BreakerClosed || state == BreakerHalfOpen && !probing {
+			return nil
+		}
+		// OPEN 等到冷却结束；HALF_OPEN 等探测结果
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if state == BreakerOpen {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// Do 在熔断器保护下执行 fn (下单热路径)，fn 收到带单次超时 (CallTimeout) 的 ctx
+// 只有说明 Redis 不健康的错误计为失败 (见 unhealthy)，调用方取消不计入
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return b.do(ctx, b.opt.CallTimeout, fn)
+}
+
+// DoSlow 同 Do，用于扫描与后台管理调用：数据量大时正常就比热路径慢，使用单独的 SlowCallTimeout
+func (b *Breaker) DoSlow(ctx context.Context, fn func(ctx context.Context) error) error {
+	return b.do(ctx, b.opt.SlowCallTimeout, fn)
+}
+
+func (b *Breaker) do(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := fn(callCtx)
+	if ctx.Err() != nil {
+		// 调用方已放弃，无法判断 Redis 是否健康；探测名额还回去
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return err
+	}
+	b.record(unhealthy(err))
+	return err
+}
+
+// unhealthy 错误是否说明 Redis 不可用：超时、网络/连接池错误，以及 LOADING、READONLY、CLUSTERDOWN 等服务端状态错误
+// redis.Nil、脚本/类型错误 (WRONGTYPE 等) 与数据错误 (预占记录损坏等) 是请求本身的问题，Redis 照常应答，不计入熔断
+func unhealthy(err error) bool {
+	var netErr net.Error
+	switch {
+	case err == nil, errors.Is(err, redis.Nil):
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, redis.ErrClosed), errors.Is(err, redis.ErrPoolTimeout), errors.Is(err, redis.ErrPoolExhausted),
+		errors.As(err, &netErr):
+		return true
+	}
+	return redis.IsLoadingError(err) || redis.IsReadOnlyError(err) || redis.IsClusterDownError(err) ||
+		redis.IsTryAgainError(err) || redis.IsMasterDownError(err) || redis.IsMaxClientsError(err) || redis.IsOOMError(err)
+}
+
+// BreakerStore 带熔断的 StockStore：Redis 慢或不可用时快速失败 (ErrCircuitOpen)，由调用方决定降级方式
+// 下单热路径 (扣减、预占、幂等、活动查询) 使用 CallTimeout；库存管理、活动发布与 Sweeper 的扫描使用 SlowCallTimeout
+// 补货订阅不经过熔断器 (go-redis 自动重连)
+type BreakerStore struct {
+	StockStore
+	Breaker *Breaker
+}
+
+var _ StockStore = (*BreakerStore)(nil)
+
+// NewBreakerStore 用熔断器包装 next
+func NewBreakerStore(next StockStore, opt BreakerOptions) *BreakerStore {
+	return &BreakerStore{StockStore: next, Breaker: NewBreaker(opt)}
+}
+
+func call[T any](b *Breaker, ctx context.Context, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := b.Do(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = fn(ctx)
+		return err
+	})
+	return v, err
+}
+
+// callSlow 扫描与后台管理调用 (见 Breaker.DoSlow)
+func callSlow[T any](b *Breaker, ctx context.Context, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := b.DoSlow(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = fn(ctx)
+		return err
+	})
+	return v, err
+}
+
+func (s *BreakerStore) PreheatStock(ctx context.Context, sku string, stock int) error {
+	return s.Breaker.DoSlow(ctx, func(ctx context.Context) error { return s.StockStore.PreheatStock(ctx, sku, stock) })
+}
+
+func (s *BreakerStore) ReshardStock(ctx context.Context, sku string, buckets int) (int, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) (int, error) { return s.StockStore.ReshardStock(ctx, sku, buckets) })
+}
+
+func (s *BreakerStore) RebalanceStock(ctx context.Context, sku string) (int, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) (int, error) { return s.StockStore.RebalanceStock(ctx, sku) })
+}
+
+func (s *BreakerStore) StockLevel(ctx context.Context, sku string) (total int, ok bool, err error) {
+	err = s.Breaker.DoSlow(ctx, func(ctx context.Context) error {
+		var err error
+		total, ok, err = s.StockStore.StockLevel(ctx, sku)
+		return err
+	})
+	return total, ok, err
+}
+
+func (s *BreakerStore) AddStock(ctx context.Context, sku string, qty int) (bool, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) (bool, error) { return s.StockStore.AddStock(ctx, sku, qty) })
+}
+
+func (s *BreakerStore) DeductStockWithOutbox(ctx context.Context, entry OutboxEntry, expiresAt time.Time) (int, error) {
+	return call(s.Breaker, ctx, func(ctx context.Context) (int, error) {
+		return s.StockStore.DeductStockWithOutbox(ctx, entry, expiresAt)
+	})
+}
+
+func (s *BreakerStore) AckOutbox(ctx context.Context, sku, orderID string) error {
+	return s.Breaker.Do(ctx, func(ctx context.Context) error { return s.StockStore.AckOutbox(ctx, sku, orderID) })
+}
+
+func (s *BreakerStore) PendingOutbox(ctx context.Context, before time.Time, limit int64) ([]OutboxEntry, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) ([]OutboxEntry, error) {
+		return s.StockStore.PendingOutbox(ctx, before, limit)
+	})
+}
+
+func (s *BreakerStore) GetReservation(ctx context.Context, sku, orderID string) (*Reservation, error) {
+	return call(s.Breaker, ctx, func(ctx context.Context) (*Reservation, error) { return s.StockStore.GetReservation(ctx, sku, orderID) })
+}
+
+func (s *BreakerStore) ReleaseReservation(ctx context.Context, sku, orderID string) (bool, error) {
+	return call(s.Breaker, ctx, func(ctx context.Context) (bool, error) { return s.StockStore.ReleaseReservation(ctx, sku, orderID) })
+}
+
+func (s *BreakerStore) ConfirmReservation(ctx context.Context, sku, orderID string) error {
+	return s.Breaker.Do(ctx, func(ctx context.Context) error { return s.StockStore.ConfirmReservation(ctx, sku, orderID) })
+}
+
+func (s *BreakerStore) ExtendReservation(ctx context.Context, sku, orderID string, expiresAt time.Time) error {
+	return s.Breaker.Do(ctx, func(ctx context.Context) error {
+		return s.StockStore.ExtendReservation(ctx, sku, orderID, expiresAt)
+	})
+}
+
+func (s *BreakerStore) ReservedStock(ctx context.Context, sku string) (int, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) (int, error) { return s.StockStore.ReservedStock(ctx, sku) })
+}
+
+func (s *BreakerStore) ExpiredReservations(ctx context.Context, now time.Time, limit int64) ([]Reservation, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) ([]Reservation, error) {
+		return s.StockStore.ExpiredReservations(ctx, now, limit)
+	})
+}
+
+func (s *BreakerStore) PublishCampaign(ctx context.Context, meta CampaignMeta, allocations []CampaignAllocation) (bool, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) (bool, error) {
+		return s.StockStore.PublishCampaign(ctx, meta, allocations)
+	})
+}
+
+func (s *BreakerStore) SetCampaignState(ctx context.Context, id string, skus []string, state string) (bool, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) (bool, error) {
+		return s.StockStore.SetCampaignState(ctx, id, skus, state)
+	})
+}
+
+func (s *BreakerStore) CampaignForSKU(ctx context.Context, sku string) (meta *CampaignMeta, price int, err error) {
+	err = s.Breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		meta, price, err = s.StockStore.CampaignForSKU(ctx, sku)
+		return err
+	})
+	return meta, price, err
+}
+
+func (s *BreakerStore) CampaignStock(ctx context.Context, sku string) (int, error) {
+	return callSlow(s.Breaker, ctx, func(ctx context.Context) (int, error) { return s.StockStore.CampaignStock(ctx, sku) })
+}
+
+func (s *BreakerStore) BeginIdempotent(ctx context.Context, key, fingerprint string, pendingTTL time.Duration) (rec *IdempotencyRecord, acquired bool, err error) {
+	err = s.Breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		rec, acquired, err = s.StockStore.BeginIdempotent(ctx, key, fingerprint, pendingTTL)
+		return err
+	})
+	return rec, acquired, err
+}
+
+func (s *BreakerStore) CompleteIdempotent(ctx context.Context, key, fingerprint string, status int, body []byte, ttl time.Duration) error {
+	return s.Breaker.Do(ctx, func(ctx context.Context) error {
+		return s.StockStore.CompleteIdempotent(ctx, key, fingerprint, status, body, ttl)
+	})
+}
+
+func (s *BreakerStore) ReleaseIdempotent(ctx context.Context, key string) error {
+	return s.Breaker.Do(ctx, func(ctx context.Context) error { return s.StockStore.ReleaseIdempotent(ctx, key) })
+}
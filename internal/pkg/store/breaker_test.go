@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// latencyHook 给每条命令注入固定延迟 (模拟 Redis 变慢)
+type latencyHook struct{ delay time.Duration }
+
+func (h latencyHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h latencyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		select {
+		case <-time.After(h.delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h latencyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func newBreakerTestStore(t *testing.T, s *miniredis.Miniredis, name string) *BreakerStore {
+	rs := newTestStore(t, s.Addr())
+	return NewBreakerStore(rs, BreakerOptions{
+		Name:             name,
+		FailureThreshold: 3,
+		OpenTimeout:      100 * time.Millisecond,
+		CallTimeout:      50 * time.Millisecond,
+		SlowCallTimeout:  300 * time.Millisecond,
+	})
+}
+
+func TestBreaker_OpensOnOutageAndRecovers(t *testing.T) {
+	s := miniredis.RunT(t)
+	bs := newBreakerTestStore(t, s, "outage")
+	ctx := context.Background()
+	require.NoError(t, bs.PreheatStock(ctx, "iPhone15", 10))
+
+	// 1. Redis 宕机：连续失败 3 次后熔断
+	addr := s.Addr()
+	s.Close()
+	for i := 0; i < 3; i++ {
+		_, _, err := bs.StockLevel(ctx, "iPhone15")
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrCircuitOpen))
+	}
+	assert.Equal(t, BreakerOpen, bs.Breaker.State())
+	assert.Equal(t, float64(BreakerOpen), testutil.ToFloat64(breakerStateGauge.WithLabelValues("outage")))
+
+	// 2. 熔断期间直接失败，不再访问 Redis
+	start := time.Now()
+	_, err := bs.DeductStockWithOutbox(ctx, OutboxEntry{OrderID: "ORD-1", SKU: "iPhone15", Amount: 1, CreatedAt: time.Now()}, time.Now().Add(time.Minute))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Less(t, time.Since(start), 10*time.Millisecond)
+	assert.Equal(t, float64(1), testutil.ToFloat64(breakerRejected.WithLabelValues("outage")))
+
+	// 3. Redis 恢复，冷却结束后探测成功 -> CLOSED
+	require.NoError(t, s.StartAddr(addr))
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, bs.Breaker.Wait(waitCtx))
+	assert.Equal(t, BreakerHalfOpen, bs.Breaker.State())
+	total, ok, err := bs.StockLevel(ctx, "iPhone15")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 10, total)
+	assert.Equal(t, BreakerClosed, bs.Breaker.State())
+	assert.Equal(t, float64(BreakerClosed), testutil.ToFloat64(breakerStateGauge.WithLabelValues("outage")))
+}
+
+func TestBreaker_SlowCallsTripAndHalfOpenProbe(t *testing.T) {
+	s := miniredis.RunT(t)
+	bs := newBreakerTestStore(t, s, "latency")
+	ctx := context.Background()
+	require.NoError(t, bs.PreheatStock(ctx, "iPhone15", 10))
+
+	// 1. 每条命令延迟 80ms，超过 50ms 的单次超时，按失败计
+	rs := bs.StockStore.(*RedisStore)
+	rs.Client.AddHook(latencyHook{delay: 80 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		_, _, err := bs.CampaignForSKU(ctx, "iPhone15")
+		var netErr net.Error
+		assert.True(t, errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr), "%v", err)
+	}
+	assert.Equal(t, BreakerOpen, bs.Breaker.State())
+
+	// 2. 冷却结束只放行一个探测请求，探测仍然超时 -> 重新熔断
+	time.Sleep(110 * time.Millisecond)
+	probe := make(chan error, 1)
+	go func() {
+		_, _, err := bs.CampaignForSKU(ctx, "iPhone15")
+		probe <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, _, err := bs.CampaignForSKU(ctx, "iPhone15")
+	assert.ErrorIs(t, err, ErrCircuitOpen, "HALF_OPEN 只允许一个探测请求")
+	assert.Error(t, <-probe)
+	assert.Equal(t, BreakerOpen, bs.Breaker.State())
+
+	// 3. 调用方取消的请求不计入失败
+	b := NewBreaker(BreakerOptions{Name: "cancel", FailureThreshold: 1})
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = b.Do(cancelled, func(ctx context.Context) error { return ctx.Err() })
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, BreakerClosed, b.State())
+
+	// 4. 等待恢复超时
+	waitCtx, cancelWait := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelWait()
+	assert.ErrorIs(t, bs.Breaker.Wait(waitCtx), context.DeadlineExceeded)
+}
+
+func TestBreaker_SlowCallsAndRequestErrorsDoNotTrip(t *testing.T) {
+	s := miniredis.RunT(t)
+	bs := newBreakerTestStore(t, s, "classify")
+	ctx := context.Background()
+	require.NoError(t, bs.PreheatStock(ctx, "iPhone15", 10))
+
+	// 1. 扫描/后台调用使用单独的超时：80ms 超过热路径的 50ms，但在 300ms 内，照常成功
+	rs := bs.StockStore.(*RedisStore)
+	rs.Client.AddHook(latencyHook{delay: 80 * time.Millisecond})
+	for i := 0; i < 3; i++ {
+		total, err := bs.CampaignStock(ctx, "iPhone15")
+		require.NoError(t, err)
+		assert.Equal(t, 10, total)
+	}
+	assert.Equal(t, BreakerClosed, bs.Breaker.State())
+
+	// 2. Redis 照常应答的请求错误 (类型错误、数据损坏) 不计入熔断
+	b := NewBreaker(BreakerOptions{Name: "classify-errors", FailureThreshold: 1})
+	wrongType := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer wrongType.Close()
+	s.Set("plain", "x")
+	err := b.Do(ctx, func(ctx context.Context) error { return wrongType.HGet(ctx, "plain", "f").Err() })
+	assert.Error(t, err)
+	err = b.Do(ctx, func(ctx context.Context) error { return errors.New("预占记录损坏") })
+	assert.Error(t, err)
+	assert.Equal(t, BreakerClosed, b.State())
+
+	// 3. 服务端不可用类错误计入
+	s.SetError("LOADING Redis is loading the dataset in memory")
+	err = b.Do(ctx, func(ctx context.Context) error { return wrongType.Get(ctx, "plain").Err() })
+	assert.Error(t, err)
+	assert.Equal(t, BreakerOpen, b.State())
+}
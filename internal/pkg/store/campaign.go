@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// 秒杀活动在 Redis 中按 SKU 投影 (flash:<sku>，与库存同一个 slot)，供漏斗判断活动状态、时间窗口、售价与限购
+//   - flash:<sku>  HASH: campaign / state / start_ms / end_ms / per_user_limit / price / preheated (已预热的活动 ID)
+//   - flash:<sku>:user:<活动>:<客户>  STRING: 客户在该活动中对该 SKU 的已购数量 (活动结束一天后过期)
+//
+// 限购按 SKU 计：每个客户对活动中的每个 SKU 最多抢购 per_user_limit 件
+
+// CampaignMeta 漏斗需要的活动信息
+type CampaignMeta struct {
+	ID           string
+	State        string
+	StartAt      time.Time
+	EndAt        time.Time
+	PerUserLimit int
+}
+
+// CampaignAllocation 一个 SKU 的活动库存与售价
+type CampaignAllocation struct {
+	SKU       string
+	Quantity  int
+	SalePrice int
+}
+
+// PublishCampaign 发布活动：逐个 SKU 写入活动信息与售价，并在第一次执行时预热库存 (按 SKU 当前的分桶数写入)
+// 返回 false 表示所有 SKU 之前都已预热 (重试)，只更新了状态
+func (r *RedisStore) PublishCampaign(ctx context.Context, meta CampaignMeta, allocations []CampaignAllocation) (bool, error) {
+	preheated := false
+	for _, a := range allocations {
+		if err := r.registerSKU(ctx, a.SKU); err != nil {
+			return false, err
+		}
+		n, err := r.stockBuckets(ctx, a.SKU)
+		if err != nil {
+			return false, err
+		}
+		keys := append([]string{r.flashKey(a.SKU)}, r.stockKeys(a.SKU, n)...)
+		res, err := publishCampaignScript.Run(ctx, r.Client, keys,
+			meta.ID, meta.State, meta.StartAt.UnixMilli(), meta.EndAt.UnixMilli(), meta.PerUserLimit, a.SalePrice, a.Quantity).Int()
+		if err != nil {
+			return false, err
+		}
+		if res == 1 {
+			preheated = true
+			r.publishRestock(ctx, a.SKU)
+		}
+	}
+	return preheated, nil
+}
+
+// SetCampaignState 更新活动在各 SKU 上的状态 (暂停/恢复/结束)
+// 只更新仍属于该活动的 SKU；活动尚未发布 (没有任何 SKU 属于它) 时返回 false
+func (r *RedisStore) SetCampaignState(ctx context.Context, id string, skus []string, state string) (bool, error) {
+	published := false
+	for _, sku := range skus {
+		res, err := setCampaignStateScript.Run(ctx, r.Client, []string{r.flashKey(sku)}, id, state).Int()
+		if err != nil {
+			return false, err
+		}
+		published = published || res == 1
+	}
+	return published, nil
+}
+
+// CampaignForSKU 查询 SKU 所属活动及其售价，SKU 不在任何已发布活动中时返回 nil
+func (r *RedisStore) CampaignForSKU(ctx context.Context, sku string) (*CampaignMeta, int, error) {
+	values, err := r.Client.HMGet(ctx, r.flashKey(sku), "campaign", "state", "start_ms", "end_ms", "per_user_limit", "price").Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	id, _ := values[0].(string)
+	if id == "" {
+		return nil, 0, nil
+	}
+	field := func(i int) int64 {
+		s, _ := values[i].(string)
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return n
+	}
+	state, _ := values[1].(string)
+	meta := &CampaignMeta{
+		ID:           id,
+		State:        state,
+		StartAt:      time.UnixMilli(field(2)),
+		EndAt:        time.UnixMilli(field(3)),
+		PerUserLimit: int(field(4)),
+	}
+	return meta, int(field(5)), nil
+}
+
+// CampaignStock 读取 SKU 在 Redis 中的剩余库存 (活动结束对账用，分桶时为各桶之和)
+func (r *RedisStore) CampaignStock(ctx context.Context, sku string) (int, error) {
+	total, _, err := r.StockLevel(ctx, sku)
+	return total, err
+}
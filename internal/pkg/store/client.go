@@ -4,65 +4,169 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// 部署模式
+const (
+	ModeStandalone = "standalone" // 单机 (默认)
+	ModeSentinel   = "sentinel"   // 哨兵 (主从自动切换)
+	ModeCluster    = "cluster"    // 集群 (Key 按 SKU 的 hash tag 分布到各分片)
+)
+
+// Options Redis 连接配置
+type Options struct {
+	Mode       string
+	Addrs      []string // 单机: 一个地址；哨兵: 哨兵地址；集群: 任意若干节点地址
+	MasterName string   // 哨兵模式的主节点名
+	Password   string
+}
+
+// OptionsFromEnv 从环境变量读取配置
+// REDIS_MODE (standalone/sentinel/cluster)、REDIS_ADDRS (逗号分隔)、REDIS_MASTER、REDIS_PASSWORD
+func OptionsFromEnv() Options {
+	opt := Options{
+		Mode:       os.Getenv("REDIS_MODE"),
+		Addrs:      []string{"127.0.0.1:6379"},
+		MasterName: os.Getenv("REDIS_MASTER"),
+		Password:   os.Getenv("REDIS_PASSWORD"),
+	}
+	if v := os.Getenv("REDIS_ADDRS"); v != "" {
+		opt.Addrs = strings.Split(v, ",")
+	}
+	return opt
+}
+
 type RedisStore struct {
-	Client *redis.Client
+	Client redis.UniversalClient
+
+	cluster bool     // 集群模式：同一个 SKU 的所有 Key 带 {sku} hash tag，保证脚本涉及的 Key 在同一个 slot
+	buckets sync.Map // SKU -> cachedBuckets (分桶数本地缓存)
 }
 
-// NewRedisStore 初始化 Redis 连接
-func NewRedisStore(addr string) *RedisStore {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: "", // 本地开发通常无密码
-		DB:       0,
-
-		// 🔥🔥🔥 新增优化配置 🔥🔥🔥
-		PoolSize:     200,              // 最大连接数 (设大一点，比如 200)
-		MinIdleConns: 20,               // 最小空闲连接 (保持预热)
-		PoolTimeout:  30 * time.Second, // 等待连接的超时时间
-	})
+var _ StockStore = (*RedisStore)(nil)
+
+// New 按部署模式连接 Redis，连接失败返回错误 (由调用方决定是否退出)
+func New(ctx context.Context, opt Options) (*RedisStore, error) {
+	if len(opt.Addrs) == 0 {
+		return nil, fmt.Errorf("未配置 Redis 地址")
+	}
+	// 🔥🔥🔥 连接池优化配置 (三种模式相同) 🔥🔥🔥
+	const (
+		poolSize     = 200              // 最大连接数 (设大一点，比如 200)
+		minIdleConns = 20               // 最小空闲连接 (保持预热)
+		poolTimeout  = 30 * time.Second // 等待连接的超时时间
+	)
+
+	var rdb redis.UniversalClient
+	switch opt.Mode {
+	case "", ModeStandalone:
+		rdb = redis.NewClient(&redis.Options{
+			Addr:         opt.Addrs[0],
+			Password:     opt.Password,
+			PoolSize:     poolSize,
+			MinIdleConns: minIdleConns,
+			PoolTimeout:  poolTimeout,
+		})
+	case ModeSentinel:
+		if opt.MasterName == "" {
+			return nil, fmt.Errorf("哨兵模式需要配置主节点名")
+		}
+		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    opt.MasterName,
+			SentinelAddrs: opt.Addrs,
+			Password:      opt.Password,
+			PoolSize:      poolSize,
+			MinIdleConns:  minIdleConns,
+			PoolTimeout:   poolTimeout,
+		})
+	case ModeCluster:
+		rdb = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        opt.Addrs,
+			Password:     opt.Password,
+			PoolSize:     poolSize,
+			MinIdleConns: minIdleConns,
+			PoolTimeout:  poolTimeout,
+		})
+	default:
+		return nil, fmt.Errorf("未知的 Redis 模式: %s", opt.Mode)
+	}
 
 	// 测试连接
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("Redis 连接失败: %w", err)
+	}
 
-	if _, err := rdb.Ping(ctx).Result(); err != nil {
-		log.Fatalf("❌ Redis 连接失败: %v", err)
+	store := &RedisStore{Client: rdb, cluster: opt.Mode == ModeCluster}
+	if err := store.LoadScripts(ctx); err != nil {
+		// 不影响使用：脚本首次执行时会回退到 EVAL
+		log.Printf("⚠️ Lua 脚本预加载失败: %v", err)
 	}
-	log.Println("✅ Redis 连接成功")
-	return &RedisStore{Client: rdb}
+	return store, nil
 }
 
-// PreheatStock 库存预热：把 MySQL 库存刷入 Redis
-func (r *RedisStore) PreheatStock(ctx context.Context, productID string, stock int) error {
-	key := fmt.Sprintf("stock:%s", productID)
-	// 设置库存
-	return r.Client.Set(ctx, key, stock, 0).Err()
+// NewRedisStore 连接单机 Redis
+func NewRedisStore(addr string) (*RedisStore, error) {
+	return New(context.Background(), Options{Mode: ModeStandalone, Addrs: []string{addr}})
 }
 
-// DeductStock 原子扣减库存 (执行 Lua)
-// 返回值: 1=成功, 0=库存不足, -1=未预热
-func (r *RedisStore) DeductStock(ctx context.Context, productID string, amount int) (int, error) {
-	key := fmt.Sprintf("stock:%s", productID)
+// Close 关闭连接池
+func (r *RedisStore) Close() error {
+	return r.Client.Close()
+}
 
-	val, err := r.Client.Eval(ctx, AtomicDeductStock, []string{key}, amount).Result()
+// PreheatStock 库存预热：把 MySQL 库存刷入 Redis (已分桶的 SKU 平均写入各个桶)
+func (r *RedisStore) PreheatStock(ctx context.Context, productID string, stock int) error {
+	if err := r.registerSKU(ctx, productID); err != nil {
+		return err
+	}
+	n, err := r.stockBuckets(ctx, productID)
 	if err != nil {
-		return 0, err
+		return err
 	}
-
-	if res, ok := val.(int64); ok {
-		return int(res), nil
+	keys := r.stockKeys(productID, n)
+	shares := distribute(stock, len(keys))
+	_, err = r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			pipe.Set(ctx, key, shares[i], 0)
+		}
+		return nil
+	})
+	if err == nil && stock > 0 {
+		r.publishRestock(ctx, productID)
 	}
-	return 0, fmt.Errorf("redis 返回类型错误")
+	return err
+}
+
+// DeductStock 原子扣减库存 (执行 Lua)
+// 返回值: 1=成功, 0=库存不足, -1=未预热
+func (r *RedisStore) DeductStock(ctx context.Context, productID string, amount int) (int, error) {
+	return r.withBuckets(ctx, productID, func(n int) (int, error) {
+		keys := append([]string{r.bucketCountKey(productID)}, r.stockKeys(productID, n)...)
+		return atomicDeductStockScript.Run(ctx, r.Client, keys, amount, n, rand.Intn(n)).Int()
+	})
 }
 
 // RollbackStock 库存回滚 (补偿)
-// 当 Workflow 提交失败时，把 Redis 库存加回去
+// 当 Workflow 提交失败时，把 Redis 库存加回去 (分桶时加到任意一个桶，由重新平衡摊平)
 func (r *RedisStore) RollbackStock(ctx context.Context, productID string, amount int) error {
-	key := fmt.Sprintf("stock:%s", productID)
-	return r.Client.IncrBy(ctx, key, int64(amount)).Err()
+	n, err := r.cachedStockBuckets(ctx, productID)
+	if err != nil {
+		return err
+	}
+	keys := r.stockKeys(productID, n)
+	if err := r.Client.IncrBy(ctx, keys[rand.Intn(len(keys))], int64(amount)).Err(); err != nil {
+		return err
+	}
+	r.publishRestock(ctx, productID)
+	return nil
 }
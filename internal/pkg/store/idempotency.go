@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyRecord 幂等键对应的请求记录
+// Status == 0 表示首个请求仍在处理中，否则 Body 为首个请求的响应，重试时原样返回
+type IdempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"` // 请求体摘要，防止同一个 Key 被用于不同请求
+	Status      int             `json:"status,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+func idempotencyKey(key string) string {
+	return fmt.Sprintf("idem:%s", key)
+}
+
+// BeginIdempotent 占用幂等键 (SET NX)
+// 返回 acquired=true 表示首次请求，调用方继续处理；否则返回已有记录
+// pendingTTL 为处理中标记的有效期，进程崩溃时到期自动释放
+func (r *RedisStore) BeginIdempotent(ctx context.Context, key, fingerprint string, pendingTTL time.Duration) (*IdempotencyRecord, bool, error) {
+	pending, _ := json.Marshal(IdempotencyRecord{Fingerprint: fingerprint})
+	ok, err := r.Client.SetNX(ctx, idempotencyKey(key), pending, pendingTTL).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		return nil, true, nil
+	}
+
+	raw, err := r.Client.Get(ctx, idempotencyKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// 恰好过期：重新抢占
+		return r.BeginIdempotent(ctx, key, fingerprint, pendingTTL)
+	} else if err != nil {
+		return nil, false, err
+	}
+	var rec IdempotencyRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, false, fmt.Errorf("幂等记录损坏: %w", err)
+	}
+	return &rec, false, nil
+}
+
+// CompleteIdempotent 保存首个请求的响应，供重试回放
+func (r *RedisStore) CompleteIdempotent(ctx context.Context, key, fingerprint string, status int, body []byte, ttl time.Duration) error {
+	rec, _ := json.Marshal(IdempotencyRecord{Fingerprint: fingerprint, Status: status, Body: body})
+	return r.Client.Set(ctx, idempotencyKey(key), rec, ttl).Err()
+}
+
+// ReleaseIdempotent 首个请求失败时释放幂等键，允许客户端重试
+func (r *RedisStore) ReleaseIdempotent(ctx context.Context, key string) error {
+	return r.Client.Del(ctx, idempotencyKey(key)).Err()
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// Key 布局：一个 SKU 的库存、分桶、Outbox、预占、活动信息与限购计数都以 SKU 为 tag
+// 集群模式下 tag 写成 {sku}，同一个 SKU 的 Key 落在同一个 slot，每个 Lua 脚本只访问一个 slot
+// 不同 SKU 分布在不同分片；涉及多个 SKU 的操作 (活动发布、清扫) 按 SKU 分别执行
+//
+//	stock:<tag> / stock:<tag>:b<i>      库存 (未分桶 / 分桶)
+//	stock:<tag>:buckets                 分桶数
+//	outbox:<tag> / outbox:<tag>:data    Outbox 索引 (ZSET) 与数据 (HASH)
+//	reservations:<tag> / ...:data       预占索引 (ZSET) 与数据 (HASH)
+//	flash:<tag>                         SKU 所属活动的投影 (HASH)
+//	flash:<tag>:user:<活动>:<客户>      客户在该活动中对该 SKU 的已购数量
+//	flash:skus                          出现过秒杀库存的 SKU (SET)，清扫时遍历
+//
+// 按订单操作 Outbox / 预占时由调用方传入订单的秒杀 SKU (Outbox 记录中的 SKU，即订单的第一个商品)，不遍历所有 SKU
+const skuRegistryKey = "flash:skus"
+
+func (r *RedisStore) tag(sku string) string {
+	if r.cluster {
+		return "{" + sku + "}"
+	}
+	return sku
+}
+
+// stockKeys 分桶数为 n 时 SKU 的库存 Key
+func (r *RedisStore) stockKeys(sku string, n int) []string {
+	if n <= 1 {
+		return []string{"stock:" + r.tag(sku)}
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("stock:%s:b%d", r.tag(sku), i)
+	}
+	return keys
+}
+
+func (r *RedisStore) bucketCountKey(sku string) string { return "stock:" + r.tag(sku) + ":buckets" }
+
+func (r *RedisStore) outboxIndexKey(sku string) string { return "outbox:" + r.tag(sku) }
+
+func (r *RedisStore) outboxDataKey(sku string) string { return "outbox:" + r.tag(sku) + ":data" }
+
+func (r *RedisStore) reservationIndexKey(sku string) string { return "reservations:" + r.tag(sku) }
+
+func (r *RedisStore) reservationDataKey(sku string) string {
+	return "reservations:" + r.tag(sku) + ":data"
+}
+
+func (r *RedisStore) flashKey(sku string) string { return "flash:" + r.tag(sku) }
+
+func (r *RedisStore) limitKey(sku, campaign, customerID string) string {
+	return fmt.Sprintf("flash:%s:user:%s:%s", r.tag(sku), campaign, customerID)
+}
+
+// registerSKU 记录出现过秒杀库存的 SKU (预热/分桶/活动发布时调用，不在下单热路径上)
+func (r *RedisStore) registerSKU(ctx context.Context, sku string) error {
+	return r.Client.SAdd(ctx, skuRegistryKey, sku).Err()
+}
+
+func (r *RedisStore) registeredSKUs(ctx context.Context) ([]string, error) {
+	return r.Client.SMembers(ctx, skuRegistryKey).Result()
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Outbox：Redis 扣减成功到 Workflow 启动成功之间的交接记录
+// api-server 在启动 Workflow 后确认 (Ack)；进程中途崩溃留下的记录由 Sweeper 补启动或归还库存
+// 记录按 SKU 存放 (outbox:<sku> ZSET 按写入时间索引，outbox:<sku>:data HASH 保存 OutboxEntry JSON)，与库存在同一个 slot
+
+// OutboxEntry 一条待确认的扣减记录
+type OutboxEntry struct {
+	OrderID    string          `json:"order_id"`
+	SKU        string          `json:"sku"`
+	Amount     int             `json:"amount"`
+	Campaign   string          `json:"campaign,omitempty"`    // 所属秒杀活动，非空时校验活动时间与限购
+	CustomerID string          `json:"customer_id,omitempty"` // 限购按客户计数
+	Payload    json.RawMessage `json:"payload"`               // 启动 Workflow 所需的订单 JSON
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// DeductStockWithOutbox 原子扣减库存，同时写入 Outbox 记录和有效期到 expiresAt 的预占记录
+// 已分桶的 SKU 从订单对应的桶开始扣减，桶空了依次尝试其他桶
+// 活动商品 (entry.Campaign 非空) 额外校验活动状态、时间窗口与单用户限购，时间以 entry.CreatedAt 为准
+// 返回值: 1=成功, 0=库存不足, -1=未预热或不在活动时间内, -2=超过限购, 2=该订单已有预占 (重试请求，未重复扣减)
+func (r *RedisStore) DeductStockWithOutbox(ctx context.Context, entry OutboxEntry, expiresAt time.Time) (int, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	res := Reservation{OrderID: entry.OrderID, SKU: entry.SKU, Quantity: entry.Amount, ExpiresAt: expiresAt}
+	limitKey := ""
+	if entry.Campaign != "" {
+		limitKey = r.limitKey(entry.SKU, entry.Campaign, entry.CustomerID)
+		res.LimitKey = limitKey
+	}
+	reservation, err := json.Marshal(res)
+	if err != nil {
+		return 0, err
+	}
+	if limitKey == "" {
+		// 非活动商品不使用限购 Key，仍需传一个同 slot 的 Key 占位
+		limitKey = r.flashKey(entry.SKU)
+	}
+	return r.withBuckets(ctx, entry.SKU, func(n int) (int, error) {
+		keys := []string{
+			r.bucketCountKey(entry.SKU),
+			r.outboxIndexKey(entry.SKU), r.outboxDataKey(entry.SKU),
+			r.reservationIndexKey(entry.SKU), r.reservationDataKey(entry.SKU),
+			r.flashKey(entry.SKU), limitKey,
+		}
+		keys = append(keys, r.stockKeys(entry.SKU, n)...)
+		val, err := deductStockWithOutboxScript.Run(ctx, r.Client, keys,
+			entry.Amount, entry.OrderID, entry.CreatedAt.UnixMilli(), data, expiresAt.UnixMilli(), reservation,
+			entry.Campaign, entry.CreatedAt.UnixMilli(), n, preferredBucket(entry.OrderID, n)).Result()
+		if err != nil {
+			return 0, err
+		}
+		if res, ok := val.(int64); ok {
+			return int(res), nil
+		}
+		return 0, fmt.Errorf("redis 返回类型错误")
+	})
+}
+
+// AckOutbox Workflow 已启动，删除 Outbox 记录 (预占记录保留，由订单确认或释放)
+func (r *RedisStore) AckOutbox(ctx context.Context, sku, orderID string) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, r.outboxIndexKey(sku), orderID)
+		pipe.HDel(ctx, r.outboxDataKey(sku), orderID)
+		return nil
+	})
+	return err
+}
+
+// PendingOutbox 按写入时间顺序取出早于 before 的记录 (所有 SKU 合计最多 limit 条)
+func (r *RedisStore) PendingOutbox(ctx context.Context, before time.Time, limit int64) ([]OutboxEntry, error) {
+	skus, err := r.registeredSKUs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []OutboxEntry
+	for _, sku := range skus {
+		batch, err := r.pendingOutbox(ctx, sku, before, limit)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, batch...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	if int64(len(entries)) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (r *RedisStore) pendingOutbox(ctx context.Context, sku string, before time.Time, limit int64) ([]OutboxEntry, error) {
+	ids, err := r.Client.ZRangeByScore(ctx, r.outboxIndexKey(sku), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(before.UnixMilli(), 10),
+		Count: limit,
+	}).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	values, err := r.Client.HMGet(ctx, r.outboxDataKey(sku), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]OutboxEntry, 0, len(ids))
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			// 数据缺失 (索引与数据不一致)，只剩 ID 与 SKU (没有 Payload)，交给调用方清理
+			entries = append(entries, OutboxEntry{OrderID: ids[i], SKU: sku})
+			continue
+		}
+		var entry OutboxEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			entries = append(entries, OutboxEntry{OrderID: ids[i], SKU: sku})
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -2,19 +2,34 @@ package store
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func newTestStore(t testing.TB, addr string) *RedisStore {
+	store, err := NewRedisStore(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
 func TestFlashSale_Concurrency(t *testing.T) {
 	// 1. 启动一个内存 Redis (模拟真实环境)
 	s := miniredis.RunT(t)
 
 	// 2. 初始化我们的 RedisStore
-	store := NewRedisStore(s.Addr())
+	store := newTestStore(t, s.Addr())
 	ctx := context.Background()
 
 	// 3. 预热库存：iPhone15 只有 10 个
@@ -60,3 +75,480 @@ func TestFlashSale_Concurrency(t *testing.T) {
 	// 验证 Redis 里剩下的库存应该是 0，而不是负数
 	s.CheckGet(t, "stock:iPhone15", "0")
 }
+
+func TestIdempotency_BeginCompleteRelease(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	ctx := context.Background()
+
+	// 首次请求占用成功
+	rec, acquired, err := store.BeginIdempotent(ctx, "order:K1", "fp-1", 30*time.Second)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Nil(t, rec)
+
+	// 处理中重试：拿到处理中记录
+	rec, acquired, err = store.BeginIdempotent(ctx, "order:K1", "fp-1", 30*time.Second)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+	assert.Equal(t, 0, rec.Status)
+
+	// 完成后重试：回放首个响应
+	assert.NoError(t, store.CompleteIdempotent(ctx, "order:K1", "fp-1", 200, []byte(`{"order_id":"ORDER-1"}`), 24*time.Hour))
+	rec, acquired, err = store.BeginIdempotent(ctx, "order:K1", "fp-2", 30*time.Second)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+	assert.Equal(t, "fp-1", rec.Fingerprint)
+	assert.Equal(t, 200, rec.Status)
+	assert.JSONEq(t, `{"order_id":"ORDER-1"}`, string(rec.Body))
+
+	// 处理中标记到期后自动释放 (进程崩溃场景)
+	_, acquired, _ = store.BeginIdempotent(ctx, "order:K2", "fp", 30*time.Second)
+	assert.True(t, acquired)
+	s.FastForward(31 * time.Second)
+	_, acquired, _ = store.BeginIdempotent(ctx, "order:K2", "fp", 30*time.Second)
+	assert.True(t, acquired)
+
+	// 失败释放后可以重新占用
+	assert.NoError(t, store.ReleaseIdempotent(ctx, "order:K2"))
+	_, acquired, _ = store.BeginIdempotent(ctx, "order:K2", "fp", 30*time.Second)
+	assert.True(t, acquired)
+}
+
+func TestOutbox_DeductAckRelease(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	ctx := context.Background()
+	assert.NoError(t, store.PreheatStock(ctx, "iPhone15", 2))
+
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	entry := func(id string, at time.Time) OutboxEntry {
+		return OutboxEntry{OrderID: id, SKU: "iPhone15", Amount: 1, Payload: []byte(`{"OrderID":"` + id + `"}`), CreatedAt: at}
+	}
+
+	// 扣减、Outbox 与预占记录在同一个脚本里完成
+	res, err := store.DeductStockWithOutbox(ctx, entry("O1", now.Add(-time.Minute)), expires)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+	res, _ = store.DeductStockWithOutbox(ctx, entry("O2", now), expires)
+	assert.Equal(t, 1, res)
+	// 同一订单重试不重复扣减
+	res, _ = store.DeductStockWithOutbox(ctx, entry("O2", now), expires)
+	assert.Equal(t, 2, res)
+	// 库存不足时不写 Outbox
+	res, _ = store.DeductStockWithOutbox(ctx, entry("O3", now), expires)
+	assert.Equal(t, 0, res)
+	res, _ = store.DeductStockWithOutbox(ctx, OutboxEntry{OrderID: "O4", SKU: "Unknown", Amount: 1}, expires)
+	assert.Equal(t, -1, res)
+	s.CheckGet(t, "stock:iPhone15", "0")
+
+	// 只取早于截止时间的记录
+	pending, err := store.PendingOutbox(ctx, now.Add(-30*time.Second), 10)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "O1", pending[0].OrderID)
+	assert.JSONEq(t, `{"OrderID":"O1"}`, string(pending[0].Payload))
+
+	// 释放只生效一次，并同时清理 Outbox
+	ok, err := store.ReleaseReservation(ctx, "iPhone15", "O1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = store.ReleaseReservation(ctx, "iPhone15", "O1")
+	assert.False(t, ok)
+	s.CheckGet(t, "stock:iPhone15", "1")
+	pending, _ = store.PendingOutbox(ctx, now.Add(time.Hour), 10)
+	assert.Len(t, pending, 1)
+
+	// Outbox 确认后预占仍在，由订单决定确认或释放
+	assert.NoError(t, store.AckOutbox(ctx, "iPhone15", "O2"))
+	pending, _ = store.PendingOutbox(ctx, now.Add(time.Hour), 10)
+	assert.Empty(t, pending)
+	reservation, err := store.GetReservation(ctx, "iPhone15", "O2")
+	assert.NoError(t, err)
+	assert.Equal(t, "iPhone15", reservation.SKU)
+	assert.Equal(t, 1, reservation.Quantity)
+}
+
+func TestReservation_ConfirmExtendExpire(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	ctx := context.Background()
+	assert.NoError(t, store.PreheatStock(ctx, "iPhone15", 3))
+
+	now := time.Now()
+	for i, id := range []string{"PAID", "SLOW", "LOST"} {
+		res, err := store.DeductStockWithOutbox(ctx, OutboxEntry{OrderID: id, SKU: "iPhone15", Amount: 1, CreatedAt: now}, now.Add(time.Duration(i+1)*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, res)
+	}
+
+	// 支付成功：确认后不能再释放
+	assert.NoError(t, store.ConfirmReservation(ctx, "iPhone15", "PAID"))
+	ok, _ := store.ReleaseReservation(ctx, "iPhone15", "PAID")
+	assert.False(t, ok)
+	s.CheckGet(t, "stock:iPhone15", "0")
+
+	// 续期后不在过期列表里；已确认的预占不会被续期复活
+	assert.NoError(t, store.ExtendReservation(ctx, "iPhone15", "SLOW", now.Add(time.Hour)))
+	assert.NoError(t, store.ExtendReservation(ctx, "iPhone15", "PAID", now.Add(time.Hour)))
+	expired, err := store.ExpiredReservations(ctx, now.Add(10*time.Minute), 10)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "LOST", expired[0].OrderID)
+	assert.Equal(t, "iPhone15", expired[0].SKU)
+
+	// 记录中的 expires_at 与索引一起更新，其他字段保持不变
+	res, err := store.GetReservation(ctx, "iPhone15", "SLOW")
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.True(t, now.Add(time.Hour).Equal(res.ExpiresAt), res.ExpiresAt)
+	assert.Equal(t, "SLOW", res.OrderID)
+	assert.Equal(t, "iPhone15", res.SKU)
+	assert.Equal(t, 1, res.Quantity)
+
+	res, _ = store.GetReservation(ctx, "iPhone15", "PAID")
+	assert.Nil(t, res)
+
+	// 记录损坏时不续期，留给 Sweeper 丢弃
+	s.HSet(store.reservationDataKey("iPhone15"), "LOST", "not-json")
+	assert.Error(t, store.ExtendReservation(ctx, "iPhone15", "LOST", now.Add(time.Hour)))
+	expired, err = store.ExpiredReservations(ctx, now.Add(10*time.Minute), 10)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+}
+
+func TestCampaign_PublishAndFunnel(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	ctx := context.Background()
+
+	now := time.Now()
+	meta := CampaignMeta{ID: "C1", State: "LIVE", StartAt: now.Add(-time.Minute), EndAt: now.Add(time.Hour), PerUserLimit: 2}
+	allocations := []CampaignAllocation{{SKU: "iPhone15", Quantity: 5, SalePrice: 5999}}
+	preheated, err := store.PublishCampaign(ctx, meta, allocations)
+	assert.NoError(t, err)
+	assert.True(t, preheated)
+	s.CheckGet(t, "stock:iPhone15", "5")
+
+	deduct := func(id, customer string, at time.Time) int {
+		res, err := store.DeductStockWithOutbox(ctx, OutboxEntry{OrderID: id, SKU: "iPhone15", Amount: 1, Campaign: "C1", CustomerID: customer, CreatedAt: at}, at.Add(time.Hour))
+		assert.NoError(t, err)
+		return res
+	}
+	assert.Equal(t, 1, deduct("A1", "alice", now))
+
+	// 重试发布不会覆盖已扣减的库存
+	preheated, err = store.PublishCampaign(ctx, meta, allocations)
+	assert.NoError(t, err)
+	assert.False(t, preheated)
+	s.CheckGet(t, "stock:iPhone15", "4")
+
+	got, price, err := store.CampaignForSKU(ctx, "iPhone15")
+	assert.NoError(t, err)
+	assert.Equal(t, "C1", got.ID)
+	assert.Equal(t, 2, got.PerUserLimit)
+	assert.Equal(t, 5999, price)
+
+	// 限购：第三件被拒绝；释放一单后额度退回
+	assert.Equal(t, 1, deduct("A2", "alice", now))
+	assert.Equal(t, -2, deduct("A3", "alice", now))
+	assert.Equal(t, 1, deduct("B1", "bob", now))
+	ok, err := store.ReleaseReservation(ctx, "iPhone15", "A2")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, deduct("A3", "alice", now))
+	s.CheckGet(t, "stock:iPhone15", "2")
+
+	// 时间窗口之外、暂停、结束都拒绝
+	assert.Equal(t, -1, deduct("EARLY", "carol", now.Add(-time.Hour)))
+	assert.Equal(t, -1, deduct("LATE", "carol", now.Add(2*time.Hour)))
+	ok, err = store.SetCampaignState(ctx, "C1", []string{"iPhone15"}, "PAUSED")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, -1, deduct("PAUSED", "carol", now))
+	s.CheckGet(t, "stock:iPhone15", "2")
+
+	// 未发布的活动不会修改 SKU 当前所属的活动
+	ok, err = store.SetCampaignState(ctx, "C2", []string{"iPhone15", "MacPro"}, "LIVE")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "PAUSED", s.HGet("flash:iPhone15", "state"))
+	assert.False(t, s.Exists("flash:MacPro"))
+}
+
+func TestStockBuckets_FailoverReshardRebalance(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	ctx := context.Background()
+	assert.NoError(t, store.PreheatStock(ctx, "iPhone15", 10))
+
+	// 另一个 api-server 实例：缓存了未分桶的布局
+	stale := newTestStore(t, s.Addr())
+	res, err := stale.DeductStock(ctx, "iPhone15", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+
+	// 拆成 4 个桶，总量不变 (9 -> 3/2/2/2)
+	total, err := store.ReshardStock(ctx, "iPhone15", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, total)
+	assert.False(t, s.Exists("stock:iPhone15"))
+	s.CheckGet(t, "stock:iPhone15:b0", "3")
+	s.CheckGet(t, "stock:iPhone15:b3", "2")
+
+	// 缓存过期前的实例收到 -3，刷新分桶数后重试成功
+	now := time.Now()
+	res, err = stale.DeductStockWithOutbox(ctx, OutboxEntry{OrderID: "STALE", SKU: "iPhone15", Amount: 1, CreatedAt: now}, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+
+	// 桶空了轮询兄弟桶，直到全部卖完
+	sold := 1
+	for i := 0; i < 20; i++ {
+		res, err := store.DeductStockWithOutbox(ctx, OutboxEntry{OrderID: fmt.Sprintf("O%d", i), SKU: "iPhone15", Amount: 1, CreatedAt: now}, now.Add(time.Hour))
+		assert.NoError(t, err)
+		if res == 1 {
+			sold++
+		}
+	}
+	assert.Equal(t, 9, sold)
+	level, ok, err := store.StockLevel(ctx, "iPhone15")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Zero(t, level)
+
+	// 释放归还到某个桶，重新平衡后摊平；合并回单个 Key
+	released, err := store.ReleaseReservation(ctx, "iPhone15", "STALE")
+	assert.NoError(t, err)
+	assert.True(t, released)
+	released, err = store.ReleaseReservation(ctx, "iPhone15", "O0")
+	assert.NoError(t, err)
+	assert.True(t, released)
+	total, err = store.RebalanceStock(ctx, "iPhone15")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	s.CheckGet(t, "stock:iPhone15:b0", "1")
+	s.CheckGet(t, "stock:iPhone15:b1", "1")
+	s.CheckGet(t, "stock:iPhone15:b2", "0")
+
+	total, err = store.ReshardStock(ctx, "iPhone15", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	s.CheckGet(t, "stock:iPhone15", "2")
+	assert.False(t, s.Exists("stock:iPhone15:buckets"))
+	assert.False(t, s.Exists("stock:iPhone15:b0"))
+}
+
+func TestAddStock_PreheatedOnlyAndReserved(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	ctx := context.Background()
+
+	// 未预热的 SKU 不创建库存 Key (否则绕过了活动预热)
+	ok, err := store.AddStock(ctx, "MacPro", 5)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, s.Exists("stock:MacPro"))
+
+	// 分桶的 SKU 加到某一个桶，总量增加
+	assert.NoError(t, store.PreheatStock(ctx, "MacPro", 4))
+	_, err = store.ReshardStock(ctx, "MacPro", 2)
+	assert.NoError(t, err)
+	ok, err = store.AddStock(ctx, "MacPro", 3)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	level, _, err := store.StockLevel(ctx, "MacPro")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, level)
+
+	// 预占件数：扣减后计入，释放后扣除
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		res, err := store.DeductStockWithOutbox(ctx, OutboxEntry{OrderID: fmt.Sprintf("R%d", i), SKU: "MacPro", Amount: 1, CreatedAt: now}, now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, res)
+	}
+	reserved, err := store.ReservedStock(ctx, "MacPro")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reserved)
+	_, err = store.ReleaseReservation(ctx, "MacPro", "R0")
+	assert.NoError(t, err)
+	reserved, err = store.ReservedStock(ctx, "MacPro")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reserved)
+}
+
+func TestSoldOutCache_InvalidatedOnRestock(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewSoldOutCache(store, time.Minute)
+	go cache.Run(ctx)
+	// 等订阅建立 (订阅成功时会清空标记)
+	assert.Eventually(t, func() bool { return len(s.PubSubChannels("")) == 1 }, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, store.PreheatStock(ctx, "iPhone15", 1))
+	now := time.Now()
+	res, err := store.DeductStockWithOutbox(ctx, OutboxEntry{OrderID: "O1", SKU: "iPhone15", Amount: 1, CreatedAt: now}, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+
+	cache.MarkSoldOut("iPhone15")
+	cache.MarkSoldOut("MacPro")
+	assert.True(t, cache.IsSoldOut("iPhone15"))
+
+	// 订单取消归还库存 -> 所有实例清除 iPhone15 的售罄标记，其他 SKU 不受影响
+	released, err := store.ReleaseReservation(ctx, "iPhone15", "O1")
+	assert.NoError(t, err)
+	assert.True(t, released)
+	assert.Eventually(t, func() bool { return !cache.IsSoldOut("iPhone15") }, time.Second, 10*time.Millisecond)
+	assert.True(t, cache.IsSoldOut("MacPro"))
+
+	// 丢失通知时按 TTL 兜底
+	short := NewSoldOutCache(store, 20*time.Millisecond)
+	short.MarkSoldOut("iPhone15")
+	assert.True(t, short.IsSoldOut("iPhone15"))
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, short.IsSoldOut("iPhone15"))
+}
+
+func TestScripts_PreloadedAndRecoverFromFlush(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	ctx := context.Background()
+
+	// NewRedisStore 已预加载所有脚本
+	for _, script := range registry {
+		exists, err := store.Client.ScriptExists(ctx, script.Hash()).Result()
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true}, exists)
+	}
+
+	// 脚本缓存被清空 (Redis 重启/切主) 后 NOSCRIPT 自动回退到 EVAL
+	assert.NoError(t, store.Client.ScriptFlush(ctx).Err())
+	assert.NoError(t, store.PreheatStock(ctx, "iPhone15", 1))
+	res, err := store.DeductStock(ctx, "iPhone15", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+}
+
+// BenchmarkDeductStock 对比每次发送整段脚本 (EVAL) 与只发送 SHA1 (EVALSHA)
+//
+//	go test ./internal/pkg/store -run '^$' -bench DeductStock -benchmem
+func BenchmarkDeductStock(b *testing.B) {
+	s := miniredis.RunT(b)
+	store := newTestStore(b, s.Addr())
+	ctx := context.Background()
+	keys := []string{store.bucketCountKey("iPhone15"), "stock:iPhone15"}
+
+	b.Run("eval", func(b *testing.B) {
+		s.Set("stock:iPhone15", strconv.Itoa(b.N))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := store.Client.Eval(ctx, AtomicDeductStock, keys, 1, 1, 0).Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("evalsha", func(b *testing.B) {
+		s.Set("stock:iPhone15", strconv.Itoa(b.N))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := atomicDeductStockScript.Run(ctx, store.Client, keys, 1, 1, 0).Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// slotRecorder 记录每条命令访问的 Key，检查集群模式下同一条脚本/MGET 的 Key 是否都在同一个 hash tag 下
+type slotRecorder struct {
+	mu         sync.Mutex
+	violations []string
+}
+
+func (h *slotRecorder) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *slotRecorder) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (h *slotRecorder) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		args := cmd.Args()
+		var keys []interface{}
+		switch strings.ToLower(cmd.Name()) {
+		case "eval", "evalsha":
+			n, _ := strconv.Atoi(fmt.Sprint(args[2]))
+			keys = args[3 : 3+n]
+		case "mget":
+			keys = args[1:]
+		}
+		tags := make(map[string]bool)
+		for _, k := range keys {
+			s := fmt.Sprint(k)
+			start, end := strings.Index(s, "{"), strings.Index(s, "}")
+			if start < 0 || end <= start+1 {
+				tags[""] = true
+				continue
+			}
+			tags[s[start+1:end]] = true
+		}
+		if len(keys) > 0 && (len(tags) > 1 || tags[""]) {
+			h.mu.Lock()
+			h.violations = append(h.violations, fmt.Sprint(args))
+			h.mu.Unlock()
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func TestClusterMode_KeysShareSlot(t *testing.T) {
+	s := miniredis.RunT(t)
+	store := newTestStore(t, s.Addr())
+	store.cluster = true
+	hook := &slotRecorder{}
+	store.Client.AddHook(hook)
+	ctx := context.Background()
+
+	assert.NoError(t, store.PreheatStock(ctx, "iPhone15", 10))
+	_, err := store.ReshardStock(ctx, "iPhone15", 4)
+	assert.NoError(t, err)
+	_, err = store.RebalanceStock(ctx, "iPhone15")
+	assert.NoError(t, err)
+	assert.True(t, s.Exists("stock:{iPhone15}:b0"))
+
+	now := time.Now()
+	_, err = store.PublishCampaign(ctx, CampaignMeta{
+		ID: "CAMP-1", State: "LIVE", StartAt: now.Add(-time.Minute), EndAt: now.Add(time.Hour), PerUserLimit: 1,
+	}, []CampaignAllocation{{SKU: "MacPro", Quantity: 5, SalePrice: 9999}})
+	assert.NoError(t, err)
+
+	for _, e := range []OutboxEntry{
+		{OrderID: "ORD-1", SKU: "iPhone15", Amount: 1, CreatedAt: now},
+		{OrderID: "ORD-2", SKU: "MacPro", Amount: 1, Campaign: "CAMP-1", CustomerID: "C1", CreatedAt: now},
+	} {
+		result, err := store.DeductStockWithOutbox(ctx, e, now.Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result)
+	}
+	assert.True(t, s.Exists("outbox:{MacPro}"))
+	assert.True(t, s.Exists("flash:{MacPro}:user:CAMP-1:C1"))
+
+	// 按订单的秒杀 SKU 访问 Outbox / 预占，每个操作只落在该 SKU 的 slot
+	assert.NoError(t, store.AckOutbox(ctx, "iPhone15", "ORD-1"))
+	assert.NoError(t, store.ConfirmReservation(ctx, "iPhone15", "ORD-1"))
+	released, err := store.ReleaseReservation(ctx, "MacPro", "ORD-2")
+	assert.NoError(t, err)
+	assert.True(t, released)
+	_, err = store.SetCampaignState(ctx, "CAMP-1", []string{"MacPro"}, "ENDED")
+	assert.NoError(t, err)
+	total, _, err := store.StockLevel(ctx, "iPhone15")
+	assert.NoError(t, err)
+	assert.Equal(t, 9, total)
+
+	assert.Empty(t, hook.violations, "集群模式下脚本/MGET 的 Key 必须在同一个 slot")
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 脚本注册表：所有 Lua 脚本都通过 EVALSHA 执行，只发送 40 字节的 SHA1 而不是整段脚本
+// redis.Script.Run 遇到 NOSCRIPT (Redis 重启、主从切换后脚本缓存丢失) 时自动回退到 EVAL 并重新缓存
+// 新增原子操作时用 newScript 注册，启动时由 LoadScripts 统一预加载
+var registry []*redis.Script
+
+func newScript(src string) *redis.Script {
+	s := redis.NewScript(src)
+	registry = append(registry, s)
+	return s
+}
+
+var (
+	atomicDeductStockScript     = newScript(AtomicDeductStock)
+	deductStockWithOutboxScript = newScript(DeductStockWithOutbox)
+	releaseReservationScript    = newScript(ReleaseReservation)
+	extendReservationScript     = newScript(ExtendReservation)
+	publishCampaignScript       = newScript(PublishCampaign)
+	setCampaignStateScript      = newScript(SetCampaignState)
+	reshardStockScript          = newScript(ReshardStock)
+	addStockScript              = newScript(AddStock)
+)
+
+// LoadScripts 预加载所有脚本 (SCRIPT LOAD)，避免第一批请求都回退到 EVAL
+func (r *RedisStore) LoadScripts(ctx context.Context) error {
+	for _, s := range registry {
+		if err := s.Load(ctx, r.Client).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 秒杀预占：Redis 扣减的每一件库存都对应一条预占记录
+// 支付成功 -> Confirm (永久售出)；取消/拒绝/启动失败 -> Release (归还库存)；都没发生 -> 过期后由 Sweeper 处理
+// 按 SKU 存放：reservations:<sku> ZSET (订单 ID -> 过期时间毫秒)，reservations:<sku>:data HASH (订单 ID -> Reservation JSON)
+
+// Reservation 一条秒杀预占记录
+type Reservation struct {
+	OrderID   string    `json:"order_id"`
+	SKU       string    `json:"sku"`
+	Quantity  int       `json:"qty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	LimitKey  string    `json:"limit_key,omitempty"` // 活动限购计数，释放时退回额度
+}
+
+// GetReservation 查询订单在 sku 上的预占记录，不存在 (已确认/已释放/非秒杀订单) 时返回 nil
+func (r *RedisStore) GetReservation(ctx context.Context, sku, orderID string) (*Reservation, error) {
+	raw, err := r.Client.HGet(ctx, r.reservationDataKey(sku), orderID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var res Reservation
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, fmt.Errorf("预占记录损坏: %w", err)
+	}
+	return &res, nil
+}
+
+// ReleaseReservation 释放预占并归还库存，返回 false 表示预占已确认、已释放或不存在
+func (r *RedisStore) ReleaseReservation(ctx context.Context, sku, orderID string) (bool, error) {
+	res, err := r.GetReservation(ctx, sku, orderID)
+	if err != nil || res == nil {
+		return false, err
+	}
+	refund, limitKey := "0", r.flashKey(res.SKU) // 非活动订单用同 slot 的 Key 占位
+	if res.LimitKey != "" {
+		refund, limitKey = "1", res.LimitKey
+	}
+	released, err := r.withBuckets(ctx, res.SKU, func(n int) (int, error) {
+		// 归还到订单优先扣减的桶 (不一定是实际扣减的桶，总量一致，由重新平衡摊平)
+		bucket := r.stockKeys(res.SKU, n)[preferredBucket(orderID, n)]
+		keys := []string{
+			r.reservationIndexKey(res.SKU), r.reservationDataKey(res.SKU),
+			r.outboxIndexKey(res.SKU), r.outboxDataKey(res.SKU),
+			bucket, limitKey, r.bucketCountKey(res.SKU),
+		}
+		return releaseReservationScript.Run(ctx, r.Client, keys, orderID, res.Quantity, refund, n).Int()
+	})
+	if err != nil {
+		return false, err
+	}
+	if released == 1 {
+		r.publishRestock(ctx, res.SKU)
+	}
+	return released == 1, nil
+}
+
+// ConfirmReservation 支付成功，预占转为售出 (不归还库存)
+func (r *RedisStore) ConfirmReservation(ctx context.Context, sku, orderID string) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, r.reservationIndexKey(sku), orderID)
+		pipe.HDel(ctx, r.reservationDataKey(sku), orderID)
+		return nil
+	})
+	return err
+}
+
+// ExtendReservation 延长预占有效期 (订单仍在处理中，如人工审核)
+// 索引与记录中的过期时间在同一个脚本里更新；预占已确认/已释放时什么都不做，不会复活记录
+func (r *RedisStore) ExtendReservation(ctx context.Context, sku, orderID string, expiresAt time.Time) error {
+	keys := []string{r.reservationIndexKey(sku), r.reservationDataKey(sku)}
+	extended, err := extendReservationScript.Run(ctx, r.Client, keys, orderID, expiresAt.UnixMilli(), expiresAt.Format(time.RFC3339Nano)).Int()
+	if err != nil {
+		return err
+	}
+	if extended < 0 {
+		return fmt.Errorf("预占记录损坏: %s", orderID)
+	}
+	return nil
+}
+
+// ExpiredReservations 按过期时间顺序取出早于 now 的预占 (所有 SKU 合计最多 limit 条)
+func (r *RedisStore) ExpiredReservations(ctx context.Context, now time.Time, limit int64) ([]Reservation, error) {
+	skus, err := r.registeredSKUs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var reservations []Reservation
+	for _, sku := range skus {
+		batch, err := r.expiredReservations(ctx, sku, now, limit)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, batch...)
+	}
+	sort.SliceStable(reservations, func(i, j int) bool { return reservations[i].ExpiresAt.Before(reservations[j].ExpiresAt) })
+	if int64(len(reservations)) > limit {
+		reservations = reservations[:limit]
+	}
+	return reservations, nil
+}
+
+// ReservedStock SKU 已扣减但尚未确认/释放的预占件数 (后台库存对账使用)
+func (r *RedisStore) ReservedStock(ctx context.Context, sku string) (int, error) {
+	values, err := r.Client.HVals(ctx, r.reservationDataKey(sku)).Result()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, raw := range values {
+		var res Reservation
+		if json.Unmarshal([]byte(raw), &res) == nil {
+			total += res.Quantity
+		}
+	}
+	return total, nil
+}
+
+func (r *RedisStore) expiredReservations(ctx context.Context, sku string, now time.Time, limit int64) ([]Reservation, error) {
+	ids, err := r.Client.ZRangeByScore(ctx, r.reservationIndexKey(sku), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: limit,
+	}).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	values, err := r.Client.HMGet(ctx, r.reservationDataKey(sku), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	reservations := make([]Reservation, 0, len(ids))
+	for i, v := range values {
+		var res Reservation
+		if raw, ok := v.(string); !ok || json.Unmarshal([]byte(raw), &res) != nil {
+			// 数据缺失无法归还，只保留 ID 与 SKU (数量为 0) 交给调用方清理
+			res = Reservation{OrderID: ids[i], SKU: sku}
+		}
+		reservations = append(reservations, res)
+	}
+	return reservations, nil
+}
@@ -1,23 +1,235 @@
 package store
 
 // AtomicDeductStock Lua 脚本
+// KEYS[1]=分桶数 Key, KEYS[2..]=库存 Key (未分桶时只有一个)
+// ARGV[1]=扣减数量, ARGV[2]=调用方看到的分桶数, ARGV[3]=优先尝试的桶 (从 0 开始)
 // 逻辑：
-// 1. 检查 Key 是否存在 (是否预热过) -> 返回 -1
-// 2. 检查库存是否足够 -> 返回 0
-// 3. 够就扣减 -> 返回 1
+// 1. 分桶数与调用方不一致 (刚重新分桶) -> 返回 -3，调用方刷新后重试
+// 2. 所有桶都不存在 (没预热过) -> 返回 -1
+// 3. 从优先桶开始依次找库存足够的桶，找到就扣减 -> 返回 1
+// 4. 都不够 -> 返回 0
 const AtomicDeductStock = `
-local key = KEYS[1]
+if tonumber(redis.call('get', KEYS[1]) or '1') ~= tonumber(ARGV[2]) then
+    return -3
+end
+` + pickBucket + `
+local amount = tonumber(ARGV[1])
+local key, missing = pick_bucket(2, tonumber(ARGV[3]), amount)
+if missing then
+    return -1
+end
+if not key then
+    return 0
+end
+redis.call('decrby', key, amount)
+return 1
+`
+
+// pickBucket 从 KEYS[first..] 的第 start 个 (0 开始) 起轮询，返回第一个库存 >= amount 的桶
+// 第二个返回值表示所有桶都不存在 (未预热)
+const pickBucket = `
+local function pick_bucket(first, start, amount)
+    local total = #KEYS - first + 1
+    local missing = true
+    for i = 0, total - 1 do
+        local key = KEYS[first + (start + i) % total]
+        local current = redis.call('get', key)
+        if current then
+            missing = false
+            if tonumber(current) >= amount then
+                return key, false
+            end
+        end
+    end
+    return nil, missing
+end
+`
+
+// DeductStockWithOutbox 扣减库存，并在同一个脚本里写入 Outbox 记录与预占记录
+// KEYS[1]=分桶数 Key, KEYS[2]=Outbox 索引 (ZSET, score=写入时间), KEYS[3]=Outbox 数据 (HASH)
+// KEYS[4]=预占索引 (ZSET, score=过期时间), KEYS[5]=预占数据 (HASH)
+// KEYS[6]=SKU 的活动投影 (HASH), KEYS[7]=用户限购计数 Key (非活动商品为占位), KEYS[8..]=库存 Key (未分桶时只有一个)
+// ARGV[1]=扣减数量, ARGV[2]=订单 ID, ARGV[3]=写入时间 (毫秒), ARGV[4]=Outbox JSON
+// ARGV[5]=过期时间 (毫秒), ARGV[6]=预占 JSON, ARGV[7]=活动 ID (非活动商品为空), ARGV[8]=当前时间 (毫秒)
+// ARGV[9]=调用方看到的分桶数, ARGV[10]=优先尝试的桶 (从 0 开始)
+// 返回值: 1=成功, 0=库存不足, -1=未预热或不在活动时间内, -2=超过限购, 2=该订单已有预占 (重试，不重复扣减)
+// -3=分桶数已变化 (调用方刷新后重试)
+const DeductStockWithOutbox = `
+if redis.call('zscore', KEYS[4], ARGV[2]) then
+    return 2
+end
+if tonumber(redis.call('get', KEYS[1]) or '1') ~= tonumber(ARGV[9]) then
+    return -3
+end
+` + pickBucket + `
 local amount = tonumber(ARGV[1])
-local current = redis.call('get', key)
+local limited = false
 
-if current == false then
+if ARGV[7] ~= '' then
+    local meta = redis.call('hmget', KEYS[6], 'campaign', 'state', 'start_ms', 'end_ms', 'per_user_limit')
+    local now = tonumber(ARGV[8])
+    if meta[1] ~= ARGV[7] or meta[2] ~= 'LIVE' or now < tonumber(meta[3]) or now >= tonumber(meta[4]) then
+        return -1
+    end
+    local limit = tonumber(meta[5] or '0')
+    if limit > 0 then
+        if tonumber(redis.call('get', KEYS[7]) or '0') + amount > limit then
+            return -2
+        end
+        limited = true
+    end
+end
+
+local key, missing = pick_bucket(8, tonumber(ARGV[10]), amount)
+if missing then
     return -1
 end
+if not key then
+    return 0
+end
 
-if tonumber(current) >= amount then
-    redis.call('decrby', key, amount)
-    return 1
-else
+redis.call('decrby', key, amount)
+if limited then
+    redis.call('incrby', KEYS[7], amount)
+    redis.call('pexpireat', KEYS[7], tonumber(redis.call('hget', KEYS[6], 'end_ms')) + 86400000)
+end
+redis.call('zadd', KEYS[2], ARGV[3], ARGV[2])
+redis.call('hset', KEYS[3], ARGV[2], ARGV[4])
+redis.call('zadd', KEYS[4], ARGV[5], ARGV[2])
+redis.call('hset', KEYS[5], ARGV[2], ARGV[6])
+return 1
+`
+
+// ReleaseReservation 删除预占记录并归还库存 (同时清理 Outbox，退回限购额度)
+// 只有成功删除预占记录的一方归还库存，api-server、Workflow 补偿与 Sweeper 之间不会重复归还
+// KEYS[1]=预占索引, KEYS[2]=预占数据, KEYS[3]=Outbox 索引, KEYS[4]=Outbox 数据, KEYS[5]=归还到的库存 Key (桶)
+// KEYS[6]=用户限购计数 Key (非活动商品时为同 slot 的占位 Key，不使用), KEYS[7]=分桶数 Key
+// ARGV[1]=订单 ID, ARGV[2]=归还数量, ARGV[3]=是否退回限购额度 ("1"/"0"), ARGV[4]=调用方看到的分桶数
+// 返回值: 1=已归还, 0=预占已确认或已归还, -3=分桶数已变化 (未做任何修改，调用方刷新后重试)
+const ReleaseReservation = `
+if tonumber(redis.call('get', KEYS[7]) or '1') ~= tonumber(ARGV[4]) then
+    return -3
+end
+redis.call('zrem', KEYS[3], ARGV[1])
+redis.call('hdel', KEYS[4], ARGV[1])
+if redis.call('zrem', KEYS[1], ARGV[1]) == 0 then
+    return 0
+end
+redis.call('hdel', KEYS[2], ARGV[1])
+redis.call('incrby', KEYS[5], tonumber(ARGV[2]))
+if ARGV[3] == '1' and redis.call('exists', KEYS[6]) == 1 then
+    redis.call('decrby', KEYS[6], tonumber(ARGV[2]))
+end
+return 1
+`
+
+// ExtendReservation 续期预占：同时更新索引中的过期时间与预占 JSON 的 expires_at
+// 只续期仍存在的预占 (已确认/已释放的不会复活)
+// KEYS[1]=预占索引, KEYS[2]=预占数据
+// ARGV[1]=订单 ID, ARGV[2]=新的过期时间 (毫秒), ARGV[3]=新的过期时间 (RFC3339，与 Go 的 JSON 编码一致)
+// 返回值: 1=已续期, 0=预占不存在, -1=预占记录损坏 (未做任何修改)
+const ExtendReservation = `
+if not redis.call('zscore', KEYS[1], ARGV[1]) then
     return 0
 end
+local raw = redis.call('hget', KEYS[2], ARGV[1])
+if not raw then
+    return -1
+end
+local ok, res = pcall(cjson.decode, raw)
+if not ok or type(res) ~= 'table' then
+    return -1
+end
+res['expires_at'] = ARGV[3]
+redis.call('hset', KEYS[2], ARGV[1], cjson.encode(res))
+redis.call('zadd', KEYS[1], 'XX', tonumber(ARGV[2]), ARGV[1])
+return 1
+`
+
+// PublishCampaign 活动开始时把活动发布到一个 SKU 上并预热库存 (幂等：同一活动只预热一次，重试只更新状态)
+// KEYS[1]=SKU 的活动投影, KEYS[2..]=该 SKU 的库存 Key (分桶时为各个桶)
+// ARGV[1]=活动 ID, ARGV[2]=状态, ARGV[3]=开始时间 (毫秒), ARGV[4]=结束时间 (毫秒), ARGV[5]=限购数量
+// ARGV[6]=售价, ARGV[7]=库存数量
+// 返回值: 1=已预热, 0=之前已预热 (只更新了状态)
+const PublishCampaign = `
+redis.call('hset', KEYS[1], 'campaign', ARGV[1], 'state', ARGV[2], 'start_ms', ARGV[3], 'end_ms', ARGV[4],
+    'per_user_limit', ARGV[5], 'price', ARGV[6])
+if redis.call('hget', KEYS[1], 'preheated') == ARGV[1] then
+    return 0
+end
+local qty = tonumber(ARGV[7])
+local n = #KEYS - 1
+for j = 1, n do
+    local share = math.floor(qty / n)
+    if j <= qty % n then
+        share = share + 1
+    end
+    redis.call('set', KEYS[1 + j], share)
+end
+redis.call('hset', KEYS[1], 'preheated', ARGV[1])
+return 1
+`
+
+// SetCampaignState 更新 SKU 上活动的状态 (SKU 不属于该活动时不修改，返回 0)
+// KEYS[1]=SKU 的活动投影, ARGV[1]=活动 ID, ARGV[2]=状态
+const SetCampaignState = `
+if redis.call('hget', KEYS[1], 'campaign') ~= ARGV[1] then
+    return 0
+end
+redis.call('hset', KEYS[1], 'state', ARGV[2])
+return 1
+`
+
+// ReshardStock 把库存重新平均分配到新的桶 (改变分桶数或重新平衡)，总量不变
+// KEYS[1]=分桶数 Key, KEYS[2..1+ARGV[1]]=当前的库存 Key, 其余为新的库存 Key
+// ARGV[1]=当前库存 Key 个数, ARGV[2]=期望的当前分桶数, ARGV[3]=新的分桶数
+// 返回值: 库存总量, -1=未预热, -3=分桶数已变化 (未做任何修改)
+const ReshardStock = `
+if tonumber(redis.call('get', KEYS[1]) or '1') ~= tonumber(ARGV[2]) then
+    return -3
+end
+local old = tonumber(ARGV[1])
+local total = 0
+local missing = true
+for i = 2, old + 1 do
+    local v = redis.call('get', KEYS[i])
+    if v then
+        missing = false
+        total = total + tonumber(v)
+    end
+    redis.call('del', KEYS[i])
+end
+if missing then
+    return -1
+end
+local n = #KEYS - old - 1
+for j = 1, n do
+    local share = math.floor(total / n)
+    if j <= total % n then
+        share = share + 1
+    end
+    redis.call('set', KEYS[old + 1 + j], share)
+end
+if tonumber(ARGV[3]) > 1 then
+    redis.call('set', KEYS[1], ARGV[3])
+else
+    redis.call('del', KEYS[1])
+end
+return total
+`
+
+// AddStock 给已预热的 SKU 补货 (后台补货同步到秒杀池)
+// KEYS[1]=分桶数 Key, KEYS[2..]=库存 Key (未分桶时只有一个)
+// ARGV[1]=补货数量, ARGV[2]=调用方看到的分桶数, ARGV[3]=加到哪个桶 (从 0 开始)
+// 返回值: 1=成功, -1=未预热 (不创建库存 Key，避免绕过活动预热), -3=分桶数已变化
+const AddStock = `
+if tonumber(redis.call('get', KEYS[1]) or '1') ~= tonumber(ARGV[2]) then
+    return -3
+end
+local key = KEYS[2 + tonumber(ARGV[3])]
+if not redis.call('get', key) then
+    return -1
+end
+redis.call('incrby', key, ARGV[1])
+return 1
 `
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// restockChannel 库存增加 (预热/活动发布/回滚/释放预占) 时发布 SKU，各 api-server 收到后清除本地售罄标记
+const restockChannel = "stock:restocked"
+
+// publishRestock 通知其他实例该 SKU 又有货了
+// 发布失败不影响主流程：售罄标记有 TTL，最多晚 TTL 恢复售卖
+func (r *RedisStore) publishRestock(ctx context.Context, sku string) {
+	_ = r.Client.Publish(ctx, restockChannel, sku).Err()
+}
+
+// SubscribeRestock 订阅补货通知，消息内容为 SKU
+func (r *RedisStore) SubscribeRestock(ctx context.Context) *redis.PubSub {
+	return r.Client.Subscribe(ctx, restockChannel)
+}
+
+// SoldOutCache api-server 进程内的售罄标记
+// 秒杀 90% 以上的请求是被拒绝的，SKU 卖完后直接在本地返回，不再访问 Redis
+type SoldOutCache struct {
+	store StockStore
+	ttl   time.Duration // 标记的最长有效期 (丢失补货通知时的兜底)
+
+	mu    sync.RWMutex
+	until map[string]time.Time
+}
+
+// NewSoldOutCache 创建售罄缓存，需要调用 Run 订阅补货通知
+func NewSoldOutCache(store StockStore, ttl time.Duration) *SoldOutCache {
+	return &SoldOutCache{store: store, ttl: ttl, until: make(map[string]time.Time)}
+}
+
+// IsSoldOut SKU 是否已标记售罄
+func (c *SoldOutCache) IsSoldOut(sku string) bool {
+	c.mu.RLock()
+	until, ok := c.until[sku]
+	c.mu.RUnlock()
+	return ok && time.Now().Before(until)
+}
+
+// MarkSoldOut 扣减返回库存不足时标记售罄
+func (c *SoldOutCache) MarkSoldOut(sku string) {
+	c.mu.Lock()
+	c.until[sku] = time.Now().Add(c.ttl)
+	c.mu.Unlock()
+}
+
+// Invalidate 清除 SKU 的售罄标记
+func (c *SoldOutCache) Invalidate(sku string) {
+	c.mu.Lock()
+	delete(c.until, sku)
+	c.mu.Unlock()
+}
+
+func (c *SoldOutCache) invalidateAll() {
+	c.mu.Lock()
+	c.until = make(map[string]time.Time)
+	c.mu.Unlock()
+}
+
+// Run 订阅补货通知直到 ctx 结束
+// 每次 (重新) 订阅成功都清空全部标记：断线期间可能错过了补货通知
+func (c *SoldOutCache) Run(ctx context.Context) {
+	sub := c.store.SubscribeRestock(ctx)
+	defer sub.Close()
+	ch := sub.ChannelWithSubscriptions()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				c.invalidateAll()
+			case *redis.Message:
+				c.Invalidate(m.Payload)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 热点 SKU 分桶：一个 stock:<sku> 把整个 SKU 的流量压在一个 Key 上
+// 分桶后库存拆成 N 个子计数器 stock:<sku>:b<i>，扣减从订单对应的桶开始，桶空了再轮询兄弟桶
+// 分桶数记录在 stock:<sku>:buckets，不存在表示未分桶 (只有 stock:<sku>)
+// 集群模式下同一 SKU 的桶共用 {sku} hash tag (脚本需要原子地轮询各桶)，分桶降低单 Key 竞争，但不会把一个 SKU 分散到多个分片
+//
+// api-server 在本地缓存分桶数 (bucketsCacheTTL)，脚本发现分桶数与调用方不一致时返回 -3，调用方刷新后重试
+const bucketsCacheTTL = 5 * time.Second
+
+// errLayoutChanged 重试后分桶数仍在变化
+var errLayoutChanged = errors.New("库存分桶数正在变化，请重试")
+
+// preferredBucket 订单优先扣减的桶：同一订单固定，不同订单均匀分散
+func preferredBucket(orderID string, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(orderID))
+	return int(h.Sum32() % uint32(n))
+}
+
+type cachedBuckets struct {
+	n  int
+	at time.Time
+}
+
+// stockBuckets 读取分桶数 (不走缓存，管理操作使用)
+func (r *RedisStore) stockBuckets(ctx context.Context, sku string) (int, error) {
+	n, err := r.Client.Get(ctx, r.bucketCountKey(sku)).Int()
+	if errors.Is(err, redis.Nil) {
+		n, err = 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	r.buckets.Store(sku, cachedBuckets{n: n, at: time.Now()})
+	return n, nil
+}
+
+// cachedStockBuckets 读取分桶数 (下单热路径，优先使用本地缓存)
+func (r *RedisStore) cachedStockBuckets(ctx context.Context, sku string) (int, error) {
+	if v, ok := r.buckets.Load(sku); ok {
+		if c := v.(cachedBuckets); time.Since(c.at) < bucketsCacheTTL {
+			return c.n, nil
+		}
+	}
+	return r.stockBuckets(ctx, sku)
+}
+
+// withBuckets 以 SKU 当前的分桶数执行 fn；脚本返回 -3 (分桶数已变化) 时刷新缓存重试一次
+func (r *RedisStore) withBuckets(ctx context.Context, sku string, fn func(n int) (int, error)) (int, error) {
+	n, err := r.cachedStockBuckets(ctx, sku)
+	if err != nil {
+		return 0, err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		res, err := fn(n)
+		if err != nil || res != -3 {
+			return res, err
+		}
+		if n, err = r.stockBuckets(ctx, sku); err != nil {
+			return 0, err
+		}
+	}
+	return 0, errLayoutChanged
+}
+
+// ReshardStock 把 SKU 的库存平均拆到 buckets 个桶 (buckets <= 1 表示合并回单个 Key)，总量不变
+// 未预热的 SKU 只记录分桶数，之后预热时按分桶写入
+func (r *RedisStore) ReshardStock(ctx context.Context, sku string, buckets int) (int, error) {
+	if buckets < 1 {
+		buckets = 1
+	}
+	if err := r.registerSKU(ctx, sku); err != nil {
+		return 0, err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		n, err := r.stockBuckets(ctx, sku)
+		if err != nil {
+			return 0, err
+		}
+		keys := append([]string{r.bucketCountKey(sku)}, r.stockKeys(sku, n)...)
+		keys = append(keys, r.stockKeys(sku, buckets)...)
+		total, err := reshardStockScript.Run(ctx, r.Client, keys, len(r.stockKeys(sku, n)), n, buckets).Int()
+		if err != nil {
+			return 0, err
+		}
+		switch total {
+		case -3:
+			continue
+		case -1:
+			if buckets > 1 {
+				err = r.Client.Set(ctx, r.bucketCountKey(sku), buckets, 0).Err()
+			} else {
+				err = r.Client.Del(ctx, r.bucketCountKey(sku)).Err()
+			}
+			r.buckets.Delete(sku)
+			return 0, err
+		}
+		r.buckets.Store(sku, cachedBuckets{n: buckets, at: time.Now()})
+		return total, nil
+	}
+	return 0, errLayoutChanged
+}
+
+// RebalanceStock 按当前分桶数重新平均分配库存，避免流量都落到最后几个有货的桶上
+func (r *RedisStore) RebalanceStock(ctx context.Context, sku string) (int, error) {
+	n, err := r.stockBuckets(ctx, sku)
+	if err != nil {
+		return 0, err
+	}
+	return r.ReshardStock(ctx, sku, n)
+}
+
+// StockLevel 读取 SKU 的剩余库存 (各桶之和)，未预热时 ok=false
+func (r *RedisStore) StockLevel(ctx context.Context, sku string) (total int, ok bool, err error) {
+	n, err := r.stockBuckets(ctx, sku)
+	if err != nil {
+		return 0, false, err
+	}
+	// 一次 MGET 读所有桶，保证分桶数不变时读到的是同一时刻的值
+	values, err := r.Client.MGet(ctx, r.stockKeys(sku, n)...).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, v := range values {
+		if s, isStr := v.(string); isStr {
+			c, _ := strconv.Atoi(s)
+			total += c
+			ok = true
+		}
+	}
+	return total, ok, nil
+}
+
+// AddStock 给已预热的 SKU 补货 (加到任意一个桶，由重新平衡摊平)，未预热时返回 false 且不做修改
+func (r *RedisStore) AddStock(ctx context.Context, sku string, qty int) (bool, error) {
+	res, err := r.withBuckets(ctx, sku, func(n int) (int, error) {
+		keys := append([]string{r.bucketCountKey(sku)}, r.stockKeys(sku, n)...)
+		return addStockScript.Run(ctx, r.Client, keys, qty, n, rand.Intn(n)).Int()
+	})
+	if err != nil || res != 1 {
+		return false, err
+	}
+	r.publishRestock(ctx, sku)
+	return true, nil
+}
+
+// distribute 把 total 平均拆成 n 份 (余数分给前几份)
+func distribute(total, n int) []int {
+	shares := make([]int, n)
+	for i := range shares {
+		shares[i] = total / n
+		if i < total%n {
+			shares[i]++
+		}
+	}
+	return shares
+}
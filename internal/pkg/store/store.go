@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StockStore 秒杀漏斗依赖的库存存储 (api-server、Worker 与各个 Sweeper 使用)
+// RedisStore 支持单机、哨兵与集群三种部署 (见 New)
+type StockStore interface {
+	// 库存
+	PreheatStock(ctx context.Context, sku string, stock int) error
+	ReshardStock(ctx context.Context, sku string, buckets int) (int, error)
+	RebalanceStock(ctx context.Context, sku string) (int, error)
+	StockLevel(ctx context.Context, sku string) (total int, ok bool, err error)
+	AddStock(ctx context.Context, sku string, qty int) (bool, error)
+
+	// 下单漏斗与 Outbox
+	DeductStockWithOutbox(ctx context.Context, entry OutboxEntry, expiresAt time.Time) (int, error)
+	AckOutbox(ctx context.Context, sku, orderID string) error
+	PendingOutbox(ctx context.Context, before time.Time, limit int64) ([]OutboxEntry, error)
+
+	// 秒杀预占 (按订单的秒杀 SKU 定位，即 Outbox 记录中的 SKU / 订单的第一个商品)
+	GetReservation(ctx context.Context, sku, orderID string) (*Reservation, error)
+	ReleaseReservation(ctx context.Context, sku, orderID string) (bool, error)
+	ConfirmReservation(ctx context.Context, sku, orderID string) error
+	ExtendReservation(ctx context.Context, sku, orderID string, expiresAt time.Time) error
+	ExpiredReservations(ctx context.Context, now time.Time, limit int64) ([]Reservation, error)
+	ReservedStock(ctx context.Context, sku string) (int, error)
+
+	// 秒杀活动
+	PublishCampaign(ctx context.Context, meta CampaignMeta, allocations []CampaignAllocation) (bool, error)
+	SetCampaignState(ctx context.Context, id string, skus []string, state string) (bool, error)
+	CampaignForSKU(ctx context.Context, sku string) (*CampaignMeta, int, error)
+	CampaignStock(ctx context.Context, sku string) (int, error)
+
+	// 幂等
+	BeginIdempotent(ctx context.Context, key, fingerprint string, pendingTTL time.Duration) (*IdempotencyRecord, bool, error)
+	CompleteIdempotent(ctx context.Context, key, fingerprint string, status int, body []byte, ttl time.Duration) error
+	ReleaseIdempotent(ctx context.Context, key string) error
+
+	// SubscribeRestock 订阅补货通知 (售罄缓存使用)
+	SubscribeRestock(ctx context.Context) *redis.PubSub
+
+	Close() error
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 推送请求头
+const (
+	SignatureHeader = "X-OmniFlow-Signature" // t=<unix 秒>,v1=<hex(HMAC-SHA256(secret, "<t>.<body>"))>
+	EventHeader     = "X-OmniFlow-Event"     // 事件类型，如 order.paid
+	EventIDHeader   = "X-OmniFlow-Event-Id"  // 事件 ID，重试与重放不变，接收方据此去重
+	DeliveryHeader  = "X-OmniFlow-Delivery"  // 投递记录 ID，每次重放都会变化
+)
+
+// DefaultTolerance 接收方允许的签名时间偏差，超出视为重放攻击
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrInvalidSignature = errors.New("webhook 签名无效")
+	ErrSignatureExpired = errors.New("webhook 签名已过期")
+)
+
+// NewSecret 生成订阅的签名密钥
+func NewSecret() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// Sign 计算签名头；时间戳参与签名，旧请求被截获后无法在容忍时间外重放
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",v1=" + mac(secret, t, body)
+}
+
+// Verify 校验签名头 (接收方使用)；tolerance <= 0 时不校验时间
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var t string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	ts, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	want := mac(secret, t, body)
+	valid := false
+	for _, s := range sigs {
+		if hmac.Equal([]byte(s), []byte(want)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+			return fmt.Errorf("%w: 相差 %s", ErrSignatureExpired, d.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+func mac(secret, t string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(t))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := NewSecret()
+	require.True(t, strings.HasPrefix(secret, "whsec_"))
+	assert.NotEqual(t, secret, NewSecret())
+
+	body := []byte(`{"id":"ORDER-1-3","type":"order.paid"}`)
+	now := time.Unix(1760000000, 0)
+	header := Sign(secret, now, body)
+	assert.True(t, strings.HasPrefix(header, "t=1760000000,v1="))
+
+	require.NoError(t, Verify(secret, header, body, now.Add(time.Minute), DefaultTolerance))
+	// 密钥轮换期间可以带多个 v1，任一匹配即可
+	require.NoError(t, Verify(secret, header+",v1=deadbeef", body, now, DefaultTolerance))
+
+	assert.ErrorIs(t, Verify("other", header, body, now, DefaultTolerance), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(secret, header, []byte(`{"id":"ORDER-1-4"}`), now, DefaultTolerance), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(secret, "v1=abc", body, now, DefaultTolerance), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(secret, header, body, now.Add(10*time.Minute), DefaultTolerance), ErrSignatureExpired)
+	require.NoError(t, Verify(secret, header, body, now.Add(time.Hour), 0))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 )
@@ -16,6 +17,7 @@ func main() {
 
 	apiURL := "http://localhost:8000/api/v1/orders"
 	jsonBody := []byte(`{"amount": 100, "items": ["iPhone15"]}`)
+	token := os.Getenv("TOKEN") // 客户角色的 Bearer Token
 
 	// 🔥 2. 必须优化 Client，消除客户端瓶颈
 	httpClient := &http.Client{
@@ -48,7 +50,10 @@ func main() {
 				wg.Done()
 			}()
 
-			resp, err := httpClient.Post(apiURL, "application/json", bytes.NewBuffer(jsonBody))
+			req, _ := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := httpClient.Do(req)
 			if err != nil {
 				fmt.Printf("请求失败: %v\n", err)
 				return
@@ -57,7 +62,7 @@ func main() {
 			resp.Body.Close()
 
 			mu.Lock()
-			if resp.StatusCode == 200 {
+			if resp.StatusCode == 200 || resp.StatusCode == 202 {
 				success++
 			} else if resp.StatusCode == 429 {
 				failure++
@@ -79,7 +84,7 @@ func main() {
 	fmt.Printf("总请求: %d\n", totalRequests)
 	fmt.Printf("🔥 真实 QPS: %.2f (Requests/Sec)\n", qps) // 这里就是你要的数字！
 	fmt.Printf("---------------------------\n")
-	fmt.Printf("成功 (200): %d\n", success)
+	fmt.Printf("成功 (200/202): %d\n", success)
 	fmt.Printf("拦截 (429): %d\n", failure)
 	fmt.Printf("错误 (Other): %d\n", other)
 }